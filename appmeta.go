@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// File options describing the app generated from a file:
+// (django.app).name, its label unless -app-name sets one,
+// (django.app).verbose_name, its title in the admin, and
+// (django.app).url_prefix, the path -project-root includes its URLs at.
+const (
+	appOption            = "django.app"
+	appNameOption        = appOption + ".name"
+	appVerboseNameOption = appOption + ".verbose_name"
+	appURLPrefixOption   = appOption + ".url_prefix"
+)
+
+// urlPrefixRe matches the URL prefixes the option accepts, which are
+// rendered into Python strings unescaped.
+var urlPrefixRe = regexp.MustCompile(`^[\w.~-]+(/[\w.~-]+)*$`)
+
+// optionAppName returns the app the (django.app).name options of files
+// name, "" when none does.
+func optionAppName(files []*ProtoFile) (string, error) {
+	var name, source string
+	for _, file := range files {
+		v := file.Options[appNameOption]
+		switch {
+		case v == "" || v == name:
+		case name != "":
+			return "", fmt.Errorf("%s names app %q in %s and %q in %s; generate them separately or with -split-packages",
+				appNameOption, name, source, v, strings.Join(file.Sources, ", "))
+		default:
+			name, source = v, strings.Join(file.Sources, ", ")
+		}
+	}
+	return name, nil
+}
+
+// appURLPrefix returns the path the URLs of the app named appName are
+// included at: the (django.app).url_prefix option of file, with a trailing
+// slash, or else appName/. The prefix "/" includes them at the root.
+func appURLPrefix(file *ProtoFile, appName string) (string, error) {
+	prefix, ok := file.Options[appURLPrefixOption]
+	if !ok {
+		return appName + "/", nil
+	}
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return "", nil
+	}
+	if !urlPrefixRe.MatchString(prefix) {
+		return "", fmt.Errorf("invalid %s %q", appURLPrefixOption, file.Options[appURLPrefixOption])
+	}
+	return prefix + "/", nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Archive formats of generated apps.
+const (
+	ArchiveTar = "tar"
+	ArchiveZip = "zip"
+)
+
+// GenerateArchive generates the app named name into a temporary directory and
+// writes it to w as a tar or zip archive whose entries are rooted at name/.
+func GenerateArchive(protoPaths []string, w io.Writer, name, format string, opts Options) error {
+	if format != ArchiveTar && format != ArchiveZip {
+		return fmt.Errorf("unknown archive format %q (want %s or %s)", format, ArchiveTar, ArchiveZip)
+	}
+	tmp, err := os.MkdirTemp("", "proto2django-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	if err := GenerateApp(protoPaths, filepath.Join(tmp, name), opts); err != nil {
+		return err
+	}
+	if format == ArchiveZip {
+		return writeZip(w, tmp)
+	}
+	return writeTar(w, tmp)
+}
+
+// writeTar writes the tree beneath root to w as a tarball.
+func writeTar(w io.Writer, root string) error {
+	tw := tar.NewWriter(w)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == root {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		hdr.Name = filepath.ToSlash(rel)
+		if d.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		return copyInto(tw, path)
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// writeZip writes the tree beneath root to w as a zip archive.
+func writeZip(w io.Writer, root string) error {
+	zw := zip.NewWriter(w)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == root {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hdr, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		hdr.Name = filepath.ToSlash(rel)
+		if d.IsDir() {
+			hdr.Name += "/"
+		} else {
+			hdr.Method = zip.Deflate
+		}
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil || d.IsDir() {
+			return err
+		}
+		return copyInto(fw, path)
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// copyInto copies the file at path into w.
+func copyInto(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// generateArchive writes the app to stdout when out is -, else to the file
+// out. The app is named by -app-name, or after out without its extension.
+func generateArchive(protoPaths []string, out, format string, opts Options) error {
+	if format == "" {
+		format = ArchiveTar
+	}
+	name := opts.AppName
+	if out == "-" {
+		if name == "" {
+			name = "generated_app"
+		}
+		return GenerateArchive(protoPaths, os.Stdout, name, format, opts)
+	}
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(out), filepath.Ext(out))
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	if err := GenerateArchive(protoPaths, f, name, format, opts); err != nil {
+		f.Close()
+		os.Remove(out)
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,34 @@
+package main
+
+import "strings"
+
+// fieldBehaviorOption is the google.api field annotation describing how a
+// field is set: (google.api.field_behavior) = OUTPUT_ONLY and friends.
+const fieldBehaviorOption = "google.api.field_behavior"
+
+// fieldBehavior is the subset of google.api.FieldBehavior values the
+// generator acts on.
+type fieldBehavior struct {
+	// OutputOnly fields are set by the server and never accepted as input.
+	OutputOnly bool
+	// Immutable fields may be set on create but not changed by updates.
+	Immutable bool
+	// Required fields must be provided.
+	Required bool
+}
+
+// fieldBehaviors reads the (google.api.field_behavior) annotations of f.
+func fieldBehaviors(f ProtoField) fieldBehavior {
+	var b fieldBehavior
+	for _, v := range strings.Split(f.Options[fieldBehaviorOption], ",") {
+		switch strings.TrimPrefix(strings.TrimSpace(v), "google.api.FieldBehavior.") {
+		case "OUTPUT_ONLY":
+			b.OutputOnly = true
+		case "IMMUTABLE":
+			b.Immutable = true
+		case "REQUIRED":
+			b.Required = true
+		}
+	}
+	return b
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// cacheDir returns the directory generation results are cached in: dir when
+// set, else proto2django beneath the user cache directory (~/.cache on Linux).
+func cacheDir(dir string) (string, error) {
+	if dir != "" {
+		return dir, nil
+	}
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "proto2django"), nil
+}
+
+// cacheKey hashes everything generation depends on: the tool version, the
+// contents of the protos and model map, the output directory, which names
+// the app, and the options that shape the output.
+func cacheKey(protoPaths []string, outputDir string, opts Options) (string, error) {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n%s\n", Version, outputDir)
+	inputs := append([]string(nil), protoPaths...)
+	if opts.ModelMap != "" {
+		inputs = append(inputs, opts.ModelMap)
+	}
+	if opts.Templates != "" {
+		templates, err := filepath.Glob(filepath.Join(opts.Templates, "*"))
+		if err != nil {
+			return "", err
+		}
+		for _, path := range templates {
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				inputs = append(inputs, path)
+			}
+		}
+	}
+	for _, path := range inputs {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(hash, "%s\n", path)
+		_, err = io.Copy(hash, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	opts.Cache, opts.CacheDir, opts.Jobs, opts.EmitIR = false, "", 0, ""
+	if err := json.NewEncoder(hash).Encode(opts); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// loadCached returns the plan cached under key when outputDir still holds
+// what generating it produced. Missing files are restored from the cache;
+// a generated file edited by hand is a miss, so that it is regenerated.
+func loadCached(dir, key, outputDir string) (IR, bool) {
+	entry := filepath.Join(dir, key)
+	data, err := os.ReadFile(filepath.Join(entry, "ir.json"))
+	if err != nil {
+		return IR{}, false
+	}
+	var ir IR
+	if err := json.Unmarshal(data, &ir); err != nil {
+		return IR{}, false
+	}
+	for _, app := range ir.Apps {
+		for _, name := range app.Files {
+			path := filepath.Join(app.Dir, name)
+			content, err := os.ReadFile(path)
+			if os.IsNotExist(err) {
+				rel, err := filepath.Rel(outputDir, path)
+				if err != nil || copyFile(filepath.Join(entry, "files", rel), path) != nil {
+					return IR{}, false
+				}
+				slog.Debug("restored file from cache", "path", path)
+				continue
+			}
+			if err != nil {
+				return IR{}, false
+			}
+			if edited, _ := hasDrifted(content); edited {
+				return IR{}, false
+			}
+		}
+	}
+	return ir, true
+}
+
+// storeCache records the plan and the files generated for it under key.
+func storeCache(dir, key, outputDir string, ir IR) error {
+	entry := filepath.Join(dir, key)
+	tmp, err := os.MkdirTemp(dir, key+".tmp-")
+	if err != nil {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return err
+		}
+		if tmp, err = os.MkdirTemp(dir, key+".tmp-"); err != nil {
+			return err
+		}
+	}
+	defer os.RemoveAll(tmp)
+	for _, app := range ir.Apps {
+		for _, name := range app.Files {
+			path := filepath.Join(app.Dir, name)
+			rel, err := filepath.Rel(outputDir, path)
+			if err != nil {
+				return err
+			}
+			if err := copyFile(path, filepath.Join(tmp, "files", rel)); err != nil {
+				return err
+			}
+		}
+	}
+	data, err := json.Marshal(ir)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "ir.json"), data, 0644); err != nil {
+		return err
+	}
+	// Concurrent builds may race to store the same entry; either copy is fine.
+	os.RemoveAll(entry)
+	return os.Rename(tmp, entry)
+}
+
+// copyFile copies src to dst, creating dst's directory.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"log/slog"
+	"sort"
+)
+
+// RenderedTask is a tasks.py Celery task calling one unary RPC.
+type RenderedTask struct {
+	// Name is the task function; TaskName is its registered Celery name.
+	Name     string
+	TaskName string
+	Comment  string
+	// Client and Method name the clients.py wrapper the task calls.
+	Client string
+	Method string
+	// Request is the protobuf request class.
+	Request string
+	// Model is set when the request message is one of the app's models; the
+	// task then loads that row and copies ProtoFields into the request.
+	Model       string
+	ProtoFields []ProtoAttr
+}
+
+// ProtoAttr pairs a proto field name with the model attribute storing it.
+type ProtoAttr struct {
+	ProtoName string
+	Name      string
+	Repeated  bool
+}
+
+// requestFields returns the fields of msg that convert directly to proto
+// values; relations and well-known types are left to the task's author.
+func requestFields(msg RenderedMessage) []ProtoAttr {
+	var attrs []ProtoAttr
+	for _, f := range msg.Fields {
+		if f.Synthetic {
+			continue
+		}
+		switch f.Type {
+		case dateType, timestampType, moneyType, latLngType:
+			continue
+		}
+		if isScalar(f.Type) {
+			attrs = append(attrs, ProtoAttr{ProtoName: f.ProtoName, Name: f.Name, Repeated: f.Repeated})
+		}
+	}
+	return attrs
+}
+
+// celeryTasks renders a task per unary RPC of data's clients along with the
+// imports of the protobuf modules holding their request classes. Streaming
+// RPCs and RPCs whose request class is unknown are skipped.
+func celeryTasks(data TemplateData) ([]RenderedTask, []string) {
+	models := map[string]RenderedMessage{}
+	for _, msg := range data.Messages {
+		if msg.ProtoName != "" {
+			models[msg.ProtoName] = msg
+		}
+	}
+
+	var tasks []RenderedTask
+	var imports []string
+	for _, client := range data.Clients {
+		for _, rpc := range client.Methods {
+			if rpc.Streaming() || rpc.Input == "" {
+				slog.Debug("no celery task for rpc", "rpc", rpc.RPC, "streaming", rpc.Streaming())
+				continue
+			}
+			task := RenderedTask{
+				Name:     snakeCase(client.Name) + "_" + rpc.Name,
+				TaskName: data.AppName + "." + client.Name + "." + rpc.RPC,
+				Comment:  rpc.Comment,
+				Client:   client.Name + "Client",
+				Method:   rpc.Name,
+				Request:  rpc.Input,
+			}
+			if msg, ok := models[rpc.InputType]; ok {
+				task.Model = msg.Name
+				task.ProtoFields = requestFields(msg)
+			}
+			tasks = append(tasks, task)
+			imports = appendUnique(imports, pbImport(data.GRPCImports, rpc.Input))
+		}
+	}
+	sort.Strings(imports)
+	return tasks, imports
+}
+
+const tasksTemplate = `from celery import shared_task
+from google.protobuf.json_format import MessageToDict
+{{ range .TaskImports }}
+{{ . }}
+{{- end }}
+
+from . import clients, models
+
+
+def proto_fields(instance, fields):
+    """Reads the model attributes named by fields, keyed by proto field name,
+    leaving out unset values."""
+    values = {}
+    for proto_name, attr in fields.items():
+        value = getattr(instance, attr)
+        if value is not None:
+            values[proto_name] = value
+    return values
+{{ range .Tasks }}
+
+@shared_task(name='{{ .TaskName }}')
+{{- if .Model }}
+def {{ .Name }}(pk, **fields):
+    {{ if .Comment }}{{ Docstring .Comment }}{{ else }}"""Sends the {{ .Model }} with the given pk, overridden by fields."""{{ end }}
+    instance = models.{{ .Model }}.objects.get(pk=pk)
+    values = proto_fields(instance, {
+{{- range .ProtoFields }}
+        '{{ .ProtoName }}': '{{ .Name }}',
+{{- end }}
+    })
+    values.update(fields)
+    response = clients.{{ .Client }}().{{ .Method }}({{ .Request }}(**values))
+{{- else }}
+def {{ .Name }}(**fields):
+    {{ if .Comment }}{{ Docstring .Comment }}{{ else }}"""Sends a request built from fields."""{{ end }}
+    response = clients.{{ .Client }}().{{ .Method }}({{ .Request }}(**fields))
+{{- end }}
+    return MessageToDict(response, preserving_proto_field_name=True)
+{{ end }}`
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+// RenderedConsumer is a Channels WebSocket consumer relaying a server
+// streaming or bidirectional RPC.
+type RenderedConsumer struct {
+	Name    string
+	Comment string
+	// Path is the WebSocket route, relative to the site root.
+	Path string
+	// Request is the protobuf request class; Bidi marks bidirectional streams.
+	Request string
+	Bidi    bool
+	// Client and Method name the clients.py wrapper the consumer calls.
+	Client string
+	Method string
+}
+
+// channelsConsumers renders a consumer per server streaming or bidi RPC of
+// data's clients along with the imports of their request classes.
+func channelsConsumers(data TemplateData) ([]RenderedConsumer, []string) {
+	var consumers []RenderedConsumer
+	var imports []string
+	for _, client := range data.Clients {
+		for _, rpc := range client.Methods {
+			if !rpc.ServerStreaming {
+				continue
+			}
+			if rpc.Input == "" {
+				slog.Warn("streaming rpc has an unknown request message, consumer not generated", "rpc", rpc.RPC, "type", rpc.InputType)
+				continue
+			}
+			request := strings.TrimSuffix(strings.TrimPrefix(rpc.Input, "Iterator["), "]")
+			consumers = append(consumers, RenderedConsumer{
+				Name:    rpc.RPC + "Consumer",
+				Comment: rpc.Comment,
+				Path:    "ws/" + data.AppName + "/" + strings.ReplaceAll(rpc.Name, "_", "-") + "/",
+				Request: request,
+				Bidi:    rpc.ClientStreaming,
+				Client:  client.Name + "Client",
+				Method:  rpc.Name,
+			})
+			imports = appendUnique(imports, pbImport(data.GRPCImports, request))
+		}
+	}
+	sort.Strings(imports)
+	return consumers, imports
+}
+
+const consumersTemplate = `import queue
+import threading
+
+import grpc
+from channels.generic.websocket import JsonWebsocketConsumer
+from google.protobuf.json_format import MessageToDict, ParseDict
+{{ range .ConsumerImports }}
+{{ . }}
+{{- end }}
+
+from . import clients
+
+
+class StreamConsumer(JsonWebsocketConsumer):
+    """Relays a streaming RPC over a WebSocket: JSON frames received are parsed
+    into request messages and every response message is sent back as JSON."""
+
+    request_class = None
+    # Bidirectional streams send every frame on one call; server streams
+    # start a new call, cancelling the previous one, per frame.
+    bidi = False
+
+    def connect(self):
+        self.requests = queue.Queue()
+        self.call = None
+        self.accept()
+        if self.bidi:
+            self.start(iter(self.requests.get, None))
+
+    def disconnect(self, code):
+        self.requests.put(None)
+        if self.call is not None:
+            self.call.cancel()
+
+    def receive_json(self, content, **kwargs):
+        request = ParseDict(content, self.request_class(), ignore_unknown_fields=True)
+        if self.bidi:
+            self.requests.put(request)
+            return
+        if self.call is not None:
+            self.call.cancel()
+        self.start(request)
+
+    def invoke(self, request):
+        """Calls the RPC and returns its response iterator."""
+        raise NotImplementedError
+
+    def start(self, request):
+        self.call = self.invoke(request)
+        threading.Thread(target=self.relay, args=(self.call,), daemon=True).start()
+
+    def relay(self, call):
+        try:
+            for response in call:
+                self.send_json(MessageToDict(response, preserving_proto_field_name=True))
+        except grpc.RpcError as exc:
+            if exc.code() != grpc.StatusCode.CANCELLED:
+                self.send_json({'error': exc.code().name, 'details': exc.details()})
+                self.close()
+{{ range .Consumers }}
+
+class {{ .Name }}(StreamConsumer):
+    {{ if .Comment }}{{ Docstring .Comment }}{{ else }}"""Relays the {{ .Method }} stream."""{{ end }}
+
+    request_class = {{ .Request }}
+{{- if .Bidi }}
+    bidi = True
+{{- end }}
+
+    def invoke(self, request):
+        return clients.{{ .Client }}().{{ .Method }}(request)
+{{ end }}`
+
+const routingTemplate = `from django.urls import path
+
+from . import consumers
+
+websocket_urlpatterns = [
+{{- range .Consumers }}
+    path('{{ .Path }}', consumers.{{ .Name }}.as_asgi()),
+{{- end }}
+]
+`
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// command is a proto2django subcommand.
+type command struct {
+	Name string
+	// Aliases are other names the command answers to.
+	Aliases []string
+	// Args describes the positional arguments in the usage line.
+	Args    string
+	Summary string
+	// Help, when set, replaces Summary in the command's own usage.
+	Help string
+	// setup registers the command's flags on fs and returns the function
+	// running it once they are parsed, which returns the exit code.
+	setup func(fs *flag.FlagSet) func() int
+}
+
+// commands lists the subcommands in the order help shows them. generate runs
+// when no subcommand is named.
+func commands() []command {
+	return []command{
+		{Name: "generate", Summary: "Generate a Django app from .proto files", setup: generateCommand},
+		{Name: "validate", Summary: "Check .proto files for errors without generating anything", setup: validateCommand},
+		{Name: "diff", Aliases: []string{"diff-schema"}, Args: "OLD NEW", Summary: "Print the migration operations between two schemas", Help: "Print the migration operations from schema OLD to NEW, each an -emit-ir JSON file or comma-separated .proto files", setup: diffCommand},
+		{Name: "verify", Summary: "Check a checked-in app still matches its .proto files", setup: verifyCommand},
+		{Name: "reverse", Summary: "Write a .proto declaring the models of an existing models.py", setup: reverseCommand},
+		{Name: "completion", Args: "bash|zsh|fish", Summary: "Print a shell completion script", setup: completionCommand},
+	}
+}
+
+// lookupCommand returns the command called name or one of its aliases.
+func lookupCommand(name string) (command, bool) {
+	for _, c := range commands() {
+		if c.Name == name {
+			return c, true
+		}
+		for _, alias := range c.Aliases {
+			if alias == name {
+				return c, true
+			}
+		}
+	}
+	return command{}, false
+}
+
+// commandFlags returns c's flag set, with its usage, without running it.
+func commandFlags(c command) (*flag.FlagSet, func() int) {
+	fs := flag.NewFlagSet("proto2django "+c.Name, flag.ContinueOnError)
+	run := c.setup(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: proto2django %s [flags]", c.Name)
+		if c.Args != "" {
+			fmt.Fprintf(fs.Output(), " %s", c.Args)
+		}
+		help := c.Summary
+		if c.Help != "" {
+			help = c.Help
+		}
+		fmt.Fprintf(fs.Output(), "\n\n%s.\n\nFlags:\n", help)
+		fs.PrintDefaults()
+	}
+	return fs, run
+}
+
+// runCLI runs the subcommand named by args[0], or generate when args start
+// with a flag, and returns the exit code.
+func runCLI(args []string) int {
+	if len(args) == 0 {
+		usage(os.Stderr)
+		return ExitUsage
+	}
+	name := args[0]
+	switch {
+	case name == "help" || name == "-h" || name == "-help" || name == "--help":
+		if len(args) > 1 {
+			if c, ok := lookupCommand(args[1]); ok {
+				fs, _ := commandFlags(c)
+				fs.SetOutput(os.Stdout)
+				fs.Usage()
+				return 0
+			}
+		}
+		usage(os.Stdout)
+		return 0
+	case strings.HasPrefix(name, "-"):
+		// Flags without a subcommand generate, as before subcommands.
+		name = "generate"
+	default:
+		args = args[1:]
+	}
+	c, ok := lookupCommand(name)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "proto2django: unknown command %q\n\n", name)
+		usage(os.Stderr)
+		return ExitUsage
+	}
+	fs, run := commandFlags(c)
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return ExitUsage
+	}
+	return run()
+}
+
+// usage writes the list of commands to w.
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: proto2django <command> [flags]")
+	fmt.Fprintln(w, "\nCommands:")
+	for _, c := range commands() {
+		fmt.Fprintf(w, "  %-11s %s\n", c.Name, c.Summary)
+	}
+	fmt.Fprintln(w, "\nRun 'proto2django help <command>' for a command's flags.")
+}
+
+// completionCommand sets up `proto2django completion SHELL`, which prints a
+// completion script for bash, zsh or fish.
+func completionCommand(fs *flag.FlagSet) func() int {
+	return func() int {
+		if fs.NArg() != 1 {
+			fs.Usage()
+			return ExitUsage
+		}
+		var script string
+		switch fs.Arg(0) {
+		case "bash":
+			script = bashCompletion()
+		case "zsh":
+			script = zshCompletion()
+		case "fish":
+			script = fishCompletion()
+		default:
+			fmt.Fprintf(os.Stderr, "proto2django: no completion for shell %q (want bash, zsh or fish)\n", fs.Arg(0))
+			return ExitUsage
+		}
+		fmt.Print(script)
+		return 0
+	}
+}
+
+// completionFlag is a flag offered by completion scripts.
+type completionFlag struct {
+	Name  string
+	Usage string
+	// Value is set for flags taking a value, as opposed to booleans.
+	Value bool
+}
+
+// completionFlags returns the sorted flags of c.
+func completionFlags(c command) []completionFlag {
+	fs, _ := commandFlags(c)
+	var flags []completionFlag
+	fs.VisitAll(func(f *flag.Flag) {
+		b, ok := f.Value.(interface{ IsBoolFlag() bool })
+		flags = append(flags, completionFlag{Name: f.Name, Usage: f.Usage, Value: !ok || !b.IsBoolFlag()})
+	})
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+	return flags
+}
+
+// commandNames returns the names and aliases of every command.
+func commandNames() []string {
+	var names []string
+	for _, c := range commands() {
+		names = append(names, c.Name)
+		names = append(names, c.Aliases...)
+	}
+	return names
+}
+
+func bashCompletion() string {
+	var b strings.Builder
+	flagWords := func(c command) string {
+		var words []string
+		for _, f := range completionFlags(c) {
+			words = append(words, "-"+f.Name)
+		}
+		return strings.Join(words, " ")
+	}
+	generate, _ := lookupCommand("generate")
+	b.WriteString("# bash completion for proto2django\n_proto2django() {\n")
+	b.WriteString("    local cur=${COMP_WORDS[COMP_CWORD]} cmd=${COMP_WORDS[1]}\n")
+	b.WriteString("    if [[ $COMP_CWORD -eq 1 && $cur != -* ]]; then\n")
+	fmt.Fprintf(&b, "        COMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(append(commandNames(), "help"), " "))
+	b.WriteString("        return\n    fi\n")
+	b.WriteString("    [[ $cur == -* ]] || return\n")
+	b.WriteString("    local flags\n    case $cmd in\n")
+	for _, c := range commands() {
+		fmt.Fprintf(&b, "    %s)\n        flags=%q ;;\n", strings.Join(append([]string{c.Name}, c.Aliases...), "|"), flagWords(c))
+	}
+	fmt.Fprintf(&b, "    *)\n        flags=%q ;;\n    esac\n", flagWords(generate))
+	b.WriteString("    COMPREPLY=($(compgen -W \"$flags\" -- \"$cur\"))\n}\n")
+	b.WriteString("complete -o default -F _proto2django proto2django\n")
+	return b.String()
+}
+
+func zshCompletion() string {
+	quote := func(s string) string {
+		return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+	}
+	escape := strings.NewReplacer("[", `\[`, "]", `\]`).Replace
+	specs := func(c command) string {
+		lines := []string{"            '*:file:_files'"}
+		for _, f := range completionFlags(c) {
+			spec := "-" + f.Name + "[" + escape(f.Usage) + "]"
+			if f.Value {
+				spec += ":" + f.Name + ":_files"
+			}
+			lines = append(lines, "            "+quote(spec))
+		}
+		return strings.Join(lines, " \\\n")
+	}
+	var b strings.Builder
+	b.WriteString("#compdef proto2django\n\n_proto2django() {\n")
+	b.WriteString("    if (( CURRENT == 2 )) && [[ $words[2] != -* ]]; then\n")
+	b.WriteString("        local -a cmds\n        cmds=(\n")
+	for _, c := range commands() {
+		fmt.Fprintf(&b, "            %s\n", quote(c.Name+":"+escape(c.Summary)))
+	}
+	b.WriteString("        )\n        _describe command cmds\n        return\n    fi\n")
+	b.WriteString("    local cmd=$words[2]\n    if [[ $cmd == -* ]]; then\n        cmd=generate\n    else\n        shift words\n        (( CURRENT-- ))\n    fi\n")
+	b.WriteString("    case $cmd in\n")
+	for _, c := range commands() {
+		fmt.Fprintf(&b, "    %s)\n        _arguments \\\n%s\n        ;;\n", strings.Join(append([]string{c.Name}, c.Aliases...), "|"), specs(c))
+	}
+	b.WriteString("    esac\n}\n\n_proto2django \"$@\"\n")
+	return b.String()
+}
+
+func fishCompletion() string {
+	quote := func(s string) string {
+		return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+	}
+	var b strings.Builder
+	b.WriteString("# fish completion for proto2django\n")
+	for _, c := range commands() {
+		fmt.Fprintf(&b, "complete -c proto2django -f -n __fish_use_subcommand -a %s -d %s\n", c.Name, quote(c.Summary))
+	}
+	for _, c := range commands() {
+		names := strings.Join(append([]string{c.Name}, c.Aliases...), " ")
+		for _, f := range completionFlags(c) {
+			arg := ""
+			if f.Value {
+				arg = " -r"
+			}
+			fmt.Fprintf(&b, "complete -c proto2django -n '__fish_seen_subcommand_from %s' -o %s%s -d %s\n", names, f.Name, arg, quote(f.Usage))
+		}
+	}
+	return b.String()
+}
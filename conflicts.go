@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// nameOrigin is a declaration a generated name comes from, at a position of
+// a .proto source when it has one.
+type nameOrigin struct {
+	what   string
+	source string
+	line   int
+	column int
+}
+
+func (o nameOrigin) String() string {
+	if o.source == "" {
+		return o.what
+	}
+	return fmt.Sprintf("%s (%s:%d)", o.what, o.source, o.line)
+}
+
+// nameTable collects the names generated into one scope of a file, such as
+// the classes of models.py or the routes of a router, in declaration order.
+type nameTable struct {
+	scope   string
+	names   []string
+	origins map[string][]nameOrigin
+}
+
+func newNameTable(scope string) *nameTable {
+	return &nameTable{scope: scope, origins: map[string][]nameOrigin{}}
+}
+
+func (t *nameTable) add(name string, origin nameOrigin) {
+	if _, ok := t.origins[name]; !ok {
+		t.names = append(t.names, name)
+	}
+	t.origins[name] = append(t.origins[name], origin)
+}
+
+// conflicts returns a diagnostic per name generated more than once, at the
+// position of the last declaration generating it.
+func (t *nameTable) conflicts() []error {
+	var errs []error
+	for _, name := range t.names {
+		origins := t.origins[name]
+		if len(origins) < 2 {
+			continue
+		}
+		var pos nameOrigin
+		what := make([]string, len(origins))
+		for i, o := range origins {
+			what[i] = o.String()
+			if o.source != "" {
+				pos = o
+			}
+		}
+		errs = append(errs, errorAt(CodeNameConflict, pos.source, pos.line, pos.column,
+			"%s would declare %s %d times, for %s", t.scope, name, len(origins), strings.Join(what, ", ")))
+	}
+	return errs
+}
+
+// checkConflicts reports every name the apps would generate more than once,
+// which would make for broken Python or unreachable routes: model and enum
+// classes of models.py, fields of a model, serializer classes and the
+// fields they declare, and the route prefixes of each router. They are
+// checked before any app is written, so that conflicts leave the output
+// untouched.
+func checkConflicts(apps []*preparedApp) error {
+	var errs []error
+	for _, app := range apps {
+		errs = append(errs, appConflicts(app)...)
+	}
+	return errors.Join(errs...)
+}
+
+// appConflicts returns the conflicts of the names generated into app.
+func appConflicts(app *preparedApp) []error {
+	data := app.data
+	path := func(name string) string { return filepath.Join(app.outputDir, name) }
+
+	// Messages generating several models, as versions of one another, are
+	// rendered in declaration order, so the n-th model of a message is
+	// generated from its n-th declaration.
+	declared := map[string][]ProtoMessage{}
+	for _, msg := range app.file.Messages {
+		declared[msg.Name] = append(declared[msg.Name], msg)
+	}
+	rendered := map[string]int{}
+	origins := make([]nameOrigin, len(data.Messages))
+	decls := make([]ProtoMessage, len(data.Messages))
+	// positions lists the models named name, in the order rendered.
+	positions := map[string][]int{}
+	for i, msg := range data.Messages {
+		positions[msg.Name] = append(positions[msg.Name], i)
+		candidates := declared[msg.ProtoName]
+		if msg.ProtoName == "" || rendered[msg.ProtoName] >= len(candidates) {
+			origins[i] = nameOrigin{what: "child table " + msg.Name}
+			continue
+		}
+		decls[i] = candidates[rendered[msg.ProtoName]]
+		rendered[msg.ProtoName]++
+		origins[i] = nameOrigin{what: "message " + decls[i].Name, source: decls[i].Source, line: decls[i].Line, column: decls[i].Column}
+	}
+	fieldOrigin := func(i int, f RenderedField) nameOrigin {
+		origin := nameOrigin{what: "field " + f.ProtoName, source: origins[i].source, line: origins[i].line, column: origins[i].column}
+		for _, pf := range decls[i].Fields {
+			if pf.Name == f.ProtoName {
+				origin.line, origin.column = pf.Line, pf.Column
+			}
+		}
+		return origin
+	}
+
+	var tables []*nameTable
+	classes := newNameTable(path("models.py"))
+	tables = append(tables, classes)
+	if data.BaseModel {
+		classes.add("BaseModel", nameOrigin{what: "the abstract BaseModel"})
+	}
+	for _, e := range data.Enums {
+		origin := nameOrigin{what: "enum " + e.Name}
+		for _, decl := range app.file.Enums {
+			if pascalCase(decl.Name) == e.Name {
+				origin = nameOrigin{what: "enum " + decl.Name, source: decl.Source, line: decl.Line, column: decl.Column}
+				break
+			}
+		}
+		classes.add(e.Name, origin)
+	}
+	for i, msg := range data.Messages {
+		classes.add(msg.Name, origins[i])
+		fields := newNameTable(path("models.py") + " model " + msg.Name)
+		tables = append(tables, fields)
+		for _, f := range msg.Fields {
+			fields.add(f.Name, fieldOrigin(i, f))
+		}
+	}
+
+	// The serializers and routes of a model declared twice would conflict
+	// too; only those of its first declaration are checked.
+	first := func(i int, name string) bool { return positions[name][0] == i }
+	if data.APIs[APIDRF] {
+		serializers := newNameTable(path("serializers.py"))
+		tables = append(tables, serializers)
+		for i, msg := range data.Messages {
+			if !first(i, msg.Name) || !slices.Contains(msg.Layers, LayerAPI) {
+				continue
+			}
+			serializers.add(msg.Name+"Serializer", origins[i])
+			declaredFields := newNameTable(path("serializers.py") + " " + msg.Name + "Serializer")
+			tables = append(tables, declaredFields)
+			for _, f := range msg.Fields {
+				if slices.Contains(msg.SerializerExclude, f.Name) {
+					continue
+				}
+				key := f.Name
+				if f.SerializerType != "" {
+					key = f.JSONName
+				}
+				declaredFields.add(key, fieldOrigin(i, f))
+			}
+		}
+		for _, s := range data.RequestSerializers {
+			origin := nameOrigin{what: "request message " + s.Message}
+			if decls := declared[s.Message]; len(decls) > 0 {
+				origin.source, origin.line, origin.column = decls[0].Source, decls[0].Line, decls[0].Column
+			}
+			serializers.add(s.Name, origin)
+		}
+
+		for _, r := range data.Routers {
+			routes := newNameTable(path("urls.py") + " " + r.Name)
+			tables = append(tables, routes)
+			registered := map[string]bool{}
+			for _, msg := range r.Messages {
+				if msg.ParentKwarg == "" && !registered[msg.Name] {
+					registered[msg.Name] = true
+					routes.add(msg.RoutePrefix, origins[positions[msg.Name][0]])
+				}
+			}
+			for _, n := range r.Nested {
+				nested := newNameTable(path("urls.py") + " " + n.Name)
+				tables = append(tables, nested)
+				for _, child := range n.Children {
+					if !registered[child.Name] {
+						registered[child.Name] = true
+						nested.add(child.RoutePrefix, origins[positions[child.Name][0]])
+					}
+				}
+			}
+		}
+	}
+
+	var errs []error
+	for _, t := range tables {
+		errs = append(errs, t.conflicts()...)
+	}
+	return errs
+}
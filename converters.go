@@ -0,0 +1,350 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// Kinds of converted fields.
+const (
+	convertScalar  = "scalar"
+	convertDecimal = "decimal"
+	convertDate    = "date"
+	convertTime    = "timestamp"
+	convertMoney   = "money"
+	convertLatLng  = "latlng"
+	convertOne     = "one"
+	convertMany    = "many"
+)
+
+// RenderedConverter is the pair of converters.py functions between a model
+// and its protobuf message.
+type RenderedConverter struct {
+	Model     string
+	SnakeName string
+	// Message is the protobuf class, e.g. sample_pb2.User.
+	Message string
+	Fields  []ConvertedField
+}
+
+// ConvertedField is a model field converters.py copies to and from the
+// message.
+type ConvertedField struct {
+	ProtoAttr
+	// Kind is one of the convert* kinds.
+	Kind string
+	// Target is the snake name of a related model, whose converters
+	// convert the related rows.
+	Target string
+	// Point is set for LatLngs stored as GeoDjango PointFields.
+	Point bool
+	// Keyword is set when the proto name is a Python keyword, which the
+	// message only exposes through getattr and setattr.
+	Keyword bool
+	// Optional is set for scalars with presence, which are None unless the
+	// message has them.
+	Optional bool
+	// Text is set for decimals carried by a string rather than a double.
+	Text bool
+	// ZeroNull is set for enums whose unspecified value is stored as NULL.
+	ZeroNull bool
+	// Oneof names the oneof the field is a member of, and Elif is set for
+	// members after its first, so that to_proto sets one member only.
+	Oneof string
+	Elif  bool
+}
+
+// Guard returns the statement under which to_proto sets a singular field
+// of instance. Members of a oneof also count as unset when blank, the value
+// from_proto leaves the string members the message did not choose.
+func (f ConvertedField) Guard() string {
+	cond := "instance." + f.Name + " is not None"
+	switch {
+	case f.Kind == convertOne:
+		cond = "depth > 0 and instance." + f.Name + "_id is not None"
+	case f.Oneof != "":
+		cond = "instance." + f.Name + " not in (None, '', b'')"
+	}
+	if f.Elif {
+		return "elif " + cond
+	}
+	return "if " + cond
+}
+
+// Ref returns the Python expression reading the field of message.
+func (f ConvertedField) Ref() string {
+	if f.Keyword {
+		return "getattr(message, '" + f.ProtoName + "')"
+	}
+	return "message." + f.ProtoName
+}
+
+// converters renders the converters of every model of data generated from a
+// proto message in file, along with the imports they need: the
+// protoc-generated modules in pkg and the google.type and google.protobuf
+// modules of well-known values. Relations are followed to models that have converters
+// themselves; other relations and lists of well-known values are left out.
+func converters(file *ProtoFile, data TemplateData, pkg string) ([]RenderedConverter, []string) {
+	modules := map[string]string{}
+	classes := map[string]string{}
+	for _, msg := range file.Messages {
+		modules[msg.Name] = pbModule(msg.Source) + "_pb2"
+		classes[msg.Name] = pbClass(msg)
+	}
+	converted := map[string]string{}
+	for _, msg := range data.Messages {
+		if _, ok := modules[msg.ProtoName]; ok {
+			converted[msg.Name] = msg.SnakeName
+		}
+	}
+
+	var result []RenderedConverter
+	var imports []string
+	for _, msg := range data.Messages {
+		module, ok := modules[msg.ProtoName]
+		if !ok {
+			continue
+		}
+		conv := RenderedConverter{Model: msg.Name, SnakeName: msg.SnakeName, Message: module + "." + classes[msg.ProtoName]}
+		for _, f := range msg.Fields {
+			if f.Synthetic {
+				continue
+			}
+			field := ConvertedField{ProtoAttr: ProtoAttr{ProtoName: f.ProtoName, Name: f.Name, Repeated: f.Repeated}, Keyword: pythonKeywords[f.ProtoName], Optional: f.Optional, ZeroNull: f.ZeroNull, Oneof: f.Oneof}
+			switch {
+			case f.Type == dateType && !f.Repeated:
+				field.Kind = convertDate
+				imports = appendUnique(imports, "from google.type import date_pb2")
+			case f.Type == timestampType && !f.Repeated:
+				field.Kind = convertTime
+				imports = appendUnique(imports, "from django.conf import settings")
+				imports = appendUnique(imports, "from django.utils import timezone")
+				imports = appendUnique(imports, "from google.protobuf import timestamp_pb2")
+			case f.Type == moneyType && !f.Repeated:
+				field.Kind = convertMoney
+				imports = appendUnique(imports, "from google.type import money_pb2")
+			case f.Type == latLngType && !f.Repeated:
+				field.Kind = convertLatLng
+				field.Point = isPointField(f)
+				imports = appendUnique(imports, "from google.type import latlng_pb2")
+			case isDecimalField(f):
+				field.Kind = convertDecimal
+				field.Text = f.Type == "string"
+			case isScalar(f.Type):
+				if _, ok := wellKnownType(f.Type); ok {
+					continue
+				}
+				field.Kind = convertScalar
+			default:
+				target, ok := converted[modelClass(f.Type)]
+				if !ok || strings.Contains(f.Type, ".") {
+					continue
+				}
+				field.Target = target
+				field.Kind = convertOne
+				if strings.Contains(f.DjangoType, "ManyToManyField") {
+					field.Kind = convertMany
+				}
+			}
+			if n := len(conv.Fields); n > 0 && field.Oneof != "" {
+				field.Elif = conv.Fields[n-1].Oneof == field.Oneof
+			}
+			conv.Fields = append(conv.Fields, field)
+		}
+		result = append(result, conv)
+		imports = appendUnique(imports, pbModuleImport(pkg, module))
+	}
+	sort.Strings(imports)
+	return result, imports
+}
+
+// convertsDecimals reports whether any of convs converts a DecimalField.
+func convertsDecimals(convs []RenderedConverter) bool {
+	for _, conv := range convs {
+		for _, f := range conv.Fields {
+			if f.Kind == convertDecimal {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasImport reports whether imports imports module.
+func hasImport(imports []string, module string) bool {
+	for _, imp := range imports {
+		if strings.HasSuffix(imp, " "+module) {
+			return true
+		}
+	}
+	return false
+}
+
+const convertersTemplate = `{{ if .Typed }}from __future__ import annotations
+
+{{ end }}{{ if or (HasImport .ConverterImports "date_pb2") (HasImport .ConverterImports "timestamp_pb2") }}import datetime
+{{ end }}{{ if or (HasImport .ConverterImports "money_pb2") .ConvertsDecimals }}import decimal
+{{ end }}{{ if and .Typed (or (HasImport .ConverterImports "money_pb2") (HasImport .ConverterImports "latlng_pb2")) }}from typing import Any
+{{ end }}
+{{- range .ConverterImports }}
+{{ . }}
+{{- end }}
+
+from . import models
+{{- if HasImport .ConverterImports "date_pb2" }}
+
+
+def date_to_proto(value{{ if .Typed }}: datetime.date{{ end }}){{ if .Typed }} -> date_pb2.Date{{ end }}:
+    return date_pb2.Date(year=value.year, month=value.month, day=value.day)
+
+
+def date_from_proto(message{{ if .Typed }}: date_pb2.Date{{ end }}){{ if .Typed }} -> datetime.date{{ end }}:
+    return datetime.date(message.year, message.month, message.day)
+{{- end }}
+{{- if HasImport .ConverterImports "timestamp_pb2" }}
+
+
+def timestamp_to_proto(value{{ if .Typed }}: datetime.datetime{{ end }}){{ if .Typed }} -> timestamp_pb2.Timestamp{{ end }}:
+    """Converts a datetime to a Timestamp. Naive datetimes, stored when
+    USE_TZ is off, are in the default time zone."""
+    if timezone.is_naive(value):
+        value = timezone.make_aware(value, timezone.get_default_timezone())
+    message = timestamp_pb2.Timestamp()
+    message.FromDatetime(value.astimezone(datetime.timezone.utc).replace(tzinfo=None))
+    return message
+
+
+def timestamp_from_proto(message{{ if .Typed }}: timestamp_pb2.Timestamp{{ end }}){{ if .Typed }} -> datetime.datetime{{ end }}:
+    """Returns the datetime of a Timestamp: aware in UTC under USE_TZ, and
+    naive in the default time zone otherwise."""
+    value = message.ToDatetime().replace(tzinfo=datetime.timezone.utc)
+    if settings.USE_TZ:
+        return value
+    return timezone.make_naive(value, timezone.get_default_timezone())
+{{- end }}
+{{- if HasImport .ConverterImports "money_pb2" }}
+
+
+def money_to_proto(amount{{ if .Typed }}: Any{{ end }}, currency{{ if .Typed }}: Any{{ end }}){{ if .Typed }} -> money_pb2.Money{{ end }}:
+    """Converts a decimal amount, or a django-money Money, to a Money."""
+    amount = decimal.Decimal(getattr(amount, 'amount', amount))
+    units = int(amount)
+    nanos = int((amount - units) * 10**9)
+    return money_pb2.Money(currency_code=str(currency or ''), units=units, nanos=nanos)
+
+
+def money_from_proto(message{{ if .Typed }}: money_pb2.Money{{ end }}){{ if .Typed }} -> tuple[decimal.Decimal, str]{{ end }}:
+    """Returns the decimal amount and currency code of a Money."""
+    return decimal.Decimal(message.units) + decimal.Decimal(message.nanos) / 10**9, message.currency_code
+{{- end }}
+{{- if HasImport .ConverterImports "latlng_pb2" }}
+
+
+def latlng_to_proto(value{{ if .Typed }}: Any{{ end }}){{ if .Typed }} -> latlng_pb2.LatLng{{ end }}:
+    """Converts a {'latitude', 'longitude'} dict or a GeoDjango Point to a LatLng."""
+    if hasattr(value, 'x'):
+        return latlng_pb2.LatLng(latitude=value.y, longitude=value.x)
+    return latlng_pb2.LatLng(latitude=value['latitude'], longitude=value['longitude'])
+
+
+{{ if .Typed -}}
+def latlng_from_proto(message: latlng_pb2.LatLng, point: bool = False) -> Any:
+{{- else -}}
+def latlng_from_proto(message, point=False):
+{{- end }}
+    if point:
+        from django.contrib.gis.geos import Point
+
+        return Point(message.longitude, message.latitude, srid=4326)
+    return {'latitude': message.latitude, 'longitude': message.longitude}
+{{- end }}
+{{ range .Converters }}
+
+{{ if $.Typed -}}
+def {{ .SnakeName }}_to_proto(instance: models.{{ .Model }}, depth: int = 1) -> {{ .Message }}:
+{{- else -}}
+def {{ .SnakeName }}_to_proto(instance, depth=1):
+{{- end }}
+    """Converts the {{ .Model }} instance to a {{ .Message }}, following
+    relations depth levels deep."""
+    message = {{ .Message }}()
+{{- range .Fields }}
+{{- if eq .Kind "scalar" }}
+{{- if .Repeated }}
+    {{ .Ref }}.extend(instance.{{ .Name }} or [])
+{{- else }}
+    {{ .Guard }}:
+        {{ if .Keyword }}setattr(message, '{{ .ProtoName }}', instance.{{ .Name }}){{ else }}message.{{ .ProtoName }} = instance.{{ .Name }}{{ end }}
+{{- end }}
+{{- else if eq .Kind "decimal" }}
+    {{ .Guard }}:
+        {{ if .Keyword }}setattr(message, '{{ .ProtoName }}', {{ if .Text }}str{{ else }}float{{ end }}(instance.{{ .Name }})){{ else }}message.{{ .ProtoName }} = {{ if .Text }}str{{ else }}float{{ end }}(instance.{{ .Name }}){{ end }}
+{{- else if eq .Kind "date" }}
+    {{ .Guard }}:
+        {{ .Ref }}.CopyFrom(date_to_proto(instance.{{ .Name }}))
+{{- else if eq .Kind "timestamp" }}
+    {{ .Guard }}:
+        {{ .Ref }}.CopyFrom(timestamp_to_proto(instance.{{ .Name }}))
+{{- else if eq .Kind "money" }}
+    {{ .Guard }}:
+        {{ .Ref }}.CopyFrom(money_to_proto(instance.{{ .Name }}, instance.{{ .Name }}_currency))
+{{- else if eq .Kind "latlng" }}
+    {{ .Guard }}:
+        {{ .Ref }}.CopyFrom(latlng_to_proto(instance.{{ .Name }}))
+{{- else if eq .Kind "one" }}
+    {{ .Guard }}:
+        {{ .Ref }}.CopyFrom({{ .Target }}_to_proto(instance.{{ .Name }}, depth - 1))
+{{- else if eq .Kind "many" }}
+    if depth > 0 and instance.pk is not None:
+        {{ .Ref }}.extend({{ .Target }}_to_proto(related, depth - 1) for related in instance.{{ .Name }}.all())
+{{- end }}
+{{- end }}
+    return message
+
+
+{{ if $.Typed -}}
+def {{ .SnakeName }}_from_proto(message: {{ .Message }}, save: bool = False) -> models.{{ .Model }}:
+{{- else -}}
+def {{ .SnakeName }}_from_proto(message, save=False):
+{{- end }}
+    """Builds the {{ .Model }} of a {{ .Message }}. With save, the instance is
+    saved along with the related rows and many-to-many links of the message."""
+    instance = models.{{ .Model }}()
+{{- range .Fields }}
+{{- if and .Oneof (or (eq .Kind "scalar") (eq .Kind "decimal")) }}
+    if message.HasField('{{ .ProtoName }}'):
+        instance.{{ .Name }} = {{ if eq .Kind "decimal" }}{{ if .Text }}decimal.Decimal({{ .Ref }} or '0'){{ else }}decimal.Decimal(str({{ .Ref }})){{ end }}{{ else }}{{ .Ref }}{{ if .ZeroNull }} or None{{ end }}{{ end }}
+{{- else if eq .Kind "scalar" }}
+    instance.{{ .Name }} = {{ if .Repeated }}list({{ .Ref }}){{ else }}{{ .Ref }}{{ if .ZeroNull }} or None{{ end }}{{ end }}{{ if .Optional }} if message.HasField('{{ .ProtoName }}') else None{{ end }}
+{{- else if eq .Kind "decimal" }}
+{{- if .Text }}
+    instance.{{ .Name }} = decimal.Decimal({{ .Ref }} or '0'){{ if .Optional }} if message.HasField('{{ .ProtoName }}') else None{{ end }}
+{{- else }}
+    instance.{{ .Name }} = decimal.Decimal(str({{ .Ref }})){{ if .Optional }} if message.HasField('{{ .ProtoName }}') else None{{ end }}
+{{- end }}
+{{- else if eq .Kind "date" }}
+    if message.HasField('{{ .ProtoName }}'):
+        instance.{{ .Name }} = date_from_proto({{ .Ref }})
+{{- else if eq .Kind "timestamp" }}
+    if message.HasField('{{ .ProtoName }}'):
+        instance.{{ .Name }} = timestamp_from_proto({{ .Ref }})
+{{- else if eq .Kind "money" }}
+    if message.HasField('{{ .ProtoName }}'):
+        instance.{{ .Name }}, instance.{{ .Name }}_currency = money_from_proto({{ .Ref }})
+{{- else if eq .Kind "latlng" }}
+    if message.HasField('{{ .ProtoName }}'):
+        instance.{{ .Name }} = latlng_from_proto({{ .Ref }}{{ if .Point }}, point=True{{ end }})
+{{- else if eq .Kind "one" }}
+    if message.HasField('{{ .ProtoName }}'):
+        instance.{{ .Name }} = {{ .Target }}_from_proto({{ .Ref }}, save=save)
+{{- end }}
+{{- end }}
+    if save:
+        instance.save()
+{{- range .Fields }}
+{{- if eq .Kind "many" }}
+        instance.{{ .Name }}.set([{{ .Target }}_from_proto(related, save=True) for related in {{ .Ref }}])
+{{- end }}
+{{- end }}
+    return instance
+{{ end }}`
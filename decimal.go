@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Field options storing a double, float or string field as a DecimalField,
+// e.g. [(django.field).max_digits = 12, (django.field).decimal_places = 4].
+// Either one is enough; the other defaults to DefaultMaxDigits or
+// DefaultDecimalPlaces.
+const (
+	maxDigitsOption     = fieldOption + ".max_digits"
+	decimalPlacesOption = fieldOption + ".decimal_places"
+)
+
+// Precision of DecimalFields whose options leave it out, that of
+// google.type.Money amounts.
+const (
+	DefaultMaxDigits     = 19
+	DefaultDecimalPlaces = 2
+)
+
+// decimalArgsRe matches the precision of a DecimalField declaration.
+var decimalArgsRe = regexp.MustCompile(`max_digits=\d+, decimal_places=\d+`)
+
+// decimalField returns the DecimalField the singular double, float or
+// string field f is stored as: when it has a max_digits or decimal_places
+// option or, under -decimal-heuristics, when it is named like an amount or a
+// price. ok is false for fields that stay as they are; invalid options are
+// reported.
+func decimalField(f ProtoField, opts Options) (djangoType string, ok bool, err error) {
+	digits, hasDigits := f.Options[maxDigitsOption]
+	places, hasPlaces := f.Options[decimalPlacesOption]
+	switch f.Type {
+	case "double", "float", "string":
+	default:
+		if hasDigits || hasPlaces {
+			return "", false, fmt.Errorf("%s fields cannot be decimals", f.Type)
+		}
+		return "", false, nil
+	}
+	if !hasDigits && !hasPlaces {
+		name := snakeCase(f.Name)
+		if !opts.DecimalHeuristics || f.Repeated || !(name == "amount" || name == "price" ||
+			strings.HasSuffix(name, "_amount") || strings.HasSuffix(name, "_price")) {
+			return "", false, nil
+		}
+	}
+	if f.Repeated {
+		return "", false, fmt.Errorf("repeated fields cannot be decimals")
+	}
+
+	maxDigits, decimalPlaces := DefaultMaxDigits, DefaultDecimalPlaces
+	if hasDigits {
+		if maxDigits, err = strconv.Atoi(digits); err != nil || maxDigits < 1 {
+			return "", false, fmt.Errorf("invalid max_digits %q", digits)
+		}
+	}
+	if hasPlaces {
+		if decimalPlaces, err = strconv.Atoi(places); err != nil || decimalPlaces < 0 {
+			return "", false, fmt.Errorf("invalid decimal_places %q", places)
+		}
+	}
+	if decimalPlaces > maxDigits {
+		return "", false, fmt.Errorf("decimal_places %d exceeds max_digits %d", decimalPlaces, maxDigits)
+	}
+	return fmt.Sprintf("models.DecimalField(max_digits=%d, decimal_places=%d)", maxDigits, decimalPlaces), true, nil
+}
+
+// isDecimalField reports whether the scalar field f is stored as a
+// DecimalField by decimalField.
+func isDecimalField(f RenderedField) bool {
+	return f.Type != moneyType && !f.Repeated && strings.HasPrefix(f.DjangoType, "models.DecimalField(")
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// fieldOption is the prefix of the generator's own field options, such as
+// [(django.field).default = "draft"].
+const fieldOption = "django.field"
+
+// fieldDefault returns the declared default of f: the (django.field).default
+// option, or the proto2-style [default = ...] option.
+func fieldDefault(f ProtoField) (string, bool) {
+	if v, ok := f.Options[fieldOption+".default"]; ok {
+		return v, true
+	}
+	v, ok := f.Options["default"]
+	return v, ok
+}
+
+// pyDefault renders value as a Python literal suitable for the field type.
+func pyDefault(protoType, value string) (string, error) {
+	switch protoType {
+	case "bool":
+		switch value {
+		case "true":
+			return "True", nil
+		case "false":
+			return "False", nil
+		}
+		return "", fmt.Errorf("invalid bool default %q", value)
+	case "int32", "int64", "uint32", "uint64", "sint32", "sint64",
+		"fixed32", "fixed64", "sfixed32", "sfixed64":
+		// Rendered in decimal, since octal literals such as 010 are not Python.
+		if n, err := strconv.ParseInt(value, 0, 64); err == nil {
+			return strconv.FormatInt(n, 10), nil
+		}
+		n, err := strconv.ParseUint(value, 0, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid integer default %q", value)
+		}
+		return strconv.FormatUint(n, 10), nil
+	case "float", "double":
+		switch value {
+		case "inf":
+			return "float('inf')", nil
+		case "-inf":
+			return "float('-inf')", nil
+		case "nan":
+			return "float('nan')", nil
+		}
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return "", fmt.Errorf("invalid float default %q", value)
+		}
+		return value, nil
+	case "bytes":
+		return "b" + pyString(value), nil
+	case "string", dateType, timestampType, moneyType:
+		// Dates, timestamps and decimals are parsed from their string form by Django.
+		return pyString(value), nil
+	}
+	return "", fmt.Errorf("defaults are not supported for %s fields", protoType)
+}
+
+// relationDefault renders value, the primary key of a relation's default
+// row, as a Python literal: an integer, or a string such as a UUID.
+func relationDefault(value string) string {
+	if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return value
+	}
+	return pyString(value)
+}
+
+// withWriteDefault gives a field the API never writes, being output only or
+// omitted from the serializers, the proto3 zero value of its type as
+// default, or else makes it nullable, so that rows created through the API
+// satisfy its NOT NULL constraint.
+func withWriteDefault(djangoType, protoType string) string {
+	var zero string
+	switch protoType {
+	case "bool":
+		zero = "False"
+	case "int32", "int64", "uint32", "uint64", "sint32", "sint64",
+		"fixed32", "fixed64", "sfixed32", "sfixed64":
+		zero = "0"
+	case "float", "double":
+		zero = "0.0"
+	case "string":
+		zero = "''"
+	case "bytes":
+		zero = "b''"
+	}
+	if zero == "" || !strings.HasPrefix(djangoType, "models.") || strings.Contains(djangoType, "choices=") {
+		return withNullability(djangoType, true, true)
+	}
+	return addKwarg(djangoType, "default="+zero)
+}
@@ -0,0 +1,614 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Input formats of -format: .proto source, or a FileDescriptorSet as
+// written by protoc -o or buf build -o, whose buf image extensions are
+// understood too.
+const (
+	FormatProto      = "proto"
+	FormatDescriptor = "descriptor"
+)
+
+// parseInput parses the -proto input path, or stdin for -, in format.
+func parseInput(path, format string) ([]*ProtoFile, error) {
+	switch format {
+	case "", FormatProto:
+		file, err := ParseProto(path)
+		if err != nil {
+			return nil, err
+		}
+		return []*ProtoFile{file}, nil
+	case FormatDescriptor:
+		if path == stdinPath {
+			return parseDescriptorSet(os.Stdin, "stdin")
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read descriptor set: %w", err)
+		}
+		defer f.Close()
+		return parseDescriptorSet(f, path)
+	}
+	return nil, fmt.Errorf("unknown input format %q", format)
+}
+
+// checkStdin rejects inputs reading stdin more than once.
+func checkStdin(protoPaths []string) error {
+	n := 0
+	for _, path := range protoPaths {
+		if path == stdinPath {
+			n++
+		}
+	}
+	if n > 1 {
+		return fmt.Errorf("-proto - can only be given once, stdin is read once")
+	}
+	return nil
+}
+
+// wireField is a field of an encoded protobuf message: a varint, or the
+// bytes of a length-delimited value.
+type wireField struct {
+	num    int
+	varint uint64
+	bytes  []byte
+}
+
+// decodeWire splits the encoded message b into its fields. Fixed-size
+// values are skipped, since descriptors hold none the parser needs.
+func decodeWire(b []byte) ([]wireField, error) {
+	var fields []wireField
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errors.New("truncated field key")
+		}
+		b = b[n:]
+		f := wireField{num: int(key >> 3)}
+		switch key & 7 {
+		case 0:
+			if f.varint, n = binary.Uvarint(b); n <= 0 {
+				return nil, errors.New("truncated varint")
+			}
+			b = b[n:]
+		case 1, 5:
+			size := 8
+			if key&7 == 5 {
+				size = 4
+			}
+			if len(b) < size {
+				return nil, errors.New("truncated fixed-size value")
+			}
+			b = b[size:]
+			continue
+		case 2:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < size {
+				return nil, errors.New("truncated length-delimited value")
+			}
+			f.bytes = b[n : n+int(size)]
+			b = b[n+int(size):]
+		default:
+			return nil, fmt.Errorf("unsupported wire type %d", key&7)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// descriptorScalars maps FieldDescriptorProto types to the scalar types of
+// the .proto language.
+var descriptorScalars = map[uint64]string{
+	1: "double", 2: "float", 3: "int64", 4: "uint64", 5: "int32",
+	6: "fixed64", 7: "fixed32", 8: "bool", 9: "string", 12: "bytes",
+	13: "uint32", 15: "sfixed32", 16: "sfixed64", 17: "sint32", 18: "sint64",
+}
+
+// Field types of FieldDescriptorProto referring to other declarations.
+const (
+	descriptorGroup   = 10
+	descriptorMessage = 11
+	descriptorEnum    = 14
+)
+
+// descriptorReader turns the FileDescriptorProtos of a set into ProtoFiles.
+type descriptorReader struct {
+	// flat maps the full names of nested messages to the names the .proto
+	// parser gives them, which drop the enclosing messages.
+	flat map[string]string
+	// custom is set once options of custom extensions have been skipped.
+	custom bool
+	// comments and spans are those of the file being read, keyed by the
+	// path of their declaration.
+	comments map[string]string
+	spans    map[string][2]int
+}
+
+// parseDescriptorSet parses the FileDescriptorSet read from r, named name,
+// into a ProtoFile per file of the set. The files of imports a set may
+// include, well-known types and option definitions, are left out. Custom
+// options, such as (django.field), are extensions the set does not
+// describe and are not read.
+func parseDescriptorSet(r io.Reader, name string) ([]*ProtoFile, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	set, err := decodeWire(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: not a FileDescriptorSet: %w", name, err)
+	}
+	d := &descriptorReader{flat: map[string]string{}}
+	var decoded [][]wireField
+	var encoded [][]byte
+	for _, f := range set {
+		if f.num != 1 {
+			continue
+		}
+		file, err := decodeWire(f.bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid FileDescriptorProto: %w", name, err)
+		}
+		decoded = append(decoded, file)
+		encoded = append(encoded, f.bytes)
+		pkg := wireString(file, 2)
+		for _, m := range file {
+			if m.num == 4 {
+				d.flatten("."+pkg, pkg, m.bytes)
+			}
+		}
+	}
+	if len(decoded) == 0 {
+		return nil, fmt.Errorf("%s: FileDescriptorSet has no files", name)
+	}
+
+	var files []*ProtoFile
+	for i, file := range decoded {
+		source, pkg := wireString(file, 1), wireString(file, 2)
+		if descriptorImport(file) {
+			slog.Debug("imported file of the descriptor set skipped", "file", source, "package", pkg)
+			continue
+		}
+		hash := sha256.Sum256(encoded[i])
+		pf := &ProtoFile{
+			Sources:    []string{source},
+			SourceHash: hex.EncodeToString(hash[:]),
+			Syntax:     wireString(file, 12),
+			Package:    pkg,
+		}
+		d.readSourceInfo(file)
+		n := map[int]int{}
+		for _, f := range file {
+			path := strconv.Itoa(f.num) + "." + strconv.Itoa(n[f.num])
+			n[f.num]++
+			switch f.num {
+			case 4:
+				d.message(pf, f.bytes, path, "")
+			case 5:
+				d.enum(pf, f.bytes, path)
+			case 6:
+				d.service(pf, f.bytes, path)
+			case 8:
+				d.options(f.bytes, nil)
+			}
+		}
+		files = append(files, pf)
+	}
+	if d.custom {
+		slog.Warn("custom options are not read from descriptor sets; generate from the .proto sources to apply them", "input", name)
+	}
+	return files, nil
+}
+
+// descriptorImport reports whether file is a dependency rather than a file
+// to generate: marked so by a buf image, or declaring well-known types or
+// only option extensions.
+func descriptorImport(file []wireField) bool {
+	pkg := wireString(file, 2)
+	if strings.HasPrefix(pkg, "google.") || strings.HasPrefix(pkg, "buf.") {
+		return true
+	}
+	extends := false
+	for _, f := range file {
+		switch f.num {
+		case 4, 6:
+			return false
+		case 7:
+			extends = true
+		case 8042:
+			ext, _ := decodeWire(f.bytes)
+			if wireVarint(ext, 1) != 0 {
+				return true
+			}
+		}
+	}
+	return extends
+}
+
+// flatten records the flattened names of the messages nested in the
+// message b declared in scope.
+func (d *descriptorReader) flatten(scope, pkg string, b []byte) {
+	msg, _ := decodeWire(b)
+	full := scope + "." + wireString(msg, 1)
+	if scope != "."+pkg {
+		d.flat[full] = "." + qualifiedName(pkg, wireString(msg, 1))
+	}
+	for _, f := range msg {
+		if f.num == 3 {
+			d.flatten(full, pkg, f.bytes)
+		}
+	}
+}
+
+// readSourceInfo indexes the leading comments and positions of file's
+// SourceCodeInfo by declaration path.
+func (d *descriptorReader) readSourceInfo(file []wireField) {
+	d.comments, d.spans = map[string]string{}, map[string][2]int{}
+	info, _ := decodeWire(wireBytes(file, 9))
+	for _, l := range info {
+		if l.num != 1 {
+			continue
+		}
+		loc, _ := decodeWire(l.bytes)
+		path := strings.Join(intStrings(packedVarints(loc, 1)), ".")
+		if span := packedVarints(loc, 2); len(span) >= 2 {
+			if _, ok := d.spans[path]; !ok {
+				d.spans[path] = [2]int{int(span[0]) + 1, int(span[1]) + 1}
+			}
+		}
+		if comment := wireString(loc, 3); comment != "" {
+			var lines []string
+			for _, line := range strings.Split(strings.TrimRight(comment, "\n"), "\n") {
+				lines = append(lines, strings.TrimSpace(line))
+			}
+			d.comments[path] = strings.Join(lines, "\n")
+		}
+	}
+}
+
+// typeName returns the type of a field referencing the declaration name.
+func (d *descriptorReader) typeName(name string) string {
+	if flat, ok := d.flat[name]; ok {
+		name = flat
+	}
+	if isWellKnownPackage(name) {
+		return strings.TrimPrefix(name, ".")
+	}
+	return name
+}
+
+// message adds the message b, declared at path within the messages
+// enclosing, and the messages and enums nested in it to pf.
+func (d *descriptorReader) message(pf *ProtoFile, b []byte, path, enclosing string) {
+	fields, _ := decodeWire(b)
+	span := d.spans[path]
+	msg := ProtoMessage{
+		Name:      wireString(fields, 1),
+		Comment:   d.comments[path],
+		Options:   map[string]string{},
+		Source:    pf.Sources[0],
+		Line:      span[0],
+		Column:    span[1],
+		Enclosing: enclosing,
+	}
+	if options := wireBytes(fields, 7); options != nil && d.options(options, msg.Options) {
+		// A map field's entry message is part of the field, not a model.
+		return
+	}
+	var oneofs []string
+	for _, f := range fields {
+		if f.num == 8 {
+			decl, _ := decodeWire(f.bytes)
+			oneofs = append(oneofs, wireString(decl, 1))
+		}
+	}
+	groups := map[string]bool{}
+	for _, f := range fields {
+		if f.num == 2 {
+			field, _ := decodeWire(f.bytes)
+			if wireVarint(field, 5) == descriptorGroup {
+				groups[d.typeName(wireString(field, 6))] = true
+			}
+		}
+	}
+	entries := map[string][2]string{}
+	for _, f := range fields {
+		if f.num != 3 {
+			continue
+		}
+		nested, _ := decodeWire(f.bytes)
+		opts, _ := decodeWire(wireBytes(nested, 7))
+		if wireVarint(opts, 7) == 0 {
+			continue
+		}
+		var key, value string
+		for _, e := range nested {
+			if e.num == 2 {
+				entry, _ := decodeWire(e.bytes)
+				typ := descriptorScalars[wireVarint(entry, 5)]
+				if typ == "" {
+					typ = strings.TrimPrefix(d.typeName(wireString(entry, 6)), ".")
+				}
+				if wireString(entry, 1) == "key" {
+					key = typ
+				} else {
+					value = typ
+				}
+			}
+		}
+		entries["."+wireString(nested, 1)] = [2]string{key, value}
+	}
+
+	// Nested declarations follow the message, as the .proto parser finds
+	// them after it.
+	var nested []func()
+	n := map[int]int{}
+	for _, f := range fields {
+		index := n[f.num]
+		n[f.num]++
+		switch f.num {
+		case 2:
+			field := d.field(pf, f.bytes, path+".2."+strconv.Itoa(index))
+			// proto3 optional fields sit in a synthetic oneof of their own.
+			if decl, _ := decodeWire(f.bytes); hasWire(decl, 9) && wireVarint(decl, 17) == 0 {
+				if i := int(wireVarint(decl, 9)); i < len(oneofs) {
+					field.Oneof = oneofs[i]
+				}
+			}
+			name := field.Type[strings.LastIndex(field.Type, ".")+1:]
+			switch {
+			case field.Label == "group":
+				field.Label = ""
+				field.Type = name
+				msg.Groups = append(msg.Groups, field)
+			case field.Repeated && entries["."+name] != [2]string{}:
+				entry := entries["."+name]
+				field.Type = "map<" + entry[0] + ", " + entry[1] + ">"
+				field.Repeated, field.Options = false, nil
+				msg.MapFields = append(msg.MapFields, field)
+			default:
+				msg.Fields = append(msg.Fields, field)
+			}
+		case 3:
+			decl, _ := decodeWire(f.bytes)
+			opts, _ := decodeWire(wireBytes(decl, 7))
+			if wireVarint(opts, 7) == 0 && !groups["."+qualifiedName(pf.Package, wireString(decl, 1))] {
+				b, path := f.bytes, path+".3."+strconv.Itoa(index)
+				nested = append(nested, func() { d.message(pf, b, path, pbClass(msg)) })
+			}
+		case 4:
+			b, path := f.bytes, path+".4."+strconv.Itoa(index)
+			nested = append(nested, func() { d.enum(pf, b, path) })
+		case 9:
+			r, _ := decodeWire(f.bytes)
+			start, end := wireVarint(r, 1), wireVarint(r, 2)-1
+			if start == end {
+				msg.Reserved = append(msg.Reserved, strconv.FormatUint(start, 10))
+			} else {
+				msg.Reserved = append(msg.Reserved, fmt.Sprintf("%d to %d", start, end))
+			}
+		case 10:
+			msg.Reserved = append(msg.Reserved, string(f.bytes))
+		}
+	}
+	if len(msg.Options) == 0 {
+		msg.Options = nil
+	}
+	pf.Messages = append(pf.Messages, msg)
+	for _, add := range nested {
+		add()
+	}
+}
+
+// field returns the field b declared at path.
+func (d *descriptorReader) field(pf *ProtoFile, b []byte, path string) ProtoField {
+	fields, _ := decodeWire(b)
+	span := d.spans[path]
+	f := ProtoField{
+		Name:    wireString(fields, 1),
+		Number:  int(wireVarint(fields, 3)),
+		Comment: d.comments[path],
+		Line:    span[0],
+		Column:  span[1],
+		Options: map[string]string{},
+	}
+	switch typ := wireVarint(fields, 5); typ {
+	case descriptorGroup:
+		f.Type, f.Label = d.typeName(wireString(fields, 6)), "group"
+	case descriptorMessage, descriptorEnum:
+		f.Type = d.typeName(wireString(fields, 6))
+	default:
+		f.Type = descriptorScalars[typ]
+	}
+	switch label := wireVarint(fields, 4); {
+	case label == 3:
+		f.Repeated = true
+	case label == 2:
+		f.Label = LabelRequired
+	case f.Label == "group":
+	case pf.Syntax != "proto3" || wireVarint(fields, 17) != 0:
+		f.Label = LabelOptional
+	}
+	if json := wireString(fields, 10); json != "" && json != jsonName(ProtoField{Name: f.Name}) {
+		f.Options["json_name"] = json
+	}
+	if value := wireString(fields, 7); hasWire(fields, 7) {
+		if f.Type == "string" || f.Type == "bytes" {
+			value = strconv.Quote(value)
+		}
+		f.Options["default"] = value
+	}
+	if options := wireBytes(fields, 8); options != nil {
+		d.options(options, f.Options)
+	}
+	if len(f.Options) == 0 {
+		f.Options = nil
+	}
+	return f
+}
+
+// enum adds the enum b, declared at path, to pf.
+func (d *descriptorReader) enum(pf *ProtoFile, b []byte, path string) {
+	fields, _ := decodeWire(b)
+	span := d.spans[path]
+	e := ProtoEnum{
+		Name:    wireString(fields, 1),
+		Comment: d.comments[path],
+		Source:  pf.Sources[0],
+		Line:    span[0],
+		Column:  span[1],
+	}
+	for _, f := range fields {
+		if f.num != 2 {
+			continue
+		}
+		v, _ := decodeWire(f.bytes)
+		e.Values = append(e.Values, ProtoEnumValue{Name: wireString(v, 1), Number: int(int32(wireVarint(v, 2)))})
+		if options := wireBytes(v, 3); options != nil {
+			d.options(options, nil)
+		}
+	}
+	pf.Enums = append(pf.Enums, e)
+}
+
+// service adds the service b, declared at path, to pf.
+func (d *descriptorReader) service(pf *ProtoFile, b []byte, path string) {
+	fields, _ := decodeWire(b)
+	svc := ProtoService{
+		Name:    wireString(fields, 1),
+		Comment: d.comments[path],
+		Options: map[string]string{},
+		Source:  pf.Sources[0],
+	}
+	if options := wireBytes(fields, 3); options != nil {
+		d.options(options, svc.Options)
+	}
+	n := 0
+	for _, f := range fields {
+		if f.num != 2 {
+			continue
+		}
+		m, _ := decodeWire(f.bytes)
+		method := ProtoMethod{
+			Name:            wireString(m, 1),
+			Comment:         d.comments[path+".2."+strconv.Itoa(n)],
+			InputType:       d.typeName(wireString(m, 2)),
+			OutputType:      d.typeName(wireString(m, 3)),
+			ClientStreaming: wireVarint(m, 5) != 0,
+			ServerStreaming: wireVarint(m, 6) != 0,
+		}
+		if options := wireBytes(m, 4); options != nil {
+			method.Options = map[string]string{}
+			d.options(options, method.Options)
+			if len(method.Options) == 0 {
+				method.Options = nil
+			}
+		}
+		svc.Methods = append(svc.Methods, method)
+		n++
+	}
+	if len(svc.Options) == 0 {
+		svc.Options = nil
+	}
+	pf.Services = append(pf.Services, svc)
+}
+
+// options reads the built-in deprecated option of the encoded options b
+// into into, when given, and notes custom options, which are extensions
+// numbered from 1000. It reports whether b marks a map entry.
+func (d *descriptorReader) options(b []byte, into map[string]string) (mapEntry bool) {
+	fields, _ := decodeWire(b)
+	for _, f := range fields {
+		switch {
+		case f.num >= 1000:
+			d.custom = true
+		case f.num == 3 && into != nil && f.varint != 0:
+			into["deprecated"] = "true"
+		case f.num == 7 && f.varint != 0:
+			mapEntry = true
+		}
+	}
+	return mapEntry
+}
+
+// hasWire reports whether fields has a field numbered num.
+func hasWire(fields []wireField, num int) bool {
+	for _, f := range fields {
+		if f.num == num {
+			return true
+		}
+	}
+	return false
+}
+
+// wireBytes returns the last value of the length-delimited field num.
+func wireBytes(fields []wireField, num int) []byte {
+	var b []byte
+	for _, f := range fields {
+		if f.num == num {
+			b = f.bytes
+		}
+	}
+	return b
+}
+
+// wireString returns the last value of the string field num.
+func wireString(fields []wireField, num int) string {
+	return string(wireBytes(fields, num))
+}
+
+// wireVarint returns the last value of the varint field num.
+func wireVarint(fields []wireField, num int) uint64 {
+	var v uint64
+	for _, f := range fields {
+		if f.num == num {
+			v = f.varint
+		}
+	}
+	return v
+}
+
+// packedVarints returns the values of the repeated varint field num,
+// packed or not.
+func packedVarints(fields []wireField, num int) []uint64 {
+	var values []uint64
+	for _, f := range fields {
+		if f.num != num {
+			continue
+		}
+		if f.bytes == nil {
+			values = append(values, f.varint)
+			continue
+		}
+		for b := f.bytes; len(b) > 0; {
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				break
+			}
+			values = append(values, v)
+			b = b[n:]
+		}
+	}
+	return values
+}
+
+// intStrings formats values in decimal.
+func intStrings(values []uint64) []string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = strconv.FormatUint(v, 10)
+	}
+	return s
+}
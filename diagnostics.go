@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Exit codes of the CLI. Parse, validation and I/O failures get codes of
+// their own so that scripts can tell a broken proto from a broken disk.
+const (
+	ExitFailure    = 1
+	ExitUsage      = 2
+	ExitParse      = 3
+	ExitValidation = 4
+	ExitIO         = 5
+)
+
+// Error formats.
+const (
+	ErrorFormatText = "text"
+	ErrorFormatJSON = "json"
+)
+
+// Diagnostic codes. The prefix is the failure's category: P for parse
+// errors, V for validation failures and IO for reading and writing files.
+const (
+	CodeUnclosedBlock   = "P001"
+	CodeUnexpectedBrace = "P002"
+	CodeUnclosedString  = "P003"
+	CodeUnclosedComment = "P004"
+	CodeUndefinedType   = "V001"
+	CodeDuplicateNumber = "V002"
+	CodeDuplicateField  = "V003"
+	CodeInvalidAppName  = "V004"
+	CodeReservedName    = "V005"
+	CodeModelAttribute  = "V006"
+	CodeUnsupportedType = "V007"
+	CodeEmptyMessage    = "V008"
+	CodeDuplicateModel  = "V009"
+	CodeLookupSeparator = "V010"
+	CodeInvalidLabel    = "V011"
+	CodeReservedField   = "V012"
+	CodeNameConflict    = "V013"
+	CodeIO              = "IO001"
+	CodeOther           = "E001"
+)
+
+// Diagnostic is an error at a position of a .proto source. File and the
+// 1-based Line and Column are empty when the error has no position.
+type Diagnostic struct {
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Severity is SeverityWarning for findings the generator works around,
+	// which do not fail; it is empty for errors.
+	Severity string `json:"severity,omitempty"`
+}
+
+// SeverityWarning marks a Diagnostic that is reported without failing.
+const SeverityWarning = "warning"
+
+// errorAt returns a Diagnostic with code at file:line:column.
+func errorAt(code, file string, line, column int, format string, args ...any) *Diagnostic {
+	return &Diagnostic{File: file, Line: line, Column: column, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// warningAt returns a warning Diagnostic with code at file:line:column.
+func warningAt(code, file string, line, column int, format string, args ...any) *Diagnostic {
+	d := errorAt(code, file, line, column, format, args...)
+	d.Severity = SeverityWarning
+	return d
+}
+
+// Pos formats the diagnostic's position as file:line:column.
+func (d *Diagnostic) Pos() string {
+	switch {
+	case d.File == "":
+		return ""
+	case d.Line == 0:
+		return d.File
+	case d.Column == 0:
+		return fmt.Sprintf("%s:%d", d.File, d.Line)
+	}
+	return fmt.Sprintf("%s:%d:%d", d.File, d.Line, d.Column)
+}
+
+func (d *Diagnostic) Error() string {
+	if pos := d.Pos(); pos != "" {
+		return fmt.Sprintf("%s: %s [%s]", pos, d.Message, d.Code)
+	}
+	return fmt.Sprintf("%s [%s]", d.Message, d.Code)
+}
+
+// diagnostics flattens err, which may join several errors, into diagnostics.
+// Errors without a position are classified by their cause.
+func diagnostics(err error) []Diagnostic {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var diags []Diagnostic
+		for _, e := range joined.Unwrap() {
+			diags = append(diags, diagnostics(e)...)
+		}
+		return diags
+	}
+	var d *Diagnostic
+	if errors.As(err, &d) {
+		return []Diagnostic{*d}
+	}
+	code := CodeOther
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		code = CodeIO
+	}
+	return []Diagnostic{{Code: code, Message: err.Error()}}
+}
+
+// exitCode returns the exit code of the most severe category among diags:
+// parse errors, then validation failures, then I/O errors. Warnings alone
+// exit 0.
+func exitCode(diags []Diagnostic) int {
+	code := 0
+	for _, d := range diags {
+		switch {
+		case d.Severity == SeverityWarning:
+		case strings.HasPrefix(d.Code, "P"):
+			return ExitParse
+		case strings.HasPrefix(d.Code, "V"):
+			code = ExitValidation
+		case strings.HasPrefix(d.Code, "IO") && code != ExitValidation:
+			code = ExitIO
+		case code == 0:
+			code = ExitFailure
+		}
+	}
+	return code
+}
+
+// reportError reports err in format, logging it in text or writing a JSON
+// object per diagnostic to w, and returns the exit code it calls for.
+func reportError(w io.Writer, err error, format string) int {
+	diags := diagnostics(err)
+	for _, d := range diags {
+		if format == ErrorFormatJSON {
+			json.NewEncoder(w).Encode(d)
+			continue
+		}
+		if d.Code == CodeOther {
+			slog.Error(d.Message)
+			continue
+		}
+		args := []any{"code", d.Code}
+		if pos := d.Pos(); pos != "" {
+			args = append([]any{"pos", pos}, args...)
+		}
+		if d.Severity == SeverityWarning {
+			slog.Warn(d.Message, args...)
+			continue
+		}
+		slog.Error(d.Message, args...)
+	}
+	return exitCode(diags)
+}
+
+// validateProto checks file for the mistakes protoc rejects that the parser
+// lets through: messages reusing a field number or a field name, fields
+// using a reserved number or name, and required fields outside proto2.
+func validateProto(file *ProtoFile) error {
+	var errs []error
+	for _, msg := range file.Messages {
+		numbers := map[int]string{}
+		names := map[string]bool{}
+		for _, f := range msg.Fields {
+			if other, ok := numbers[f.Number]; ok {
+				errs = append(errs, errorAt(CodeDuplicateNumber, msg.Source, f.Line, f.Column,
+					"%s.%s reuses field number %d of %s", msg.Name, f.Name, f.Number, other))
+			}
+			if names[f.Name] {
+				errs = append(errs, errorAt(CodeDuplicateField, msg.Source, f.Line, f.Column,
+					"%s declares field %s more than once", msg.Name, f.Name))
+			}
+			if r, ok := reservedBy(msg.Reserved, f); ok {
+				errs = append(errs, errorAt(CodeReservedField, msg.Source, f.Line, f.Column,
+					"%s.%s uses %s, which the message reserves", msg.Name, f.Name, r))
+			}
+			if f.Label == LabelRequired && file.Syntax == "proto3" {
+				errs = append(errs, errorAt(CodeInvalidLabel, msg.Source, f.Line, f.Column,
+					"%s.%s is required, which proto3 does not allow", msg.Name, f.Name))
+			}
+			numbers[f.Number] = f.Name
+			names[f.Name] = true
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// reservedBy returns the entry of reserved, a message's reserved numbers,
+// ranges and names, that f's number or name falls under.
+func reservedBy(reserved []string, f ProtoField) (string, bool) {
+	for _, r := range reserved {
+		from, to, isRange := strings.Cut(r, " to ")
+		lo, err := strconv.Atoi(strings.TrimSpace(from))
+		switch {
+		case err != nil:
+			if r == f.Name {
+				return "reserved name " + r, true
+			}
+			continue
+		case !isRange:
+			to = from
+		}
+		hi, err := strconv.Atoi(strings.TrimSpace(to))
+		if strings.TrimSpace(to) == "max" {
+			hi, err = math.MaxInt32, nil
+		}
+		if err == nil && lo <= f.Number && f.Number <= hi {
+			return "reserved number " + r, true
+		}
+	}
+	return "", false
+}
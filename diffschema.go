@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+)
+
+// schemaChange is one difference between two versions of the generated
+// models, with the Django migration operation makemigrations should emit.
+type schemaChange struct {
+	// Model is the app_label.Model the change applies to.
+	Model string
+	// Operation is the django.db.migrations operation, e.g. AddField.
+	Operation string
+	Detail    string
+	// Destructive changes drop columns or tables or may not convert
+	// existing data.
+	Destructive bool
+}
+
+func (c schemaChange) String() string {
+	s := c.Model + ": " + c.Operation
+	if c.Detail != "" {
+		s += " " + c.Detail
+	}
+	if c.Destructive {
+		s += " [destructive]"
+	}
+	return s
+}
+
+// loadSchema returns the plan of the apps generated from spec: a JSON file
+// written by -emit-ir, or comma-separated .proto paths planned with opts.
+func loadSchema(spec, outputDir string, opts Options) (IR, error) {
+	if strings.HasSuffix(spec, ".json") {
+		data, err := os.ReadFile(spec)
+		if err != nil {
+			return IR{}, err
+		}
+		var ir IR
+		if err := json.Unmarshal(data, &ir); err != nil {
+			return IR{}, fmt.Errorf("%s: %w", spec, err)
+		}
+		return ir, nil
+	}
+	var paths stringList
+	paths.Set(spec)
+	opts.DryRun = true
+	return generateApps(paths, outputDir, opts)
+}
+
+// fieldClass returns the Django field class of a rendered field declaration.
+func fieldClass(decl string) string {
+	if i := strings.IndexByte(decl, '('); i >= 0 {
+		return decl[:i]
+	}
+	return decl
+}
+
+// needsDefault reports whether adding the field to a table with rows makes
+// makemigrations ask for a one-off default.
+func needsDefault(decl string) bool {
+	for _, s := range []string{"null=True", "default=", "auto_now", "ManyToManyField"} {
+		if strings.Contains(decl, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// DiffSchema compares the models planned in from and to and lists the
+// migration operations that take one to the other. Fields keeping their
+// proto field number under a new name are renames rather than a removal and
+// an addition.
+func DiffSchema(from, to IR) []schemaChange {
+	models := func(ir IR) map[string]ModelPlan {
+		m := map[string]ModelPlan{}
+		for _, app := range ir.Apps {
+			for _, model := range app.Models {
+				m[app.App+"."+model.Model] = model
+			}
+		}
+		return m
+	}
+	before, after := models(from), models(to)
+	var names []string
+	for name := range before {
+		names = append(names, name)
+	}
+	for name := range after {
+		if _, ok := before[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var changes []schemaChange
+	for _, name := range names {
+		prev, hadPrev := before[name]
+		next, hasNext := after[name]
+		switch {
+		case !hadPrev:
+			changes = append(changes, schemaChange{Model: name, Operation: "CreateModel"})
+		case !hasNext:
+			changes = append(changes, schemaChange{Model: name, Operation: "DeleteModel", Destructive: true})
+		default:
+			changes = append(changes, diffFields(name, prev.Fields, next.Fields)...)
+		}
+	}
+	return changes
+}
+
+// diffFields lists the field operations between two versions of a model.
+func diffFields(model string, prev, next []FieldPlan) []schemaChange {
+	alter := func(from, to FieldPlan) []schemaChange {
+		if from.DjangoField == to.DjangoField {
+			return nil
+		}
+		return []schemaChange{{
+			Model:       model,
+			Operation:   "AlterField",
+			Detail:      to.Attribute + ": " + from.DjangoField + " -> " + to.DjangoField,
+			Destructive: fieldClass(from.DjangoField) != fieldClass(to.DjangoField),
+		}}
+	}
+
+	byAttr := map[string]FieldPlan{}
+	byNumber := map[int]FieldPlan{}
+	for _, f := range prev {
+		byAttr[f.Attribute] = f
+		if f.Number != 0 {
+			byNumber[f.Number] = f
+		}
+	}
+	kept := map[string]bool{}
+	for _, f := range next {
+		if _, ok := byAttr[f.Attribute]; ok {
+			kept[f.Attribute] = true
+		}
+	}
+
+	var changes []schemaChange
+	for _, f := range next {
+		if old, ok := byAttr[f.Attribute]; ok {
+			changes = append(changes, alter(old, f)...)
+			continue
+		}
+		if old, ok := byNumber[f.Number]; ok && f.Number != 0 && !kept[old.Attribute] {
+			kept[old.Attribute] = true
+			changes = append(changes, schemaChange{Model: model, Operation: "RenameField", Detail: old.Attribute + " -> " + f.Attribute})
+			changes = append(changes, alter(old, f)...)
+			continue
+		}
+		change := schemaChange{Model: model, Operation: "AddField", Detail: f.Attribute + " = " + f.DjangoField}
+		if needsDefault(f.DjangoField) {
+			change.Detail += " (existing rows need a default)"
+		}
+		changes = append(changes, change)
+	}
+	for _, f := range prev {
+		if !kept[f.Attribute] {
+			changes = append(changes, schemaChange{Model: model, Operation: "RemoveField", Detail: f.Attribute, Destructive: true})
+		}
+	}
+	return changes
+}
+
+// diffCommand sets up `proto2django diff [flags] OLD NEW`, where each side
+// is an -emit-ir JSON file or comma-separated .proto files, which prints the
+// expected migration operations to stdout.
+func diffCommand(fs *flag.FlagSet) func() int {
+	var opts Options
+	var outputDir string
+	var failOnDestructive, quiet bool
+	optionFlags(fs, &opts)
+	fs.StringVar(&outputDir, "out", "generated_app", "Output directory the app is generated into, which names it")
+	fs.BoolVar(&failOnDestructive, "fail-on-destructive", false, "Exit with status 1 when a change drops data")
+	fs.BoolVar(&quiet, "quiet", false, "Only log errors")
+	return func() int {
+		if fs.NArg() != 2 {
+			fs.Usage()
+			return ExitUsage
+		}
+		logger, err := newLogger(os.Stderr, false, quiet, LogFormatText)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitUsage
+		}
+		slog.SetDefault(logger)
+
+		from, err := loadSchema(fs.Arg(0), outputDir, opts)
+		if err != nil {
+			return reportError(os.Stderr, err, ErrorFormatText)
+		}
+		to, err := loadSchema(fs.Arg(1), outputDir, opts)
+		if err != nil {
+			return reportError(os.Stderr, err, ErrorFormatText)
+		}
+		changes := DiffSchema(from, to)
+		destructive := printChanges(os.Stdout, changes)
+		slog.Info("schema compared", "changes", len(changes), "destructive", destructive)
+		if destructive > 0 && failOnDestructive {
+			return ExitFailure
+		}
+		return 0
+	}
+}
+
+// printChanges writes one line per change and returns how many are
+// destructive.
+func printChanges(w io.Writer, changes []schemaChange) int {
+	destructive := 0
+	for _, c := range changes {
+		fmt.Fprintln(w, c)
+		if c.Destructive {
+			destructive++
+		}
+	}
+	return destructive
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ProtoEnum represents a parsed protobuf enum, top-level or nested in a
+// message.
+type ProtoEnum struct {
+	Name    string
+	Comment string
+	Values  []ProtoEnumValue
+	// Options holds the enum's option statements flattened to dotted keys.
+	Options map[string]string `json:",omitempty"`
+	Source  string
+	Line    int
+	Column  int
+}
+
+// ProtoEnumValue is a value of an enum.
+type ProtoEnumValue struct {
+	Name   string
+	Number int
+	// Options holds the value's [...] options flattened to dotted keys.
+	Options map[string]string `json:",omitempty"`
+}
+
+// RenderedEnum is the models.IntegerChoices class of an enum.
+type RenderedEnum struct {
+	Name   string
+	Values []RenderedEnumValue
+	// Unspecified is the member of the enum's unspecified zero value, if it
+	// is a choice, and ZeroNull is set when it is stored as NULL instead.
+	Unspecified string
+	ZeroNull    bool
+}
+
+// RenderedEnumValue is a member of an IntegerChoices class, named and
+// numbered as in the proto.
+type RenderedEnumValue struct {
+	Name   string
+	Number int
+	Label  string
+}
+
+var (
+	enumRe      = regexp.MustCompile(`\benum\s+(\w+)\s*{`)
+	enumValueRe = regexp.MustCompile(`\b(\w+)\s*=\s*(-?(?:0[xX][0-9a-fA-F]+|\d+))\s*(?:\[([^\]]*)\])?\s*;`)
+)
+
+// Options of enums and their values. An enum's unspecified zero value, by
+// the proto3 convention named <ENUM>_UNSPECIFIED, is a choice like the
+// others unless -enum-unspecified or the enum's
+// option (django.enum).unspecified = NULL stores it as NULL instead; a value's
+// [(django.enum_value).label = "..."] replaces the label derived from its
+// name.
+const (
+	enumUnspecifiedOption = "django.enum.unspecified"
+	enumLabelOption       = "django.enum_value.label"
+)
+
+// Policies for the unspecified zero value of enums.
+const (
+	EnumUnspecifiedChoice = "choice"
+	EnumUnspecifiedNull   = "null"
+)
+
+// parseEnums returns the enums declared in text, nested ones included,
+// positioned relative to line and column like parseDecl.
+func parseEnums(text, source string, lineOf, columnOf func(int) int) []ProtoEnum {
+	var enums []ProtoEnum
+	for _, loc := range enumRe.FindAllStringSubmatchIndex(text, -1) {
+		body := blankNested(blockBody(text, loc[1]-1))
+		enum := ProtoEnum{
+			Name:    text[loc[2]:loc[3]],
+			Comment: leadingComment(text, loc[0]),
+			Options: parseOptionList(optionStatements(body)),
+			Source:  source,
+			Line:    lineOf(loc[0]),
+			Column:  columnOf(loc[0]),
+		}
+		for _, v := range enumValueRe.FindAllStringSubmatch(body, -1) {
+			number, err := strconv.ParseInt(v[2], 0, 32)
+			if err != nil {
+				slog.Warn("enum value has invalid number, omitted", "enum", enum.Name, "value", v[1], "number", v[2])
+				continue
+			}
+			enum.Values = append(enum.Values, ProtoEnumValue{Name: v[1], Number: int(number), Options: parseOptionList(v[3])})
+		}
+		enums = append(enums, enum)
+	}
+	return enums
+}
+
+// isUnspecified reports whether v is the proto3 unspecified zero value.
+func isUnspecified(v ProtoEnumValue) bool {
+	return v.Number == 0 && (v.Name == "UNSPECIFIED" || strings.HasSuffix(v.Name, "_UNSPECIFIED"))
+}
+
+// enumZeroNull reports whether the unspecified zero value of e is stored as
+// NULL, as its unspecified option or else the default policy says.
+func enumZeroNull(e ProtoEnum, policy string) (bool, error) {
+	if v, ok := e.Options[enumUnspecifiedOption]; ok {
+		policy = strings.ToLower(strings.TrimPrefix(v, "django.EnumUnspecified."))
+	}
+	switch policy {
+	case "", EnumUnspecifiedChoice:
+		return false, nil
+	case EnumUnspecifiedNull:
+		return true, nil
+	}
+	return false, fmt.Errorf("unknown unspecified policy %q", policy)
+}
+
+// renderEnum builds the IntegerChoices class of e. Labels are the value names
+// without the prefix they all share, usually the enum's name, in sentence
+// case: ORDER_STATUS_IN_TRANSIT becomes 'In transit'. The unspecified value
+// is labelled 'Unspecified', unless policy leaves it out.
+func renderEnum(e ProtoEnum, policy string) RenderedEnum {
+	zeroNull, err := enumZeroNull(e, policy)
+	if err != nil {
+		slog.Warn("enum unspecified option ignored", "enum", e.Name, "reason", err)
+	}
+	r := RenderedEnum{Name: pascalCase(e.Name)}
+	names := make([]string, len(e.Values))
+	for i, v := range e.Values {
+		names[i] = v.Name
+	}
+	prefix := enumPrefix(names)
+	for _, v := range e.Values {
+		if isUnspecified(v) {
+			if zeroNull {
+				r.ZeroNull = true
+				continue
+			}
+			r.Unspecified = v.Name
+		}
+		label := v.Options[enumLabelOption]
+		switch {
+		case label != "":
+		case isUnspecified(v):
+			label = "Unspecified"
+		default:
+			label = strings.ReplaceAll(strings.ToLower(strings.TrimPrefix(v.Name, prefix)), "_", " ")
+			label = strings.ToUpper(label[:1]) + label[1:]
+		}
+		r.Values = append(r.Values, RenderedEnumValue{Name: v.Name, Number: v.Number, Label: label})
+	}
+	return r
+}
+
+// enumPrefix returns the longest prefix ending in an underscore that all of
+// names share, leaving each of them a name of its own.
+func enumPrefix(names []string) string {
+	if len(names) < 2 {
+		return ""
+	}
+	prefix := names[0]
+	for _, name := range names[1:] {
+		for !strings.HasPrefix(name, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	prefix = prefix[:strings.LastIndexByte(prefix, '_')+1]
+	for _, name := range names {
+		if name == prefix {
+			return ""
+		}
+	}
+	return prefix
+}
+
+// enumDefault returns the member of e a field defaults to, given by name or
+// number.
+func enumDefault(e RenderedEnum, value string) (string, error) {
+	for _, v := range e.Values {
+		if v.Name == value || strconv.Itoa(v.Number) == value {
+			return e.Name + "." + v.Name, nil
+		}
+	}
+	return "", fmt.Errorf("%s has no value %s", e.Name, value)
+}
+
+// enumSample returns the number of the first specified value of e, which
+// differs from the proto3 default.
+func enumSample(e RenderedEnum) string {
+	for _, v := range e.Values {
+		if v.Number != 0 {
+			return strconv.Itoa(v.Number)
+		}
+	}
+	return "0"
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// authUserModel is the reference used for a proto type mapped onto the
+// project's user model, whichever model that is.
+const authUserModel = "settings.AUTH_USER_MODEL"
+
+// externalModel is an existing Django model a proto message is mapped onto
+// instead of being generated.
+type externalModel struct {
+	// Label is the app_label.Model reference, or authUserModel.
+	Label string
+	// Module is the Python module defining the model class.
+	Module string
+}
+
+// loadModelMap reads a JSON object mapping fully-qualified proto message
+// names onto existing Django models, given as an import path
+// (django.contrib.auth.models.Group), an app label (billing.Invoice) or
+// settings.AUTH_USER_MODEL. The user model is always referenced through the
+// setting so that projects with a custom user model keep working.
+func loadModelMap(path string) (map[string]externalModel, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read model map: %w", err)
+	}
+	var raw map[string]string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid model map %s: %w", path, err)
+	}
+	models := map[string]externalModel{}
+	for protoName, target := range raw {
+		m, err := parseExternalModel(target)
+		if err != nil {
+			return nil, fmt.Errorf("model map %s: %s: %w", path, protoName, err)
+		}
+		models[strings.TrimPrefix(protoName, ".")] = m
+	}
+	return models, nil
+}
+
+// parseExternalModel interprets one model map target.
+func parseExternalModel(target string) (externalModel, error) {
+	if target == authUserModel || target == "django.contrib.auth.models.User" || target == "auth.User" {
+		return externalModel{Label: authUserModel}, nil
+	}
+	parts := strings.Split(target, ".")
+	for _, p := range parts {
+		if !identifierRe.MatchString(p) {
+			return externalModel{}, fmt.Errorf("invalid model reference %q", target)
+		}
+	}
+	switch {
+	case len(parts) == 2:
+		return externalModel{Label: target, Module: parts[0] + ".models"}, nil
+	case len(parts) > 2 && parts[len(parts)-2] == "models":
+		return externalModel{
+			Label:  parts[len(parts)-3] + "." + parts[len(parts)-1],
+			Module: strings.Join(parts[:len(parts)-1], "."),
+		}, nil
+	}
+	return externalModel{}, fmt.Errorf("expected app_label.Model or a path to a models module, got %q", target)
+}
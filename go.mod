@@ -1,5 +1,3 @@
 module github.com/berryp/proto2django
 
 go 1.24.2
-
-require golang.org/x/text v0.24.0
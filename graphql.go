@@ -0,0 +1,134 @@
+package main
+
+// GraphQLType maps a rendered field to the graphene input type used by the
+// generated create/update mutations. Relations are accepted by primary key.
+func GraphQLType(f RenderedField) string {
+	if !isScalar(f.Type) {
+		if f.Repeated {
+			return "graphene.List(graphene.ID)"
+		}
+		return "graphene.ID()"
+	}
+	var scalar string
+	switch f.Type {
+	case "int32", "int64", "uint32", "uint64", "sint32", "sint64",
+		"fixed32", "fixed64", "sfixed32", "sfixed64":
+		scalar = "graphene.Int"
+	case "string":
+		scalar = "graphene.String"
+	case "bytes":
+		scalar = "graphene.Base64"
+	case "bool":
+		scalar = "graphene.Boolean"
+	case "float", "double":
+		scalar = "graphene.Float"
+	case dateType:
+		scalar = "graphene.Date"
+	case timestampType:
+		scalar = "graphene.DateTime"
+	case moneyType:
+		scalar = "graphene.Decimal"
+	case latLngType:
+		scalar = "graphene.JSONString"
+		if isPointField(f) {
+			scalar = "graphene.String"
+		}
+	}
+	if isDecimalField(f) {
+		scalar = "graphene.Decimal"
+	}
+	if f.Repeated {
+		return "graphene.List(" + scalar + ")"
+	}
+	return scalar + "()"
+}
+
+const schemaTemplate = `import graphene
+from graphene_django import DjangoObjectType
+
+from .models import {{ range $i, $m := .APIMessages }}{{ if $i }}, {{ end }}{{ $m.Name }}{{ end }}
+{{- if not .ReadOnly }}
+from .utils import save_instance
+{{- end }}
+{{ range .APIMessages }}
+
+class {{ .Name }}Type(DjangoObjectType):
+    class Meta:
+        model = {{ .Name }}
+{{- if .SearchFields }}
+        exclude = ['search_vector']
+{{- else }}
+        fields = '__all__'
+{{- end }}
+{{- if not $.ReadOnly }}
+
+
+class {{ .Name }}Input(graphene.InputObjectType):
+{{- range .InputFields }}
+    {{ .Name }} = {{ GraphQLType . }}
+{{- else }}
+    pass
+{{- end }}
+
+
+class Create{{ .Name }}(graphene.Mutation):
+    class Arguments:
+        input = {{ .Name }}Input(required=True)
+
+    {{ .SnakeName }} = graphene.Field({{ .Name }}Type)
+
+    def mutate(root, info, input):
+        return Create{{ .Name }}({{ .SnakeName }}=save_instance({{ .Name }}(), input))
+
+
+class Update{{ .Name }}(graphene.Mutation):
+    class Arguments:
+        id = graphene.ID(required=True)
+        input = {{ .Name }}Input(required=True)
+
+    {{ .SnakeName }} = graphene.Field({{ .Name }}Type)
+
+    def mutate(root, info, id, input):
+        instance = {{ .Name }}.objects.get(pk=id)
+{{- if .ImmutableAttrs }}
+        input = {k: v for k, v in input.items() if k not in {{ "{" }}{{ range $i, $name := .ImmutableAttrs }}{{ if $i }}, {{ end }}'{{ $name }}'{{ end }}{{ "}" }}}
+{{- end }}
+        return Update{{ .Name }}({{ .SnakeName }}=save_instance(instance, input))
+
+
+class Delete{{ .Name }}(graphene.Mutation):
+    class Arguments:
+        id = graphene.ID(required=True)
+
+    ok = graphene.Boolean()
+
+    def mutate(root, info, id):
+        deleted, _ = {{ .Name }}.objects.filter(pk=id).delete()
+        return Delete{{ .Name }}(ok=deleted > 0)
+{{- end }}
+{{ end }}
+
+class Query(graphene.ObjectType):
+{{- range .APIMessages }}
+    {{ .PluralName }} = graphene.List({{ .Name }}Type)
+    {{ .SnakeName }} = graphene.Field({{ .Name }}Type, id=graphene.ID(required=True))
+{{- end }}
+{{ range .APIMessages }}
+    def resolve_{{ .PluralName }}(root, info):
+        return {{ .Name }}.objects.all()
+
+    def resolve_{{ .SnakeName }}(root, info, id):
+        return {{ .Name }}.objects.filter(pk=id).first()
+{{ end }}
+{{- if not .ReadOnly }}
+
+class Mutation(graphene.ObjectType):
+{{- range .APIMessages }}
+    create_{{ .SnakeName }} = Create{{ .Name }}.Field()
+    update_{{ .SnakeName }} = Update{{ .Name }}.Field()
+    delete_{{ .SnakeName }} = Delete{{ .Name }}.Field()
+{{- end }}
+{{ end }}
+
+schema = graphene.Schema(query=Query{{ if not .ReadOnly }}, mutation=Mutation{{ end }})
+`
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// RenderedClient is a clients.py wrapper class around a service's grpcio stub.
+type RenderedClient struct {
+	Name    string
+	Comment string
+	// Module is the stem of the protoc-generated <Module>_pb2_grpc module.
+	Module  string
+	Methods []RenderedRPC
+}
+
+// RenderedRPC is a client method calling one RPC.
+type RenderedRPC struct {
+	Name    string
+	RPC     string
+	Comment string
+	// InputType and OutputType are the request and response messages as
+	// named among the app's models.
+	InputType  string
+	OutputType string
+	// Input and Output are the Python annotations of the request and
+	// response, empty when the message class is not known.
+	Input           string
+	Output          string
+	ClientStreaming bool
+	ServerStreaming bool
+}
+
+// Streaming reports whether either side of the RPC is a stream; streaming
+// calls are not retried.
+func (r RenderedRPC) Streaming() bool {
+	return r.ClientStreaming || r.ServerStreaming
+}
+
+// wellKnownModules maps the google.protobuf messages commonly used as RPC
+// requests and responses to the protobuf runtime modules defining them.
+var wellKnownModules = map[string]string{
+	"google.protobuf.Empty":     "empty_pb2",
+	"google.protobuf.Timestamp": "timestamp_pb2",
+	"google.protobuf.Duration":  "duration_pb2",
+	"google.protobuf.Struct":    "struct_pb2",
+	"google.protobuf.Any":       "any_pb2",
+	"google.protobuf.FieldMask": "field_mask_pb2",
+}
+
+// pbModule returns the stem protoc gives the Python modules generated from
+// a .proto file: shop.proto becomes shop_pb2 and shop_pb2_grpc.
+func pbModule(source string) string {
+	return strings.TrimSuffix(filepath.Base(source), ".proto")
+}
+
+// pbClass returns the path of the class protoc generates for msg within its
+// module: Order.Item for a message Item nested in Order.
+func pbClass(msg ProtoMessage) string {
+	if msg.Enclosing != "" {
+		return msg.Enclosing + "." + msg.Name
+	}
+	return msg.Name
+}
+
+// grpcClients renders a client per service in file and the imports of the
+// protoc-generated modules they use, found in pkg when it is set.
+func grpcClients(file *ProtoFile, pkg string) ([]RenderedClient, []string) {
+	modules := map[string]string{}
+	classes := map[string]string{}
+	for _, msg := range file.Messages {
+		modules[msg.Name] = pbModule(msg.Source)
+		classes[msg.Name] = pbClass(msg)
+	}
+	local := map[string]bool{}
+	wellKnown := map[string]bool{}
+	pbType := func(typ string) string {
+		if m, ok := wellKnownModules[typ]; ok {
+			wellKnown[m] = true
+			return m + "." + typ[strings.LastIndex(typ, ".")+1:]
+		}
+		// Messages are keyed by their flattened name, as the parser gives
+		// them, whatever their package or enclosing messages.
+		name := typ[strings.LastIndex(typ, ".")+1:]
+		if m, ok := modules[name]; ok {
+			local[m+"_pb2"] = true
+			return m + "_pb2." + classes[name]
+		}
+		return ""
+	}
+
+	var clients []RenderedClient
+	for _, svc := range file.Services {
+		client := RenderedClient{Name: svc.Name, Comment: svc.Comment, Module: pbModule(svc.Source)}
+		local[client.Module+"_pb2_grpc"] = true
+		for _, m := range svc.Methods {
+			rpc := RenderedRPC{
+				Name:            snakeCase(m.Name),
+				RPC:             m.Name,
+				Comment:         m.Comment,
+				InputType:       m.InputType,
+				OutputType:      m.OutputType,
+				Input:           pbType(m.InputType),
+				Output:          pbType(m.OutputType),
+				ClientStreaming: m.ClientStreaming,
+				ServerStreaming: m.ServerStreaming,
+			}
+			if rpc.ClientStreaming && rpc.Input != "" {
+				rpc.Input = "Iterator[" + rpc.Input + "]"
+			}
+			if rpc.ServerStreaming && rpc.Output != "" {
+				rpc.Output = "Iterator[" + rpc.Output + "]"
+			}
+			client.Methods = append(client.Methods, rpc)
+		}
+		clients = append(clients, client)
+	}
+
+	var imports []string
+	for m := range wellKnown {
+		imports = append(imports, "from google.protobuf import "+m)
+	}
+	for m := range local {
+		imports = append(imports, pbModuleImport(pkg, m))
+	}
+	sort.Strings(imports)
+	return clients, imports
+}
+
+// pbImport returns the line of imports that imports the module of the
+// protobuf class typ, such as sample_pb2.Order.
+func pbImport(imports []string, typ string) string {
+	module := typ[:strings.Index(typ, ".")]
+	for _, imp := range imports {
+		if strings.HasSuffix(imp, " "+module) {
+			return imp
+		}
+	}
+	return ""
+}
+
+const clientsTemplate = `import time
+from typing import Iterator
+
+import grpc
+from django.conf import settings
+{{ range .GRPCImports }}
+{{ . }}
+{{- end }}
+
+# Status codes after which a unary call is retried with exponential backoff.
+# Calls that timed out or were throttled may have been applied already, so
+# retrying them could repeat a mutation; only UNAVAILABLE is retried.
+RETRYABLE_CODES = (
+    grpc.StatusCode.UNAVAILABLE,
+)
+
+# timeout is the deadline of unary calls in seconds; streams are long-lived
+# and have none unless stream_timeout sets one.
+DEFAULTS = {
+    'target': 'localhost:50051',
+    'secure': False,
+    'timeout': 10.0,
+    'stream_timeout': None,
+    'retries': 3,
+    'backoff': 0.1,
+}
+
+_channels = {}
+
+
+def client_settings(service):
+    """Settings of a service's client: DEFAULTS overridden by the service's
+    entry in settings.GRPC_CLIENTS, e.g.
+    GRPC_CLIENTS = {'ShopService': {'target': 'shop:50051', 'secure': True}}."""
+    config = dict(DEFAULTS)
+    config.update(getattr(settings, 'GRPC_CLIENTS', {}).get(service, {}))
+    return config
+
+
+def get_channel(service):
+    """Returns the channel shared by a service's clients, opening it on first use."""
+    if service not in _channels:
+        config = client_settings(service)
+        if config['secure']:
+            _channels[service] = grpc.secure_channel(config['target'], grpc.ssl_channel_credentials())
+        else:
+            _channels[service] = grpc.insecure_channel(config['target'])
+    return _channels[service]
+
+
+def call_with_retry(service, method, request, timeout=None, metadata=None):
+    """Invokes a unary RPC with the service's deadline, retrying transient failures."""
+    config = client_settings(service)
+    attempts = config['retries'] + 1
+    for attempt in range(attempts):
+        try:
+            return method(request, timeout=timeout or config['timeout'], metadata=metadata)
+        except grpc.RpcError as exc:
+            if exc.code() not in RETRYABLE_CODES or attempt == attempts - 1:
+                raise
+            time.sleep(config['backoff'] * 2 ** attempt)
+{{ range .Clients }}
+
+class {{ .Name }}Client:
+    {{ if .Comment }}{{ Docstring .Comment }}{{ else }}"""Client for the {{ .Name }} gRPC service."""{{ end }}
+
+    service = '{{ .Name }}'
+
+    def __init__(self, channel=None):
+        self.stub = {{ .Module }}_pb2_grpc.{{ .Name }}Stub(channel or get_channel(self.service))
+{{- range .Methods }}
+
+    def {{ .Name }}(self, request{{ if .Input }}: {{ .Input }}{{ end }}, timeout: float | None = None, metadata=None){{ if .Output }} -> {{ .Output }}{{ end }}:
+{{- if .Comment }}
+        {{ Docstring .Comment }}
+{{- end }}
+{{- if .Streaming }}
+        timeout = timeout or client_settings(self.service)['stream_timeout']
+        return self.stub.{{ .RPC }}(request, timeout=timeout, metadata=metadata)
+{{- else }}
+        return call_with_retry(self.service, self.stub.{{ .RPC }}, request, timeout, metadata)
+{{- end }}
+{{- end }}
+{{ end }}`
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// grpcServerCommandPath is the management command serving the app's
+// services, relative to the app.
+var grpcServerCommandPath = filepath.Join("management", "commands", "grpcserver.py")
+
+// servicerImports returns the imports of the protoc-generated _pb2_grpc
+// modules among the gRPC imports, which define the servicers and the
+// functions adding them to a server.
+func servicerImports(imports []string) []string {
+	var kept []string
+	for _, imp := range imports {
+		if strings.HasSuffix(imp, "_pb2_grpc") {
+			kept = append(kept, imp)
+		}
+	}
+	return kept
+}
+
+var servicerClassRe = regexp.MustCompile(`(?m)^class (\w+)\(`)
+
+// writeGRPCServer scaffolds servicers.py with a servicer per service, kept
+// across regeneration like actions.py, and writes the grpcserver command
+// running them on django-socio-grpc's server.
+func writeGRPCServer(outputDir string, data TemplateData) error {
+	if len(data.Servicers) == 0 {
+		return nil
+	}
+	tmpl := template.Must(template.New("servicer").Funcs(funcMap).Parse(servicerTemplate))
+	var blocks []scaffoldBlock
+	for _, svc := range data.Servicers {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, svc); err != nil {
+			return err
+		}
+		blocks = append(blocks, scaffoldBlock{Key: svc.Name + "Servicer", Text: buf.String()})
+	}
+	imports := "import grpc\n"
+	for _, imp := range data.ServicerImports {
+		imports += imp + "\n"
+	}
+	if err := appendScaffold(filepath.Join(outputDir, "servicers.py"), imports, servicerClassRe, blocks); err != nil {
+		return err
+	}
+
+	if err := writeManagementPackage(outputDir, data); err != nil {
+		return err
+	}
+	if err := writeGenerated(filepath.Join(outputDir, grpcServerCommandPath), []byte(grpcServerCommandTemplate), data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", grpcServerCommandPath, err)
+	}
+	return nil
+}
+
+// servicerTemplate renders the servicers.py class implementing one service.
+const servicerTemplate = `
+
+class {{ .Name }}Servicer({{ .Module }}_pb2_grpc.{{ .Name }}Servicer):
+    {{ if .Comment }}{{ Docstring .Comment }}{{ else }}"""Implements the {{ .Name }} gRPC service."""{{ end }}
+{{- range .Methods }}
+
+    def {{ .RPC }}(self, {{ if .ClientStreaming }}request_iterator{{ else }}request{{ end }}, context):
+{{- if .Comment }}
+        {{ Docstring .Comment }}
+{{- end }}
+        # rpc {{ .RPC }}({{ if .ClientStreaming }}stream {{ end }}{{ .InputType }}) returns ({{ if .ServerStreaming }}stream {{ end }}{{ .OutputType }})
+        context.abort(grpc.StatusCode.UNIMPLEMENTED, '{{ .RPC }} is not implemented')
+{{- end }}
+`
+
+const handlersTemplate = `from . import servicers
+{{- range .ServicerImports }}
+{{ . }}
+{{- end }}
+
+
+def grpc_handlers(server):
+    """Adds the app's servicers to django-socio-grpc's server. It is the
+    ROOT_HANDLERS_HOOK of grpc_settings.py; a project serving several apps
+    calls the grpc_handlers of each from a hook of its own."""
+{{- range .Servicers }}
+    {{ .Module }}_pb2_grpc.add_{{ .Name }}Servicer_to_server(servicers.{{ .Name }}Servicer(), server)
+{{- end }}
+`
+
+const grpcSettingsTemplate = `# django-socio-grpc settings serving the app's gRPC services, to import into
+# the project's settings with 'django_socio_grpc' in INSTALLED_APPS:
+#
+#     from {{ .AppModule }}.grpc_settings import GRPC_FRAMEWORK
+
+GRPC_FRAMEWORK = {
+    'ROOT_HANDLERS_HOOK': '{{ .AppModule }}.handlers.grpc_handlers',
+    # The servicers are synchronous, served by grpcrunserver.
+    'GRPC_ASYNC': False,
+}
+`
+
+const grpcServerCommandTemplate = `from django.core.management import call_command
+from django.core.management.base import BaseCommand
+
+
+class Command(BaseCommand):
+    help = "Serves the gRPC services of GRPC_FRAMEWORK's ROOT_HANDLERS_HOOK with django-socio-grpc."
+
+    def add_arguments(self, parser):
+        parser.add_argument('address', nargs='?', default='[::]:50051', help='Address to serve on')
+        parser.add_argument('--dev', action='store_true', help='Restart the server when the code changes')
+
+    def handle(self, *args, **options):
+        call_command('grpcrunserver', options['address'], *(['--dev'] if options['dev'] else []))
+`
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Version is the proto2django release stamped into generated files.
+const Version = "0.1.0"
+
+const (
+	headerPrefix   = "# Code generated by proto2django "
+	checksumPrefix = "# checksum: sha256:"
+)
+
+// generatedHeader returns the two comment lines stamped on every generated
+// file: the tool version and source proto hash, and a checksum of the body
+// that follows so that later hand edits can be detected.
+func generatedHeader(data TemplateData, body []byte) string {
+	sum := sha256.Sum256(body)
+	return headerWithSum(data, sum[:])
+}
+
+// headerWithSum returns the generated-file header for a body with the given
+// sha256. Its length does not depend on the sum.
+func headerWithSum(data TemplateData, sum []byte) string {
+	return fmt.Sprintf("%sv%s from %s (sha256:%s) — DO NOT EDIT.\n%s%s\n",
+		headerPrefix, Version, strings.Join(data.Sources, ", "), data.SourceHash,
+		checksumPrefix, hex.EncodeToString(sum))
+}
+
+// writeGenerated writes body to path preceded by the generated-file header,
+// unless templateCheck finds it broken.
+func writeGenerated(path string, body []byte, data TemplateData) error {
+	check := newTemplateCheck(filepath.Base(path))
+	check.Write(body)
+	if err := check.Close(); err != nil {
+		return err
+	}
+	content := append([]byte(generatedHeader(data, body)), body...)
+	return os.WriteFile(path, content, 0644)
+}
+
+// streamGenerated writes the generated-file header to path followed by the
+// body render produces, without holding the body in memory: the header is
+// written with a placeholder checksum that is overwritten in place once the
+// body has been hashed. The file is removed if rendering fails or
+// templateCheck finds the body broken.
+func streamGenerated(path string, data TemplateData, render func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	check := newTemplateCheck(filepath.Base(path))
+	out := bufio.NewWriter(f)
+	_, err = out.WriteString(headerWithSum(data, make([]byte, sha256.Size)))
+	if err == nil {
+		err = render(io.MultiWriter(check, out, hash))
+	}
+	if err == nil {
+		err = check.Close()
+	}
+	if err == nil {
+		err = out.Flush()
+	}
+	if err == nil {
+		_, err = f.WriteAt([]byte(headerWithSum(data, hash.Sum(nil))), 0)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// sourceHash returns the hex sha256 of a proto source.
+func sourceHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// CheckDrift reports the generated files beneath dir whose body no longer
+// matches the checksum recorded in their header, i.e. files edited by hand
+// after generation. Files without a proto2django header are ignored.
+func CheckDrift(dir string) ([]string, error) {
+	var drifted []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if edited, ok := hasDrifted(content); ok && edited {
+			rel, _ := filepath.Rel(dir, path)
+			drifted = append(drifted, rel)
+		}
+		return nil
+	})
+	return drifted, err
+}
+
+// hasDrifted reports whether a generated file's body differs from its
+// recorded checksum; ok is false when content carries no generated header.
+func hasDrifted(content []byte) (edited, ok bool) {
+	reader := bufio.NewReader(bytes.NewReader(content))
+	first, err := reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(first, headerPrefix) {
+		return false, false
+	}
+	second, err := reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(second, checksumPrefix) {
+		return false, false
+	}
+	body := content[len(first)+len(second):]
+	sum := sha256.Sum256(body)
+	return strings.TrimSpace(strings.TrimPrefix(second, checksumPrefix)) != hex.EncodeToString(sum[:]), true
+}
@@ -0,0 +1,13 @@
+package main
+
+// historyAttr returns the attribute of the HistoricalRecords of a model with
+// fields under -history: history, unless a field already takes the name.
+func historyAttr(fields []RenderedField, opts Options) string {
+	switch {
+	case !opts.History:
+		return ""
+	case hasField(fields, "history"):
+		return "history_records"
+	}
+	return "history"
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// IR is the machine-readable plan written by -emit-ir: what was parsed from
+// the protos, how each message and field maps onto Django, and which files
+// were generated. Field names are stable for consumption by other tools.
+// Files, messages, fields, services and RPCs carry their options, custom
+// ones included, flattened to dotted keys: [(acme.audit).level = 2] is
+// "acme.audit.level": "2".
+type IR struct {
+	Version string    `json:"version"`
+	Apps    []AppPlan `json:"apps"`
+}
+
+// AppPlan describes one generated Django app.
+type AppPlan struct {
+	App        string   `json:"app"`
+	Dir        string   `json:"dir"`
+	Package    string   `json:"package,omitempty"`
+	Sources    []string `json:"sources"`
+	SourceHash string   `json:"source_hash"`
+	// URLPrefix is the path -project-root includes the app's URLs at.
+	URLPrefix string `json:"url_prefix"`
+	// Options are the file options of the app's sources; where sources set
+	// the same option, the first one's value is kept.
+	Options map[string]string `json:"options,omitempty"`
+	// InstalledApps are the third-party apps the app needs installed.
+	InstalledApps []string `json:"installed_apps,omitempty"`
+	// Dependencies are the generated apps the app's models reference.
+	Dependencies []string      `json:"dependencies,omitempty"`
+	Models       []ModelPlan   `json:"models"`
+	Services     []ServicePlan `json:"services,omitempty"`
+	Files        []string      `json:"files"`
+}
+
+// ModelPlan maps a proto message onto a Django model. ProtoName is empty for
+// models the generator introduces itself, such as child tables.
+type ModelPlan struct {
+	Model       string            `json:"model"`
+	ProtoName   string            `json:"proto_name,omitempty"`
+	Comment     string            `json:"comment,omitempty"`
+	Options     map[string]string `json:"options,omitempty"`
+	RoutePrefix string            `json:"route_prefix"`
+	Layers      []string          `json:"layers"`
+	Fields      []FieldPlan       `json:"fields"`
+}
+
+// FieldPlan maps a proto field onto a model attribute.
+type FieldPlan struct {
+	Attribute   string            `json:"attribute"`
+	ProtoName   string            `json:"proto_name"`
+	ProtoType   string            `json:"proto_type"`
+	Number      int               `json:"number,omitempty"`
+	Repeated    bool              `json:"repeated,omitempty"`
+	DjangoField string            `json:"django_field"`
+	Options     map[string]string `json:"options,omitempty"`
+}
+
+// ServicePlan lists a service's RPCs with their resolved message types.
+type ServicePlan struct {
+	Name    string            `json:"name"`
+	Comment string            `json:"comment,omitempty"`
+	Options map[string]string `json:"options,omitempty"`
+	Methods []MethodPlan      `json:"methods"`
+}
+
+// MethodPlan describes one RPC.
+type MethodPlan struct {
+	Name       string            `json:"name"`
+	InputType  string            `json:"input_type"`
+	OutputType string            `json:"output_type"`
+	Options    map[string]string `json:"options,omitempty"`
+}
+
+// planApp records the plan of an app rendered from file into outputDir.
+func planApp(file *ProtoFile, outputDir string, data TemplateData, rendered map[string]string) *AppPlan {
+	plan := &AppPlan{
+		App:        data.AppName,
+		Dir:        outputDir,
+		Package:    file.Package,
+		Sources:    file.Sources,
+		SourceHash: file.SourceHash,
+		URLPrefix:  data.URLPrefix,
+		Options:    file.Options,
+	}
+	plan.InstalledApps = installedApps(data)
+	plan.Dependencies = append([]string(nil), data.Dependencies...)
+	sort.Strings(plan.Dependencies)
+
+	protoMessages := map[string]ProtoMessage{}
+	for _, msg := range file.Messages {
+		protoMessages[msg.Name] = msg
+	}
+	for _, msg := range data.Messages {
+		source := protoMessages[msg.ProtoName]
+		protoFields := map[string]ProtoField{}
+		for _, f := range source.Fields {
+			protoFields[f.Name] = f
+		}
+		numbers := map[string]int{}
+		for _, n := range msg.FieldNumbers {
+			numbers[n.Name] = n.Number
+		}
+		model := ModelPlan{
+			Model:       msg.Name,
+			ProtoName:   msg.ProtoName,
+			Comment:     source.Comment,
+			Options:     source.Options,
+			RoutePrefix: msg.RoutePrefix,
+			Layers:      msg.Layers,
+		}
+		for _, f := range msg.Fields {
+			model.Fields = append(model.Fields, FieldPlan{
+				Attribute:   f.Name,
+				ProtoName:   f.ProtoName,
+				ProtoType:   f.Type,
+				Number:      numbers[f.Name],
+				Repeated:    f.Repeated,
+				DjangoField: f.DjangoType,
+				Options:     protoFields[f.ProtoName].Options,
+			})
+		}
+		plan.Models = append(plan.Models, model)
+	}
+
+	for _, svc := range file.Services {
+		service := ServicePlan{Name: svc.Name, Comment: svc.Comment, Options: svc.Options}
+		for _, m := range svc.Methods {
+			service.Methods = append(service.Methods, MethodPlan{
+				Name:       m.Name,
+				InputType:  m.InputType,
+				OutputType: m.OutputType,
+				Options:    m.Options,
+			})
+		}
+		plan.Services = append(plan.Services, service)
+	}
+
+	files := []string{"__init__.py", "managers.py", filepath.Join("migrations", "__init__.py")}
+	if _, ok := rendered["tests.py"]; !ok {
+		files = append(files, "tests.py")
+	}
+	if data.Signals {
+		files = append(files, "signals.py")
+	}
+	if data.Actions {
+		files = append(files, "actions.py")
+	}
+	if len(data.Servicers) > 0 {
+		files = append(files, "servicers.py", grpcServerCommandPath)
+	}
+	if len(data.SyncCommands) > 0 || data.Seed != nil || len(data.Servicers) > 0 {
+		files = append(files, filepath.Join("management", "__init__.py"), filepath.Join("management", "commands", "__init__.py"))
+	}
+	for _, sync := range data.SyncCommands {
+		files = append(files, syncCommandPath(sync))
+	}
+	if data.Seed != nil {
+		files = append(files, seedCommandPath(data.Seed))
+	}
+	for name := range rendered {
+		files = append(files, name)
+	}
+	sort.Strings(files)
+	plan.Files = files
+	return plan
+}
+
+// writeIR writes ir as indented JSON to path.
+func writeIR(path string, ir IR) error {
+	out, err := json.MarshalIndent(ir, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(out, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write IR: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+)
+
+// Naming of the fields of the REST API's JSON. Snake uses the model field
+// names, Django's default. Camel exposes the names of the proto JSON
+// mapping, userId for user_id or the field's json_name, through serializer
+// fields declared with source=. CamelPackage renders and parses the JSON of
+// the ViewSets with djangorestframework-camel-case instead, which camelizes
+// every key, nested ones included, but knows nothing of json_name.
+const (
+	JSONCaseSnake        = "snake"
+	JSONCaseCamel        = "camel"
+	JSONCaseCamelPackage = "djangorestframework-camel-case"
+)
+
+// jsonName returns the name of the field f in the proto JSON mapping: its
+// json_name option, else its name in lowerCamelCase as protoc derives it.
+func jsonName(f ProtoField) string {
+	if name := f.Options["json_name"]; name != "" {
+		return name
+	}
+	var b strings.Builder
+	upper := false
+	for _, r := range f.Name {
+		switch {
+		case r == '_':
+			upper = true
+		case upper:
+			b.WriteString(strings.ToUpper(string(r)))
+			upper = false
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// serializerName returns the name the serializers expose the field f under
+// with the -json-case policy: its proto name or, under camel, its JSON name
+// when that is a Python identifier and not a keyword.
+func serializerName(f ProtoField, policy string) string {
+	if policy == JSONCaseCamelPackage && f.Options["json_name"] != "" {
+		slog.Warn("json_name is not honoured by djangorestframework-camel-case", "field", f.Name, "json_name", f.Options["json_name"])
+	}
+	if policy != JSONCaseCamel {
+		return f.Name
+	}
+	json := jsonName(f)
+	if !identifierRe.MatchString(json) || pythonKeywords[json] {
+		slog.Warn("field JSON name cannot be declared in Python, proto name kept", "field", f.Name, "json_name", json)
+		return f.Name
+	}
+	return json
+}
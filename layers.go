@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"path"
+	"slices"
+	"strings"
+)
+
+// The layers a model can be generated with: its table, its admin
+// registration and its endpoints in each API of -api. The model class is
+// always declared, since the admin and APIs need it; without the model
+// layer Django does not manage its table, as for data owned by another
+// service.
+const (
+	LayerModel = "model"
+	LayerAdmin = "admin"
+	LayerAPI   = "api"
+)
+
+// allLayers are the layers of models without a layers option or rule.
+var allLayers = []string{LayerModel, LayerAdmin, LayerAPI}
+
+// layersOption is the message option listing the layers generated for it,
+// comma-separated, e.g. [(django.meta).layers = "model,admin"] for an
+// internal entity without API endpoints.
+const layersOption = metaOption + ".layers"
+
+// layerRule is a -layers rule, giving the messages whose name matches
+// pattern the layers listed.
+type layerRule struct {
+	pattern string
+	layers  []string
+}
+
+// ruleList is a flag.Value collecting repeated flags whose values are
+// themselves comma-separated lists.
+type ruleList []string
+
+func (l *ruleList) String() string { return strings.Join(*l, " ") }
+
+func (l *ruleList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// parseLayerRules parses -layers rules of the form GLOB=LAYERS, e.g.
+// "Audit*=model,admin".
+func parseLayerRules(values []string) ([]layerRule, error) {
+	var rules []layerRule
+	for _, value := range values {
+		pattern, list, ok := strings.Cut(value, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid layers rule %q, want GLOB=LAYERS", value)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid layers pattern %q: %w", pattern, err)
+		}
+		layers, err := parseLayers(list)
+		if err != nil {
+			return nil, fmt.Errorf("invalid layers rule %q: %w", value, err)
+		}
+		rules = append(rules, layerRule{pattern: pattern, layers: layers})
+	}
+	return rules, nil
+}
+
+// parseLayers parses a comma-separated list of layers, in canonical order.
+func parseLayers(list string) ([]string, error) {
+	var layers []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if !slices.Contains(allLayers, name) {
+			return nil, fmt.Errorf("unknown layer %q, want model, admin or api", name)
+		}
+		layers = append(layers, name)
+	}
+	var ordered []string
+	for _, layer := range allLayers {
+		if slices.Contains(layers, layer) {
+			ordered = append(ordered, layer)
+		}
+	}
+	return ordered, nil
+}
+
+// messageLayers returns the layers generated for msg: those of its layers
+// option, or else of the first rule matching its name, or else all of them.
+func messageLayers(msg ProtoMessage, rules []layerRule) []string {
+	if list, ok := msg.Options[layersOption]; ok {
+		layers, err := parseLayers(list)
+		if err == nil {
+			return layers
+		}
+		slog.Warn("layers option ignored", "message", msg.Name, "reason", err)
+	}
+	for _, rule := range rules {
+		if ok, _ := path.Match(rule.pattern, msg.Name); ok {
+			return rule.layers
+		}
+	}
+	return allLayers
+}
+
+// layerMessages returns copies of the messages generated with layer.
+func layerMessages(messages []RenderedMessage, layer string) []RenderedMessage {
+	var kept []RenderedMessage
+	for _, msg := range messages {
+		if slices.Contains(msg.Layers, layer) {
+			kept = append(kept, msg)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Options mapping a model onto an existing table: the message options
+// (django.meta).db_table and (django.meta).managed = false, and the field
+// options (django.field).db_column and (django.field).primary_key.
+const (
+	dbTableOption    = metaOption + ".db_table"
+	managedOption    = metaOption + ".managed"
+	dbColumnOption   = fieldOption + ".db_column"
+	primaryKeyOption = fieldOption + ".primary_key"
+)
+
+// dbNameRe matches the table and column names the options accept, which are
+// rendered into Python strings unescaped.
+var dbNameRe = regexp.MustCompile(`^[A-Za-z_][\w$]*$`)
+
+// modelTable returns the Meta.db_table of the model of msg, "" for Django's
+// default, and whether Django manages the table.
+func modelTable(msg ProtoMessage) (table string, managed bool, err error) {
+	managed = true
+	switch v := msg.Options[managedOption]; v {
+	case "", "true":
+	case "false":
+		managed = false
+	default:
+		err = fmt.Errorf("invalid %s %q", managedOption, v)
+	}
+	if table = msg.Options[dbTableOption]; table != "" && !dbNameRe.MatchString(table) {
+		return "", managed, fmt.Errorf("invalid %s %q", dbTableOption, table)
+	}
+	return table, managed, err
+}
+
+// withDBColumn sets the db_column of djangoType to the (django.field)
+// option of f, replacing the one a renamed field gets. Many-to-many fields
+// have no column and keep djangoType.
+func withDBColumn(djangoType string, f ProtoField) (string, error) {
+	column, ok := f.Options[dbColumnOption]
+	if !ok {
+		return djangoType, nil
+	}
+	switch {
+	case !dbNameRe.MatchString(column):
+		return djangoType, fmt.Errorf("invalid %s %q", dbColumnOption, column)
+	case strings.Contains(djangoType, "ManyToManyField"):
+		return djangoType, fmt.Errorf("many-to-many fields have no column")
+	}
+	if i := strings.Index(djangoType, "db_column='"); i >= 0 {
+		end := i + len("db_column='") + strings.IndexByte(djangoType[i+len("db_column='"):], '\'')
+		return djangoType[:i] + "db_column='" + column + djangoType[end:], nil
+	}
+	return addKwarg(djangoType, "db_column='"+column+"'"), nil
+}
+
+// primaryKeyField reports whether f is the primary key of its model, in
+// place of the generated id.
+func primaryKeyField(f ProtoField) (bool, error) {
+	switch v := f.Options[primaryKeyOption]; v {
+	case "", "false":
+		return false, nil
+	case "true":
+		if f.Repeated {
+			return false, fmt.Errorf("repeated fields cannot be primary keys")
+		}
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid %s %q", primaryKeyOption, v)
+	}
+}
+
+// warnUnmanaged warns about the columns the generator adds to the model of
+// msg that an existing table is unlikely to have, and about its
+// many-to-many tables, which Django does not create for unmanaged models.
+func warnUnmanaged(msg RenderedMessage) {
+	var added []string
+	if msg.Base == "BaseModel" {
+		added = append(added, auditFields...)
+	}
+	if msg.SoftDelete {
+		added = append(added, "is_deleted", "deleted_at")
+	}
+	if msg.SearchFields != nil {
+		added = append(added, searchVectorField)
+	}
+	if len(added) > 0 {
+		slog.Warn("unmanaged model declares generated columns its table must have", "model", msg.Name, "columns", strings.Join(added, ", "))
+	}
+	for _, f := range msg.Fields {
+		if strings.Contains(f.DjangoType, "ManyToManyField") {
+			slog.Warn("many-to-many table of an unmanaged model must exist", "model", msg.Name, "field", f.Name)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// Validate checks protoPaths for what would stop them generating, or
+// generate broken Django code, into outputDir, without writing anything:
+// parse errors, undefined and unsupported types, the findings of lintProtos
+// and the names checkConflicts finds generated more than once.
+func Validate(protoPaths []string, outputDir string, opts Options) error {
+	if err := checkStdin(protoPaths); err != nil {
+		return err
+	}
+	var errs []error
+	var files []*ProtoFile
+	parsed := true
+	for _, path := range protoPaths {
+		inputs, err := parseInput(path, opts.Format)
+		if err != nil {
+			errs = append(errs, err)
+			parsed = false
+			continue
+		}
+		for _, file := range inputs {
+			if err := validateProto(file); err != nil {
+				errs = append(errs, err)
+			}
+			files = append(files, file)
+		}
+	}
+	errs = append(errs, lintProtos(files, opts)...)
+	// Types can only be resolved once every file has parsed.
+	if parsed {
+		opts.Strict = true
+		apps, app, err := resolveApps(files, outputDir, opts)
+		if err == nil && !opts.SplitPackages {
+			err = validateAppName(app)
+		}
+		if err == nil {
+			err = validateConflicts(apps, app, outputDir, opts)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateConflicts prepares apps as generate would and reports the names
+// they would generate more than once.
+func validateConflicts(apps map[string]*ProtoFile, defaultApp, outputDir string, opts Options) error {
+	// The warnings of preparing the apps repeat the findings of lintProtos.
+	logger := slog.Default()
+	slog.SetDefault(slog.New(slog.DiscardHandler))
+	defer slog.SetDefault(logger)
+	names, dirs := appDirs(apps, defaultApp, outputDir, opts)
+	var prepared []*preparedApp
+	for i, name := range names {
+		app, err := prepareApp(apps[name], dirs[i], name, opts)
+		if err != nil {
+			return err
+		}
+		prepared = append(prepared, app)
+	}
+	return checkConflicts(prepared)
+}
+
+// lintProtos reports declarations of files that protoc accepts but that make
+// for broken or surprising Django code: names Python reserves or models
+// already define, map fields and groups, which are not generated, messages
+// without fields and messages that would generate the same model. Fields the
+// generator renames or leaves out are only warned about.
+func lintProtos(files []*ProtoFile, opts Options) []error {
+	var errs []error
+	seen := map[string]ProtoMessage{}
+	for _, file := range files {
+		for _, msg := range file.Messages {
+			if pythonKeywords[msg.Name] {
+				errs = append(errs, errorAt(CodeReservedName, msg.Source, msg.Line, msg.Column,
+					"message name %s is a Python keyword and cannot name a model", msg.Name))
+			}
+			if len(msg.Fields) == 0 && len(msg.MapFields) == 0 && len(msg.Groups) == 0 {
+				errs = append(errs, errorAt(CodeEmptyMessage, msg.Source, msg.Line, msg.Column,
+					"%s has no fields; its model would only have a primary key", msg.Name))
+			}
+			key := msg.Name
+			if opts.SplitPackages {
+				key = qualifiedName(file.Package, msg.Name)
+			}
+			if other, ok := seen[key]; ok {
+				errs = append(errs, errorAt(CodeDuplicateModel, msg.Source, msg.Line, msg.Column,
+					"message %s is also declared at %s:%d; both would generate model %s", msg.Name, other.Source, other.Line, msg.Name))
+			} else {
+				seen[key] = msg
+			}
+
+			for _, f := range msg.Fields {
+				name := snakeCase(f.Name)
+				renamed, _ := sanitizeFieldName(name)
+				switch {
+				case pythonKeywords[name]:
+					errs = append(errs, warningAt(CodeReservedName, msg.Source, f.Line, f.Column,
+						"%s.%s is a Python keyword; the model field would be renamed %s", msg.Name, f.Name, renamed))
+				case modelAttributes[name]:
+					errs = append(errs, warningAt(CodeModelAttribute, msg.Source, f.Line, f.Column,
+						"%s.%s collides with the model attribute %s; the model field would be renamed %s", msg.Name, f.Name, name, renamed))
+				case renamed != name:
+					errs = append(errs, warningAt(CodeLookupSeparator, msg.Source, f.Line, f.Column,
+						"%s.%s has a double or trailing underscore, which Django reserves for lookups; the model field would be renamed %s", msg.Name, f.Name, renamed))
+				}
+			}
+			for _, f := range msg.MapFields {
+				errs = append(errs, warningAt(CodeUnsupportedType, msg.Source, f.Line, f.Column,
+					"%s.%s has unsupported type %s and would be left out of the model", msg.Name, f.Name, f.Type))
+			}
+			for _, f := range msg.Groups {
+				errs = append(errs, warningAt(CodeUnsupportedType, msg.Source, f.Line, f.Column,
+					"%s.%s is a group, which is not supported, and would be left out of the model", msg.Name, f.Name))
+			}
+		}
+	}
+	return errs
+}
+
+// validateCommand sets up `proto2django validate -proto FILE`, which lints
+// the protos for Django compatibility and reports every finding.
+func validateCommand(fs *flag.FlagSet) func() int {
+	var opts Options
+	var protoPaths stringList
+	var outputDir, errorFormat string
+	var quiet bool
+	optionFlags(fs, &opts)
+	fs.Var(&protoPaths, "proto", "Path to a .proto file, or - to read it from stdin (repeatable, comma-separated)")
+	fs.StringVar(&outputDir, "out", "generated_app", "Output directory the app would be generated into, which names it")
+	fs.StringVar(&errorFormat, "error-format", ErrorFormatText, "Error output format: text, logged like warnings, or json, a diagnostic object per line on stderr")
+	fs.BoolVar(&quiet, "quiet", false, "Only log errors")
+	return func() int {
+		logger, err := newLogger(os.Stderr, false, quiet, LogFormatText)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitUsage
+		}
+		slog.SetDefault(logger)
+		if len(protoPaths) == 0 {
+			slog.Error("Please provide a .proto file with -proto flag")
+			return ExitUsage
+		}
+		if err := Validate(protoPaths, outputDir, opts); err != nil {
+			if code := reportError(os.Stderr, err, errorFormat); code != 0 {
+				return code
+			}
+		}
+		slog.Info("protos are valid", "files", len(protoPaths))
+		return 0
+	}
+}
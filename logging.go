@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// Log output formats.
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// newLogger builds the CLI logger. Verbose enables per-message and per-file
+// debug records, quiet suppresses everything below errors, and format selects
+// human-readable text or JSON lines for CI consumption.
+func newLogger(w io.Writer, verbose, quiet bool, format string) (*slog.Logger, error) {
+	if verbose && quiet {
+		return nil, fmt.Errorf("-verbose and -quiet are mutually exclusive")
+	}
+	level := slog.LevelInfo
+	switch {
+	case verbose:
+		level = slog.LevelDebug
+	case quiet:
+		level = slog.LevelError
+	}
+
+	switch format {
+	case "", LogFormatText:
+		// Timestamps are noise for an interactive CLI; JSON keeps them for CI.
+		return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{
+			Level: level,
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				if len(groups) == 0 && a.Key == slog.TimeKey {
+					return slog.Attr{}
+				}
+				return a
+			},
+		})), nil
+	case LogFormatJSON:
+		return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+}
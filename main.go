@@ -1,157 +1,2142 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"text/template"
-
-	"golang.org/x/text/cases"
-	"golang.org/x/text/language"
+	"unicode"
 )
 
-var caser = cases.Title(language.English)
-
 // ProtoMessage represents a parsed protobuf message with its fields.
 type ProtoMessage struct {
-	Name   string
-	Fields []ProtoField
+	Name    string
+	Comment string
+	Fields  []ProtoField
+	Options map[string]string
+	// Source is the .proto path the message was declared in, and Line and
+	// Column the 1-based position of the declaration in it.
+	Source string
+	Line   int
+	Column int
+	// MapFields are the message's map<K, V> fields, which are not generated.
+	MapFields []ProtoField `json:",omitempty"`
+	// Groups are the message's proto2 group fields, which are not generated
+	// either. Their Type is the group's name.
+	Groups []ProtoField `json:",omitempty"`
+	// Reserved lists the field numbers, ranges such as "9 to 11", and names
+	// the message reserves.
+	Reserved []string `json:",omitempty"`
+	// Versions lists the API versions of the packages declaring the message,
+	// oldest first; set by resolveApps.
+	Versions []string `json:",omitempty"`
+	// Enclosing is the dotted path of the messages a nested message is
+	// declared in, outermost first, e.g. Order for Order.Item.
+	Enclosing string `json:",omitempty"`
 }
 
 // ProtoField represents a single field in a protobuf message.
 type ProtoField struct {
 	Name     string
 	Type     string
+	Number   int
 	Repeated bool
+	// Label is the optional or required label the field was declared
+	// with, if any; repeated fields set Repeated instead.
+	Label string `json:",omitempty"`
+	// Line and Column are the 1-based position of the field declaration in
+	// its source file.
+	Line   int
+	Column int
+	// Options holds the field's [...] options flattened to dotted keys.
+	Options map[string]string
+	// Comment is the // comment block directly above the declaration.
+	Comment string
+	// Enum names the enum of the same app the field holds a value of, its
+	// Type then being int32; set by resolveTypes.
+	Enum string `json:",omitempty"`
+	// Oneof names the oneof the field is a member of, if any.
+	Oneof string `json:",omitempty"`
+}
+
+// Field labels besides repeated. Optional fields track presence, in proto2
+// and proto3 alike, and are stored as nullable columns; proto2 required
+// fields must be set.
+const (
+	LabelOptional = "optional"
+	LabelRequired = "required"
+)
+
+// ProtoService represents a parsed protobuf service with its RPC methods.
+type ProtoService struct {
+	Name    string
+	Comment string
+	Options map[string]string
+	Methods []ProtoMethod
+	// Source is the .proto path the service was declared in.
+	Source string
+}
+
+// ProtoMethod represents a single RPC method in a protobuf service.
+type ProtoMethod struct {
+	Name       string
+	Comment    string
+	InputType  string
+	OutputType string
+	// ClientStreaming and ServerStreaming mark `stream` requests and responses.
+	ClientStreaming bool
+	ServerStreaming bool
+	// Options holds the options declared in the RPC body, flattened to
+	// dotted keys like google.api.http.post.
+	Options map[string]string
+}
+
+// ProtoFile holds the package, messages and services parsed from a .proto file.
+type ProtoFile struct {
+	// Sources lists the .proto paths the file was parsed (or merged) from and
+	// SourceHash is the sha256 of their contents.
+	Sources    []string
+	SourceHash string
+	// Syntax is the file's syntax declaration, proto2 or proto3, and empty
+	// when it has none, which protoc reads as proto2.
+	Syntax  string `json:",omitempty"`
+	Package string
+	// Options holds the file's top-level options, such as go_package or
+	// (django.app).label, flattened to dotted keys.
+	Options  map[string]string `json:",omitempty"`
+	Messages []ProtoMessage
+	Enums    []ProtoEnum `json:",omitempty"`
+	Services []ProtoService
+	// Externals maps the labels of existing Django models referenced through
+	// the model map to the modules defining them; set by resolveTypes.
+	Externals map[string]string
+}
+
+// Options controls optional aspects of the generated app.
+type Options struct {
+	// APIs lists the API layers to generate; DRF is used when empty.
+	APIs []string
+	// OpenAPI decorates DRF ViewSets for drf-spectacular and mounts the
+	// schema and Swagger UI views.
+	OpenAPI bool
+	// DjangoVersion is the Django release the dependency manifest targets.
+	DjangoVersion string
+	// Manifest selects the dependency manifest format: requirements or pyproject.
+	Manifest string
+	// AppName is the Django app label; it defaults to the (django.app).name
+	// option of the protos, or else the output directory name.
+	AppName string
+	// SplitPackages generates one app per proto package, named after the
+	// package without its version suffix, beneath the output directory.
+	SplitPackages bool
+	// SplitFiles writes models, serializers and viewsets as packages with
+	// a module per message instead of single modules.
+	SplitFiles bool
+	// Permission is the default comma-separated list of permission classes
+	// applied to every ViewSet not covered by a service-level option.
+	Permission string
+	// RepeatedMessage selects how repeated message fields are stored: as a
+	// ManyToManyField on the parent or a ForeignKey on the child model.
+	RepeatedMessage string
+	// RepeatedScalar selects how repeated scalar fields are stored: as a
+	// Postgres ArrayField, a JSONField or a generated child model.
+	RepeatedScalar string
+	// EnumUnspecified selects how the unspecified zero value of enums is
+	// stored: as a choice or as NULL.
+	EnumUnspecified string
+	// JSONCase selects the naming of the REST API's JSON fields: snake,
+	// camel or djangorestframework-camel-case.
+	JSONCase string
+	// StrField names the field returned by __str__ on models that declare it
+	// and have no (django.str_field) option of their own.
+	StrField string
+	// PrimaryKey selects the primary key of generated models: auto for
+	// Django's default auto-incrementing id, or uuid.
+	PrimaryKey string
+	// BaseModel makes generated models inherit from an abstract BaseModel
+	// carrying created_at/updated_at audit timestamps.
+	BaseModel bool
+	// SoftDelete adds is_deleted/deleted_at to generated models, hides
+	// deleted rows from the default manager and makes deletes through the
+	// generated APIs soft.
+	SoftDelete bool
+	// Search adds a Postgres full-text search vector over the string fields
+	// of each model, and a ?search= filter to their ViewSets.
+	Search bool
+	// History tracks changes to generated models with django-simple-history
+	// and shows them in the admin.
+	History bool
+	// Signals scaffolds signals.py with receiver stubs and connects it from
+	// AppConfig.ready().
+	Signals bool
+	// GeoDjango stores google.type.LatLng fields as GeoDjango PointFields
+	// instead of JSON.
+	GeoDjango bool
+	// DjangoMoney stores google.type.Money fields as django-money
+	// MoneyFields instead of a DecimalField plus a currency column.
+	DjangoMoney bool
+	// OmitDeprecated leaves fields declared with [deprecated = true] out of
+	// the generated serializers.
+	OmitDeprecated bool
+	// ReadOnly generates APIs that only read the models, for data owned by
+	// another service: ReadOnlyModelViewSets, serializers whose fields are
+	// all read-only, and no write routes or mutations.
+	ReadOnly bool
+	// EmitIR is the path of a JSON dump of the parsed protos, their Django
+	// mappings and the files generated for them; empty disables it.
+	EmitIR string
+	// ModelMap is the path of a JSON file mapping proto messages onto
+	// existing Django models, which are referenced instead of generated.
+	ModelMap string
+	// GRPC generates clients.py with wrappers around the grpcio stubs of the
+	// parsed services, and sync management commands for models served by a
+	// List RPC.
+	GRPC bool
+	// GRPCPackage is the Python package containing the protoc-generated
+	// _pb2 modules; empty when they are importable at the top level.
+	GRPCPackage string
+	// GRPCServer generates servicers.py with a servicer per parsed service,
+	// handlers.py and grpc_settings.py registering them on
+	// django-socio-grpc's server, and a grpcserver command running it.
+	GRPCServer bool
+	// Celery generates tasks.py with a shared_task per unary RPC calling the
+	// service through clients.py, which it implies.
+	Celery bool
+	// Channels generates consumers.py and routing.py relaying streaming RPCs
+	// over WebSockets through clients.py, which it implies.
+	Channels bool
+	// Seed generates a seed_<app> management command creating sample rows
+	// of every model.
+	Seed bool
+	// Templates is a directory of templates replacing the built-in ones of
+	// the files they are named after.
+	Templates string
+	// Format is the format of the -proto inputs: FormatProto source, the
+	// default, or FormatDescriptor sets.
+	Format string
+	// Jobs bounds the proto files parsed, apps generated and files rendered
+	// concurrently; zero uses every CPU.
+	Jobs int
+	// Cache skips generation when the inputs and options match an earlier
+	// run whose output is still in place, keeping results in CacheDir
+	// (default ~/.cache/proto2django).
+	Cache    bool
+	CacheDir string
+	// ProjectRoot is the directory of an existing Django project the app
+	// is generated into; its settings and root URLconf are edited to
+	// install the app and include its URLs.
+	ProjectRoot string
+	// Merge adds the definitions generated for new messages to the Python
+	// modules of an existing app, keeping the definitions they already
+	// have, instead of regenerating them whole.
+	Merge bool
+	// Typed annotates generated serializers, ViewSets and converters for
+	// mypy with django-stubs and marks the app with py.typed.
+	Typed bool
+	// StringMaxLength is the max_length of string CharFields without a
+	// string.max_len rule; zero uses DefaultStringMaxLength.
+	StringMaxLength int
+	// TextThreshold stores string fields whose max_len rule exceeds it as
+	// TextFields; zero keeps them CharFields.
+	TextThreshold int
+	// StringHeuristics stores string fields named like emails, URLs and
+	// slugs as EmailFields, URLFields and SlugFields.
+	StringHeuristics bool
+	// DecimalHeuristics stores double, float and string fields named like
+	// amounts and prices as DecimalFields.
+	DecimalHeuristics bool
+	// DryRun plans the app, as reported by -emit-ir, without writing files.
+	DryRun bool
+	// Strict turns references to undefined message types into errors instead
+	// of falling back to a ForeignKey on a model that may not exist.
+	Strict bool
+	// Include and Exclude are glob patterns matched against message names;
+	// when Include is empty every message not excluded is generated.
+	Include []string
+	Exclude []string
+	// Layers are GLOB=LAYERS rules choosing the layers generated for the
+	// messages whose name matches, unless their (django.meta).layers option
+	// does; the first matching rule applies.
+	Layers []string
+	// NullableScalars makes singular scalar fields null=True, blank=True,
+	// for schemas backfilled from data that may lack them.
+	NullableScalars bool
+	// BlankStrings lets string fields be blank in forms and serializers.
+	BlankStrings bool
+	// OnDelete is the on_delete policy of singular relations without a
+	// (django.field).on_delete option: CASCADE, PROTECT, SET_NULL or
+	// SET_DEFAULT. Child foreign keys of repeated message fields always
+	// cascade with their parent.
+	OnDelete string
+	// OneToOne are glob patterns matched against the names of singular
+	// message fields, such as profile, stored as OneToOneFields rather than
+	// ForeignKeys unless their (django.field).relation option says otherwise.
+	OneToOne []string
+}
+
+// skipOption is the message option that keeps a message out of the app.
+const skipOption = "django.skip"
+
+// selectMessages applies the include/exclude patterns and (django.skip)
+// options, returning the messages to generate and the names left out.
+func selectMessages(messages []ProtoMessage, opts Options) ([]ProtoMessage, map[string]bool, error) {
+	var kept []ProtoMessage
+	skipped := map[string]bool{}
+	for _, msg := range messages {
+		include := len(opts.Include) == 0
+		for _, pattern := range opts.Include {
+			ok, err := path.Match(pattern, msg.Name)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid include pattern %q: %w", pattern, err)
+			}
+			include = include || ok
+		}
+		for _, pattern := range opts.Exclude {
+			ok, err := path.Match(pattern, msg.Name)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
+			}
+			include = include && !ok
+		}
+		if !include || msg.Options[skipOption] == "true" {
+			slog.Debug("skipping message", "message", msg.Name)
+			skipped[msg.Name] = true
+			continue
+		}
+		kept = append(kept, msg)
+	}
+	return kept, skipped, nil
+}
+
+// Primary key strategies.
+const (
+	PrimaryKeyAuto = "auto"
+	PrimaryKeyUUID = "uuid"
+)
+
+// pkOption is the message option overriding Options.PrimaryKey for one message.
+const pkOption = "django.pk"
+
+// primaryKey returns the primary key strategy for msg.
+func primaryKey(msg ProtoMessage, opts Options) (string, error) {
+	pk := opts.PrimaryKey
+	if v, ok := msg.Options[pkOption]; ok {
+		pk = v
+	}
+	switch pk {
+	case "", PrimaryKeyAuto:
+		return PrimaryKeyAuto, nil
+	case PrimaryKeyUUID:
+		return PrimaryKeyUUID, nil
+	}
+	return "", fmt.Errorf("%s: unknown primary key strategy %q", msg.Name, pk)
+}
+
+// baseModelOption is the message option overriding Options.BaseModel for
+// one message.
+const baseModelOption = "django.base_model"
+
+// auditFields are the timestamps declared on the abstract BaseModel.
+var auditFields = []string{"created_at", "updated_at"}
+
+// baseModel reports whether msg inherits from the abstract BaseModel. A
+// message declaring an audit field of its own keeps models.Model, since
+// Django does not allow a field to shadow an inherited one.
+func baseModel(msg ProtoMessage, fields []RenderedField, opts Options) bool {
+	enabled := opts.BaseModel
+	switch msg.Options[baseModelOption] {
+	case "true":
+		enabled = true
+	case "false":
+		enabled = false
+	}
+	if !enabled {
+		return false
+	}
+	for _, name := range auditFields {
+		if hasField(fields, name) {
+			slog.Warn("message declares an audit field, not inheriting BaseModel", "message", msg.Name, "field", name)
+			return false
+		}
+	}
+	return true
+}
+
+// softDeleteAttributes are the names the soft-delete pattern adds to a model.
+var softDeleteAttributes = []string{"is_deleted", "deleted_at", "all_objects", "soft_delete"}
+
+// softDelete reports whether the model for msg gets the soft-delete pattern.
+// Messages declaring one of its attributes keep hard deletes.
+func softDelete(msg ProtoMessage, fields []RenderedField, opts Options) bool {
+	if !opts.SoftDelete {
+		return false
+	}
+	for _, name := range softDeleteAttributes {
+		if hasField(fields, name) {
+			slog.Warn("message declares a soft-delete attribute, keeping hard deletes", "message", msg.Name, "field", name)
+			return false
+		}
+	}
+	return true
+}
+
+// deprecationNote is the help_text of a deprecated field: its comment, or a
+// generic notice when it has none.
+func deprecationNote(comment string) string {
+	if comment == "" {
+		return "Deprecated."
+	}
+	return "Deprecated: " + strings.Join(strings.Fields(comment), " ")
 }
 
+// Supported API layers.
+const (
+	APIDRF     = "drf"
+	APIGraphQL = "graphql"
+	APINinja   = "ninja"
+)
+
+// Dependency manifest formats.
+const (
+	ManifestRequirements = "requirements"
+	ManifestPyproject    = "pyproject"
+)
+
+// Strategies for repeated message fields.
+const (
+	RepeatedMessageM2M = "m2m"
+	RepeatedMessageFK  = "fk"
+)
+
+// Strategies for repeated scalar fields.
+const (
+	RepeatedScalarArray = "arrayfield"
+	RepeatedScalarJSON  = "jsonfield"
+	RepeatedScalarChild = "child-table"
+)
+
 // RenderedField represents a Django-compatible field derived from a protobuf field.
 type RenderedField struct {
-	Name       string
-	Type       string
-	Repeated   bool
-	DjangoType string
+	Name           string
+	ProtoName      string
+	Type           string
+	Repeated       bool
+	DjangoType     string
+	SerializerType string
+	// MaxLength is the max_length of a string field, zero for none, and
+	// Validators carry its (buf.validate.field) constraints.
+	MaxLength  int
+	Validators []string
+	// ReadOnly and Immutable mirror OUTPUT_ONLY and IMMUTABLE field behaviors.
+	ReadOnly  bool
+	Immutable bool
+	// Deprecated is set for fields declared with [deprecated = true].
+	Deprecated bool
+	// Default is the Python literal of the field's declared default.
+	Default string
+	// Synthetic is set for fields with no proto field of their own, such as
+	// a child table's parent key or a Money amount's currency.
+	Synthetic bool
+	// Optional is set for fields declared optional, whose unset value is
+	// stored as NULL.
+	Optional bool
+	// Enum is the choices class of an enum field and ZeroNull is set when
+	// its unspecified value is stored as NULL.
+	Enum     string
+	ZeroNull bool
+	// Oneof names the oneof the field is a member of, if any.
+	Oneof string
+	// JSONName is the name serializers expose the field under: its proto
+	// name, unless -json-case says otherwise.
+	JSONName string
+	// RelatedUUID is set for relations to a model with a UUID primary key.
+	RelatedUUID bool
 }
 
 // RenderedMessage is a Django-compatible message ready for template rendering.
 type RenderedMessage struct {
+	Name              string
+	ProtoName         string
+	Description       string
+	Fields            []RenderedField
+	Renamed           []string
+	PermissionClasses []string
+	StrField          string
+	RoutePrefix       string
+	SnakeName         string
+	PluralName        string
+	SchemaDecorators  []string
+	FieldNumbers      []FieldNumber
+	// ThrottleScope and Authentication are the throttle scope and
+	// authentication classes of the model's ViewSet, set by its service.
+	ThrottleScope  string
+	Authentication []string
+	// Base is the class the model inherits from.
+	Base string
+	// UUIDPrimaryKey replaces the auto-incrementing id with a UUID.
+	UUIDPrimaryKey bool
+	// SoftDelete marks rows deleted instead of removing them.
+	SoftDelete bool
+	// InputFields are the fields accepted by create and update APIs.
+	InputFields []RenderedField
+	// ReadOnlyFields and ImmutableFields list serializer field names; the
+	// former only covers fields the serializer does not declare itself.
+	ReadOnlyFields  []string
+	ImmutableFields []string
+	// ImmutableAttrs lists the model attributes of immutable fields.
+	ImmutableAttrs []string
+	// History is the attribute of the model's HistoricalRecords, when its
+	// changes are recorded.
+	History string
+	// SearchFields are the fields whose text the search_vector of -search
+	// indexes.
+	SearchFields []string
+	// Indexes and Constraints are the Python expressions of the model's
+	// Meta.indexes and Meta.constraints.
+	Indexes     []string
+	Constraints []string
+	// DBTable is the model's Meta.db_table, and Unmanaged is set when it
+	// maps an existing table that Django neither creates nor migrates.
+	DBTable   string
+	Unmanaged bool
+	// Layers are the layers generated for the model: model, admin and api.
+	Layers []string
+	// Actions are the custom routes added to the model's ViewSet.
+	Actions []RenderedAction
+	// LookupField is the model field a google.api.resource is looked up by.
+	LookupField string
+	// Router is the router the ViewSet registers on. Nested resources name
+	// their parent by index into the app's messages, the URL kwarg holding
+	// its lookup value, their ForeignKey to it and the queryset filters on
+	// the URL kwargs of it and its own ancestors.
+	Router        string
+	NestedParent  int
+	ParentKwarg   string
+	ParentField   string
+	ParentFilters []string
+	// SerializerExclude lists the model fields the serializer leaves out:
+	// renamed fields it redeclares and omitted deprecated ones.
+	SerializerExclude []string
+	// ListDisplay lists the columns of the model's admin changelist.
+	ListDisplay []string
+	// Versions are the API versions serving the model, under whose URL
+	// namespaces its ViewSet is registered.
+	Versions []string
+}
+
+// FieldNumber records the proto field number behind a model attribute.
+type FieldNumber struct {
 	Name   string
-	Fields []RenderedField
+	Number int
 }
 
 // TemplateData holds the overall context passed to the templates.
 type TemplateData struct {
-	AppName  string
-	AppTitle string
-	Messages []RenderedMessage
+	AppName           string
+	AppTitle          string
+	Sources           []string
+	SourceHash        string
+	APIs              map[string]bool
+	OpenAPI           bool
+	Requirements      []string
+	Messages          []RenderedMessage
+	ModelImports      []string
+	RelatedImports    []string
+	PermissionImports []string
+	CustomPermissions []string
+	// AuthenticationImports import the authentication classes of services.
+	AuthenticationImports []string
+	// TokenAuthentication is set when a service authenticates by token,
+	// which needs rest_framework.authtoken installed.
+	TokenAuthentication bool
+	// ThrottleScopes are the throttle scopes declared by the services.
+	ThrottleScopes []ThrottleScope
+	// Enums are the choices classes of the enums, rendered into models.py.
+	Enums []RenderedEnum
+	// CamelCasePackage renders and parses the ViewSets' JSON with
+	// djangorestframework-camel-case.
+	CamelCasePackage bool
+	// AppModule is the dotted module of the app, its name unless it is
+	// generated inside a -project-root.
+	AppModule string
+	// AppVerboseName is the app's title in the admin, empty for Django's
+	// default, and URLPrefix the path its URLs are included at, e.g.
+	// billing/.
+	AppVerboseName string
+	URLPrefix      string
+	// Dependencies are the labels of the other generated apps whose models
+	// the app's models reference, which its migrations depend on.
+	Dependencies []string
+	// BaseModel is set when any model inherits from the abstract BaseModel.
+	BaseModel bool
+	// UUID is set when any model has a UUID primary key.
+	UUID bool
+	// SoftDelete is set when any model uses soft deletes.
+	SoftDelete bool
+	// Search is set when any model has a full-text search vector.
+	Search bool
+	// History is set when models record their history.
+	History bool
+	// Typed adds type annotations to the generated code.
+	Typed bool
+	// ReadOnly leaves the write paths out of the generated APIs.
+	ReadOnly bool
+	// APIMessages and AdminMessages are the models generated with the api
+	// and admin layers, rendered into the API files and admin.py.
+	APIMessages   []RenderedMessage
+	AdminMessages []RenderedMessage
+	// Signals imports signals.py when the app is ready.
+	Signals bool
+	// Actions is set when any ViewSet has custom routes from actions.py.
+	Actions bool
+	// RequestSerializers validate the bodies of RPC actions.
+	RequestSerializers []RenderedRequestSerializer
+	// NestedRouters register the children of google.api.resource parents.
+	NestedRouters []NestedRouter
+	// Versions are the API versions of the app's proto packages, oldest
+	// first, and Routers the routers of urls.py, one per version.
+	Versions []string
+	Routers  []APIRouter
+	// Clients are the gRPC client wrappers rendered into clients.py, which
+	// imports the protoc-generated modules in GRPCImports.
+	Clients     []RenderedClient
+	GRPCImports []string
+	// Servicers are the services served by servicers.py, whose protoc
+	// generated _pb2_grpc modules are imported by ServicerImports.
+	Servicers       []RenderedClient
+	ServicerImports []string
+	// Tasks are the Celery tasks rendered into tasks.py.
+	Tasks       []RenderedTask
+	TaskImports []string
+	// SyncCommands are the management commands syncing models from List RPCs.
+	SyncCommands []RenderedSync
+	// Seed is the management command creating sample rows, with -seed.
+	Seed *RenderedSeed
+	// Consumers are the Channels consumers rendered into consumers.py.
+	Consumers       []RenderedConsumer
+	ConsumerImports []string
+	// Converters are the converters.py functions between models and
+	// protobuf messages, which import ConverterImports.
+	Converters       []RenderedConverter
+	ConverterImports []string
+	// ConvertsDecimals is set when converters convert DecimalFields.
+	ConvertsDecimals bool
+	// RoundTrips are the tests.py cases converting models to protobuf
+	// messages and back.
+	RoundTrips       []RenderedRoundTrip
+	RoundTripImports []string
 }
 
 // PythonType maps a protobuf type to a Django model field.
 func PythonType(protoType string) string {
 	switch protoType {
-	case "int32", "int64":
+	case "int32", "sint32", "sfixed32":
 		return "models.IntegerField()"
+	case "int64", "sint64", "sfixed64":
+		return "models.BigIntegerField()"
+	case "uint32", "uint64", "fixed32", "fixed64":
+		// PositiveBigIntegerField is signed in most databases: uint64 and
+		// fixed64 values above 2^63-1 do not fit.
+		return "models.PositiveBigIntegerField()"
 	case "string":
 		return "models.CharField(max_length=255)"
+	case "bytes":
+		return "models.BinaryField()"
 	case "bool":
 		return "models.BooleanField()"
 	case "float", "double":
 		return "models.FloatField()"
+	case dateType:
+		return "models.DateField()"
+	case timestampType:
+		return "models.DateTimeField()"
+	case moneyType:
+		return "models.DecimalField(max_digits=19, decimal_places=2)"
+	case latLngType:
+		return "models.JSONField()"
 	default:
-		return "models.ForeignKey(" + protoType + ", on_delete=models.CASCADE)"
+		// Lazy string references resolve once the app registry is ready, so
+		// forward and circular references work regardless of message order.
+		return "models.ForeignKey('" + protoType + "', on_delete=models.CASCADE)"
+	}
+}
+
+// SerializerType maps a rendered field to the explicit DRF serializer field
+// declared when its proto name differs from the model field name.
+func SerializerType(f RenderedField, owner string) string {
+	source := "source='" + f.Name + "'"
+	if f.ReadOnly {
+		source = "read_only=True, " + source
+	}
+	// Declared fields do not inherit null and blank from the model field.
+	var optional string
+	switch {
+	case f.ReadOnly:
+	case strings.Contains(f.DjangoType, "null=True"):
+		optional = "allow_null=True, required=False, "
+	case strings.Contains(f.DjangoType, "blank=True"):
+		optional = "required=False, "
+	}
+	if f.Type == "string" && !f.Repeated && !f.ReadOnly && strings.Contains(f.DjangoType, "blank=True") {
+		optional = "allow_blank=True, " + optional
+	}
+	if f.Default != "" {
+		source = "default=" + f.Default + ", " + source
+	}
+	if len(f.Validators) > 0 {
+		// Declared fields do not inherit model validators; reuse the model's.
+		source = "validators=" + pascalCase(owner) + "._meta.get_field('" + f.Name + "').validators, " + source
+	}
+	if !isScalar(f.Type) {
+		queryset := "queryset=" + modelClass(f.Type) + ".objects.all(), "
+		if f.Type == authUserModel {
+			queryset = "queryset=get_user_model().objects.all(), "
+		}
+		switch {
+		case f.Repeated:
+			return "serializers.PrimaryKeyRelatedField(many=True, " + queryset + optional + source + ")"
+		case f.Type == owner:
+			return "serializers.PrimaryKeyRelatedField(" + queryset + "allow_null=True, required=False, " + source + ")"
+		default:
+			return "serializers.PrimaryKeyRelatedField(" + queryset + optional + source + ")"
+		}
+	}
+	var field string
+	switch f.Type {
+	case "int32", "int64", "sint32", "sint64", "sfixed32", "sfixed64":
+		field = "serializers.IntegerField("
+	case "uint32", "uint64", "fixed32", "fixed64":
+		field = "serializers.IntegerField(min_value=0, "
+	case "string":
+		field = "serializers." + stringSerializerClass(f.DjangoType) + "("
+		if f.MaxLength > 0 {
+			field += "max_length=" + strconv.Itoa(f.MaxLength) + ", "
+		}
+	case "bytes":
+		// DRF has no binary field; ModelField defers to the model field itself.
+		field = "serializers.ModelField(model_field=" + pascalCase(owner) + "._meta.get_field('" + f.Name + "'), "
+	case "bool":
+		field = "serializers.BooleanField("
+	case "float", "double":
+		field = "serializers.FloatField("
+	case dateType:
+		field = "serializers.DateField("
+	case timestampType:
+		field = "serializers.DateTimeField("
+	case moneyType:
+		field = "serializers.DecimalField(max_digits=19, decimal_places=2, "
+	case latLngType:
+		field = "serializers.JSONField("
+		if isPointField(f) {
+			field = "serializers.ModelField(model_field=" + pascalCase(owner) + "._meta.get_field('" + f.Name + "'), "
+		}
+	}
+	if isDecimalField(f) {
+		field = "serializers.DecimalField(" + decimalArgsRe.FindString(f.DjangoType) + ", "
+	}
+	if f.Enum != "" {
+		field = "serializers.ChoiceField(choices=" + f.Enum + ".choices, "
+	}
+	if f.Repeated {
+		return "serializers.ListField(child=" + strings.TrimSuffix(field, ", ") + "), " + optional + source + ")"
+	}
+	return field + optional + source + ")"
+}
+
+// isScalar reports whether protoType is stored in the model's own columns:
+// a proto scalar or one of the google.type values, rather than a reference to
+// another model.
+func isScalar(protoType string) bool {
+	switch protoType {
+	case "int32", "int64", "uint32", "uint64", "sint32", "sint64",
+		"fixed32", "fixed64", "sfixed32", "sfixed64",
+		"string", "bytes", "bool", "float", "double",
+		dateType, timestampType, moneyType, latLngType:
+		return true
+	}
+	return false
+}
+
+// childForeignKey builds the ForeignKey placed on the element type of a
+// repeated message field, pointing back at the parent message.
+func childForeignKey(parent string, f ProtoField) RenderedField {
+	relatedName := snakeCase(f.Name)
+	if f.Type == parent {
+		return RenderedField{
+			Name:       "parent",
+			ProtoName:  "parent",
+			Type:       parent,
+			DjangoType: "models.ForeignKey('self', on_delete=models.CASCADE, null=True, blank=True, related_name='" + relatedName + "')",
+			Synthetic:  true,
+		}
+	}
+	name := snakeCase(parent)
+	return RenderedField{
+		Name:       name,
+		ProtoName:  name,
+		Type:       parent,
+		DjangoType: "models.ForeignKey('" + pascalCase(parent) + "', on_delete=models.CASCADE, related_name='" + relatedName + "')",
+		Synthetic:  true,
+	}
+}
+
+// selfReference renders a field pointing at the model that declares it.
+// Singular references are nullable so the root of a hierarchy can exist, and
+// repeated ones are asymmetric to keep proto's one-directional semantics.
+func selfReference(f ProtoField) string {
+	if f.Repeated {
+		return "models.ManyToManyField('self', symmetrical=False)"
+	}
+	return "models.ForeignKey('self', on_delete=models.CASCADE, null=True, blank=True)"
+}
+
+// scalarChildModel builds the model storing one row per value of a repeated
+// scalar field as djangoType, linked back to its parent through related_name.
+func scalarChildModel(parent string, f ProtoField, djangoType string) RenderedMessage {
+	return RenderedMessage{
+		Name: pascalCase(parent) + pascalCase(f.Name),
+		Fields: []RenderedField{
+			childForeignKey(parent, f),
+			{Name: "value", ProtoName: "value", Type: f.Type, DjangoType: djangoType},
+		},
+	}
+}
+
+// pascalCase converts a snake_case or camelCase identifier to PascalCase,
+// leaving acronyms such as HTTP intact.
+func pascalCase(name string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(name, "_") {
+		if part != "" {
+			b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+	return b.String()
+}
+
+// snakeCase converts a camelCase or PascalCase identifier to snake_case,
+// treating runs of capitals as a single word (HTTPCode becomes http_code).
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 && runes[i-1] != '_' {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteRune('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// strFieldOption is the message option choosing the field returned by __str__.
+const strFieldOption = "django.str_field"
+
+// strField picks the field returned by a model's __str__: the first preferred
+// name present on the model, else its first singular string field, else pk.
+func strField(fields []RenderedField, preferred ...string) string {
+	for _, name := range preferred {
+		if name != "" && hasField(fields, name) {
+			return name
+		}
+	}
+	for _, f := range fields {
+		if f.Type == "string" && !f.Repeated {
+			return f.Name
+		}
+	}
+	return "pk"
+}
+
+// pythonKeywords are the hard keywords that can never be used as identifiers.
+var pythonKeywords = map[string]bool{
+	"False": true, "None": true, "True": true, "and": true, "as": true,
+	"assert": true, "async": true, "await": true, "break": true, "class": true,
+	"continue": true, "def": true, "del": true, "elif": true, "else": true,
+	"except": true, "finally": true, "for": true, "from": true, "global": true,
+	"if": true, "import": true, "in": true, "is": true, "lambda": true,
+	"nonlocal": true, "not": true, "or": true, "pass": true, "raise": true,
+	"return": true, "try": true, "while": true, "with": true, "yield": true,
+}
+
+// modelAttributes are names every Django model already defines, plus the
+// managers module that generated class bodies refer to.
+var modelAttributes = map[string]bool{
+	"managers": true,
+	"id":       true, "pk": true, "objects": true, "save": true, "delete": true,
+	"clean": true, "full_clean": true, "clean_fields": true, "validate_unique": true,
+	"refresh_from_db": true, "from_db": true, "check": true, "save_base": true,
+	"serializable_value": true, "get_deferred_fields": true, "Meta": true,
+	"DoesNotExist": true, "MultipleObjectsReturned": true,
+}
+
+// sanitizeFieldName makes name usable as a Django model field. Reserved names
+// get a _field suffix, since Django rejects field names ending in an
+// underscore, and double underscores collapse because Django uses them as the
+// lookup separator. The reason is empty when the name needed no change.
+func sanitizeFieldName(name string) (string, string) {
+	if pythonKeywords[name] || modelAttributes[name] {
+		return name + "_field", "is a reserved name"
+	}
+	clean := name
+	for strings.Contains(clean, "__") {
+		clean = strings.ReplaceAll(clean, "__", "_")
+	}
+	clean = strings.TrimRight(clean, "_")
+	if clean != name {
+		return clean, "contains a double or trailing underscore"
+	}
+	return name, ""
+}
+
+// routePrefixOption is the message option overriding the generated router prefix.
+const routePrefixOption = "django.route_prefix"
+
+// irregularPlurals covers common nouns whose plural is not formed by a suffix.
+var irregularPlurals = map[string]string{
+	"person": "people",
+	"child":  "children",
+	"man":    "men",
+	"woman":  "women",
+	"mouse":  "mice",
+	"datum":  "data",
+}
+
+// pluralize returns the English plural of a lowercase noun.
+func pluralize(word string) string {
+	if plural, ok := irregularPlurals[word]; ok {
+		return plural
 	}
+	switch {
+	case strings.HasSuffix(word, "s"), strings.HasSuffix(word, "x"), strings.HasSuffix(word, "z"),
+		strings.HasSuffix(word, "ch"), strings.HasSuffix(word, "sh"):
+		return word + "es"
+	case strings.HasSuffix(word, "y") && len(word) > 1 && !strings.ContainsRune("aeiou", rune(word[len(word)-2])):
+		return word[:len(word)-1] + "ies"
+	}
+	return word + "s"
+}
+
+// routePrefix derives a REST-style router prefix from a model class name,
+// pluralizing its last word and joining words with dashes (UserProfile
+// becomes user-profiles).
+func routePrefix(className string) string {
+	words := strings.Split(snakeCase(className), "_")
+	words[len(words)-1] = pluralize(words[len(words)-1])
+	return strings.Join(words, "-")
+}
+
+// pluralName returns the snake_case plural used for collection accessors,
+// falling back to a _list suffix when the noun's plural equals its singular.
+func pluralName(className string) string {
+	plural := strings.ReplaceAll(routePrefix(className), "-", "_")
+	if plural == snakeCase(className) {
+		plural += "_list"
+	}
+	return plural
+}
+
+// identifierRe matches a valid (ASCII) Python identifier.
+var identifierRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// validateAppName checks that name can be used as a Python package and Django app label.
+func validateAppName(name string) error {
+	if !identifierRe.MatchString(name) || pythonKeywords[name] {
+		return errorAt(CodeInvalidAppName, "", 0, 0, "app name %q is not a valid Python identifier; set one with -app-name", name)
+	}
+	return nil
+}
+
+// addKwarg appends a keyword argument to a rendered field constructor call.
+func addKwarg(expr, kwarg string) string {
+	if strings.HasSuffix(expr, "()") {
+		return strings.TrimSuffix(expr, ")") + kwarg + ")"
+	}
+	return strings.TrimSuffix(expr, ")") + ", " + kwarg + ")"
+}
+
+// hasField reports whether a field with the given name is already present.
+func hasField(fields []RenderedField, name string) bool {
+	for _, f := range fields {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// protoHasField reports whether the message declares a field with the given name.
+func protoHasField(msg ProtoMessage, name string) bool {
+	for _, f := range msg.Fields {
+		if snakeCase(f.Name) == name {
+			return true
+		}
+	}
+	return false
 }
 
-// ParseProto reads and parses the .proto file into structured messages and fields.
-func ParseProto(protoPath string) ([]ProtoMessage, error) {
-	data, err := os.ReadFile(protoPath)
+var (
+	messageRe  = regexp.MustCompile(`(?m)message\s+(\w+)\s*{`)
+	fieldRe    = regexp.MustCompile(`(?m)(?:(repeated|optional|required)\s+)?([\w.]+)\s+(\w+)\s*=\s*(\d+)`)
+	mapFieldRe = regexp.MustCompile(`map\s*<\s*([\w.]+)\s*,\s*([\w.]+)\s*>\s*(\w+)\s*=\s*(\d+)`)
+	packageRe  = regexp.MustCompile(`(?m)^\s*package\s+([\w.]+)\s*;`)
+	syntaxRe   = regexp.MustCompile(`(?m)^\s*syntax\s*=\s*["'](\w+)["']\s*;`)
+)
+
+// stdinPath is the -proto path reading the input from stdin, and stdinName
+// the source name it is parsed under.
+const (
+	stdinPath = "-"
+	stdinName = "stdin.proto"
+)
+
+// ParseProto reads and parses the .proto file into structured messages,
+// fields and services; the path - reads it from stdin.
+func ParseProto(protoPath string) (*ProtoFile, error) {
+	var r io.Reader = os.Stdin
+	name := stdinName
+	if protoPath != stdinPath {
+		f, err := os.Open(protoPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read proto file: %w", err)
+		}
+		defer f.Close()
+		r, name = f, protoPath
+	}
+	file, err := parseProtoReader(r, name)
+	var d *Diagnostic
+	if errors.As(err, &d) {
+		return nil, err
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to read proto file: %w", err)
 	}
-	text := string(data)
+	return file, nil
+}
 
-	messageRe := regexp.MustCompile(`(?m)message\s+(\w+)\s*{([^}]*)}`)
-	fieldRe := regexp.MustCompile(`(?m)(repeated\s+)?(\w+)\s+(\w+)\s*=\s*\d+`)
+// parseProtoReader parses a .proto source named name one top-level
+// declaration at a time, so that only the declaration being parsed is held
+// in memory rather than the whole source.
+func parseProtoReader(r io.Reader, name string) (*ProtoFile, error) {
+	file := &ProtoFile{Sources: []string{name}}
+	hash := sha256.New()
+	err := scanDecls(io.TeeReader(r, hash), name, func(decl string, line, column int) {
+		parseDecl(file, decl, line, column)
+	})
+	if err != nil {
+		return nil, err
+	}
+	file.SourceHash = hex.EncodeToString(hash.Sum(nil))
+	return file, nil
+}
 
-	matches := messageRe.FindAllStringSubmatch(text, -1)
-	var messages []ProtoMessage
+// parseDecl adds the package, messages, enums and services of one top-level
+// declaration, with its leading comments, starting at the given line and
+// column.
+func parseDecl(file *ProtoFile, text string, line, column int) {
+	source := file.Sources[0]
+	lineOf := func(offset int) int {
+		return line + lineAt(text, offset) - 1
+	}
+	columnOf := func(offset int) int {
+		if i := strings.LastIndexByte(text[:offset], '\n'); i >= 0 {
+			return offset - i
+		}
+		return column + offset
+	}
+	if m := packageRe.FindStringSubmatch(text); m != nil && file.Package == "" {
+		file.Package = m[1]
+	}
+	if m := syntaxRe.FindStringSubmatch(text); m != nil && file.Syntax == "" {
+		file.Syntax = m[1]
+	}
+	file.Options = mergeOptions(file.Options, parseOptionList(optionStatements(text)))
 
-	for _, match := range matches {
-		msgName := match[1]
-		msgBody := match[2]
-		fieldMatches := fieldRe.FindAllStringSubmatch(msgBody, -1)
+	locs := messageRe.FindAllStringSubmatchIndex(text, -1)
+	for _, loc := range locs {
+		msgName := text[loc[2]:loc[3]]
+		// Messages are matched in order, so those enclosing this one come
+		// first, outermost first.
+		var enclosing []string
+		for _, outer := range locs {
+			if outer[0] >= loc[0] {
+				break
+			}
+			if end := bracketEnd(text, outer[1]-1); end < 0 || end > loc[0] {
+				enclosing = append(enclosing, text[outer[2]:outer[3]])
+			}
+		}
+		bodyStart := loc[1]
+		msgBody, groupMatches := blankGroups(blankNested(blockBody(text, loc[1]-1)))
+		fieldMatches := fieldRe.FindAllStringSubmatchIndex(msgBody, -1)
+		oneof := oneofAt(msgBody)
 
 		var fields []ProtoField
+		end := 0
 		for _, f := range fieldMatches {
-			repeated := strings.TrimSpace(f[1]) == "repeated"
-			typ := f[2]
-			name := f[3]
-			fields = append(fields, ProtoField{Name: name, Type: typ, Repeated: repeated})
+			// Skip look-alikes inside the previous field's option list.
+			if f[0] < end {
+				continue
+			}
+			var label string
+			if f[2] >= 0 {
+				label = msgBody[f[2]:f[3]]
+			}
+			repeated := label == "repeated"
+			if repeated {
+				label = ""
+			}
+			typ := msgBody[f[4]:f[5]]
+			name := msgBody[f[6]:f[7]]
+			number, _ := strconv.Atoi(msgBody[f[8]:f[9]])
+			var options string
+			options, end = fieldOptionsText(msgBody, f[1])
+			fields = append(fields, ProtoField{
+				Name:     name,
+				Type:     typ,
+				Number:   number,
+				Repeated: repeated,
+				Label:    label,
+				Line:     lineOf(bodyStart + f[4]),
+				Column:   columnOf(bodyStart + f[4]),
+				Options:  parseOptionList(options),
+				Comment:  leadingComment(text, bodyStart+f[0]),
+				Oneof:    oneof(f[0]),
+			})
+		}
+		var mapFields []ProtoField
+		for _, f := range mapFieldRe.FindAllStringSubmatchIndex(msgBody, -1) {
+			number, _ := strconv.Atoi(msgBody[f[8]:f[9]])
+			mapFields = append(mapFields, ProtoField{
+				Name:   msgBody[f[6]:f[7]],
+				Type:   "map<" + msgBody[f[2]:f[3]] + ", " + msgBody[f[4]:f[5]] + ">",
+				Number: number,
+				Line:   lineOf(bodyStart + f[0]),
+				Column: columnOf(bodyStart + f[0]),
+			})
+		}
+		var groups []ProtoField
+		for _, g := range groupMatches {
+			number, _ := strconv.Atoi(text[bodyStart+g[6] : bodyStart+g[7]])
+			var label string
+			if g[2] >= 0 {
+				label = text[bodyStart+g[2] : bodyStart+g[3]]
+			}
+			repeated := label == "repeated"
+			if repeated {
+				label = ""
+			}
+			groups = append(groups, ProtoField{
+				Name:     strings.ToLower(text[bodyStart+g[4] : bodyStart+g[5]]),
+				Type:     text[bodyStart+g[4] : bodyStart+g[5]],
+				Number:   number,
+				Repeated: repeated,
+				Label:    label,
+				Line:     lineOf(bodyStart + g[0]),
+				Column:   columnOf(bodyStart + g[0]),
+			})
+		}
+		var reserved []string
+		for _, r := range reservedRe.FindAllStringSubmatch(msgBody, -1) {
+			for _, item := range strings.Split(r[1], ",") {
+				if item = unquoteOption(strings.TrimSpace(item)); item != "" {
+					reserved = append(reserved, item)
+				}
+			}
+		}
+		file.Messages = append(file.Messages, ProtoMessage{
+			Name:      msgName,
+			Comment:   leadingComment(text, loc[0]),
+			Fields:    fields,
+			Options:   parseOptionList(optionStatements(msgBody)),
+			Source:    source,
+			Line:      lineOf(loc[0]),
+			Column:    columnOf(loc[0]),
+			MapFields: mapFields,
+			Groups:    groups,
+			Reserved:  reserved,
+			Enclosing: strings.Join(enclosing, "."),
+		})
+	}
+
+	file.Enums = append(file.Enums, parseEnums(text, source, lineOf, columnOf)...)
+
+	for _, svc := range parseServices(text) {
+		svc.Source = source
+		file.Services = append(file.Services, svc)
+	}
+}
+
+// parseServices extracts service definitions, their top-level string options and RPC methods.
+func parseServices(text string) []ProtoService {
+	serviceRe := regexp.MustCompile(`(?m)service\s+(\w+)\s*{`)
+	rpcRe := regexp.MustCompile(`rpc\s+(\w+)\s*\(\s*(stream\s+)?([\w.]+)\s*\)\s*returns\s*\(\s*(stream\s+)?([\w.]+)\s*\)`)
+
+	var services []ProtoService
+	for _, loc := range serviceRe.FindAllStringSubmatchIndex(text, -1) {
+		body := blockBody(text, loc[1]-1)
+		svc := ProtoService{
+			Name:    text[loc[2]:loc[3]],
+			Comment: leadingComment(text, loc[0]),
+			Options: parseOptionList(optionStatements(body)),
+		}
+		for _, r := range rpcRe.FindAllStringSubmatchIndex(body, -1) {
+			var options string
+			if open := strings.IndexAny(body[r[1]:], "{;"); open >= 0 && body[r[1]+open] == '{' {
+				options = blockBody(body, r[1]+open)
+			}
+			svc.Methods = append(svc.Methods, ProtoMethod{
+				Name:            body[r[2]:r[3]],
+				Comment:         leadingComment(body, r[0]),
+				InputType:       body[r[6]:r[7]],
+				OutputType:      body[r[10]:r[11]],
+				ClientStreaming: r[4] >= 0,
+				ServerStreaming: r[8] >= 0,
+				Options:         parseOptionList(options),
+			})
+		}
+		services = append(services, svc)
+	}
+	return services
+}
+
+// lineAt returns the 1-based line number of the byte offset in text.
+func lineAt(text string, offset int) int {
+	return strings.Count(text[:offset], "\n") + 1
+}
+
+// leadingComment returns the // comment lines directly above the declaration
+// starting at offset, with the comment markers stripped.
+func leadingComment(text string, offset int) string {
+	lines := strings.Split(text[:offset], "\n")
+	// The last element is the text preceding the declaration on its own line.
+	var comment []string
+	for i := len(lines) - 2; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(line, "//") {
+			break
+		}
+		comment = append([]string{strings.TrimSpace(strings.TrimPrefix(line, "//"))}, comment...)
+	}
+	return strings.Join(comment, "\n")
+}
+
+// blockBody returns the text enclosed by the brace at text[open] and its matching close brace.
+func blockBody(text string, open int) string {
+	if end := bracketEnd(text, open); end >= 0 {
+		return text[open+1 : end]
+	}
+	return text[open+1:]
+}
+
+// nestedDeclRe matches the start of a message or enum nested in a message body.
+var nestedDeclRe = regexp.MustCompile(`\b(?:message|enum)\s+\w+\s*{`)
+
+// blankNested replaces comments and nested message and enum declarations in
+// a message body with spaces, keeping offsets and line numbers intact, so that
+// neither is mistaken for a field of the enclosing message.
+func blankNested(body string) string {
+	b := []byte(body)
+	blank := func(from, to int) {
+		for i := from; i < to; i++ {
+			if b[i] != '\n' {
+				b[i] = ' '
+			}
+		}
+	}
+	for i := 0; i < len(body); i++ {
+		if j := skipLiteral(body, i); j != i {
+			if body[i] == '/' {
+				blank(i, j)
+			}
+			i = j - 1
+		}
+	}
+	for _, loc := range nestedDeclRe.FindAllIndex(b, -1) {
+		if b[loc[0]] == ' ' {
+			continue // inside an earlier blanked declaration
+		}
+		end := bracketEnd(body, loc[1]-1)
+		if end < 0 {
+			end = len(body) - 1
+		}
+		blank(loc[0], end+1)
+	}
+	return string(b)
+}
+
+// groupRe matches the start of a proto2 group, which declares a nested
+// message and a field of its type at once, up to its opening brace.
+var groupRe = regexp.MustCompile(`\b(?:(optional|required|repeated)\s+)?group\s+(\w+)\s*=\s*(\d+)[^{;]*{`)
+
+// reservedRe matches a reserved statement, capturing its numbers, ranges
+// and quoted names.
+var reservedRe = regexp.MustCompile(`\breserved\s+([^;]*);`)
+
+// blankGroups replaces the groups declared in a message body, as left by
+// blankNested, with spaces, and returns the submatch indexes of groupRe
+// for each. Groups nested in another group are blanked along with it.
+func blankGroups(body string) (string, [][]int) {
+	b := []byte(body)
+	var groups [][]int
+	end := -1
+	for _, loc := range groupRe.FindAllStringSubmatchIndex(body, -1) {
+		if loc[0] < end {
+			continue
+		}
+		groups = append(groups, loc)
+		if end = bracketEnd(body, loc[1]-1); end < 0 {
+			end = len(body) - 1
+		}
+		for i := loc[0]; i <= end; i++ {
+			if b[i] != '\n' {
+				b[i] = ' '
+			}
+		}
+	}
+	return string(b), groups
+}
+
+// drfPermissions lists the permission classes shipped in rest_framework.permissions.
+var drfPermissions = map[string]bool{
+	"AllowAny":                             true,
+	"IsAuthenticated":                      true,
+	"IsAdminUser":                          true,
+	"IsAuthenticatedOrReadOnly":            true,
+	"DjangoModelPermissions":               true,
+	"DjangoModelPermissionsOrAnonReadOnly": true,
+	"DjangoObjectPermissions":              true,
+}
+
+// permissionOption is the service option overriding the default permission policy.
+const permissionOption = "django.permission_classes"
+
+// resolvePermissions turns a comma-separated permission policy into the Python
+// expressions used in permission_classes. DRF built-ins are referenced through
+// the permissions module, dotted paths are imported directly and any other name
+// is expected to be defined in the generated permissions.py stub.
+func resolvePermissions(policy string, data *TemplateData) []string {
+	var classes []string
+	for _, name := range strings.Split(policy, ",") {
+		name = strings.TrimSpace(name)
+		switch {
+		case name == "":
+			continue
+		case drfPermissions[name]:
+			classes = append(classes, "permissions."+name)
+		case strings.Contains(name, "."):
+			i := strings.LastIndex(name, ".")
+			data.PermissionImports = appendUnique(data.PermissionImports, "from "+name[:i]+" import "+name[i+1:])
+			classes = append(classes, name[i+1:])
+		default:
+			data.PermissionImports = appendUnique(data.PermissionImports, "from .permissions import "+name)
+			data.CustomPermissions = appendUnique(data.CustomPermissions, name)
+			classes = append(classes, name)
+		}
+	}
+	return classes
+}
+
+// servicePermission returns the permission policy of the first service whose
+// RPCs accept or return the given message, if that service declares one.
+func servicePermission(services []ProtoService, msgName string) (string, bool) {
+	return serviceOption(services, msgName, permissionOption)
+}
+
+// pyString renders s as a double-quoted Python string literal.
+func pyString(s string) string {
+	return strconv.Quote(s)
+}
+
+// serializerClass returns the class of the serializer field declared as
+// serializerType, for annotations: related fields with many=True are
+// constructed as a ManyRelatedField.
+func serializerClass(serializerType string) string {
+	if strings.Contains(serializerType, "(many=True") {
+		return "serializers.ManyRelatedField"
+	}
+	name, _, _ := strings.Cut(serializerType, "(")
+	return name
+}
+
+// pyDocstring renders a (possibly multi-line) comment as a one-line Python
+// docstring, joining wrapped comment lines with spaces.
+func pyDocstring(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"""`, `\"\"\"`)
+	if strings.HasSuffix(s, `"`) {
+		s = strings.TrimSuffix(s, `"`) + `\"`
+	}
+	return `"""` + s + `"""`
+}
+
+// appendUnique appends s to list unless it is already present.
+func appendUnique(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
 		}
-		messages = append(messages, ProtoMessage{Name: msgName, Fields: fields})
 	}
-	return messages, nil
+	return append(list, s)
+}
+
+// preparedApp is a Django app ready to be written: the template data and
+// templates of its files.
+type preparedApp struct {
+	file      *ProtoFile
+	outputDir string
+	name      string
+	opts      Options
+	data      TemplateData
+	files     map[string]string
 }
 
-// GenerateApp takes a .proto file and generates a Django app in the specified directory.
-func GenerateApp(protoPath, outputDir string) error {
-	rawMessages, err := ParseProto(protoPath)
+// prepareApp prepares a single Django app named appName from the parsed
+// messages and services, to be written into outputDir by writeApp. Message
+// references in file must already be resolved by resolveTypes.
+func prepareApp(file *ProtoFile, outputDir, appName string, opts Options) (*preparedApp, error) {
+	if err := validateAppName(appName); err != nil {
+		return nil, err
+	}
+	data := TemplateData{
+		AppName:   appName,
+		AppModule: appName,
+		AppTitle:  pascalCase(appName),
+		APIs:      map[string]bool{},
+		OpenAPI:   opts.OpenAPI,
+		Typed:     opts.Typed,
+		ReadOnly:  opts.ReadOnly,
+		Signals:   opts.Signals,
+	}
+	for _, src := range file.Sources {
+		data.Sources = append(data.Sources, filepath.Base(src))
+	}
+	data.SourceHash = file.SourceHash
+	data.AppVerboseName = file.Options[appVerboseNameOption]
+	var err error
+	if data.URLPrefix, err = appURLPrefix(file, appName); err != nil {
+		return nil, err
+	}
+	if len(opts.APIs) == 0 {
+		opts.APIs = []string{APIDRF}
+	}
+	for _, api := range opts.APIs {
+		switch api {
+		case APIDRF, APIGraphQL, APINinja:
+			data.APIs[api] = true
+		default:
+			return nil, fmt.Errorf("unknown API layer %q", api)
+		}
+	}
+
+	switch opts.RepeatedMessage {
+	case "", RepeatedMessageM2M, RepeatedMessageFK:
+	default:
+		return nil, fmt.Errorf("unknown repeated message strategy %q", opts.RepeatedMessage)
+	}
+	switch opts.RepeatedScalar {
+	case "", RepeatedScalarArray, RepeatedScalarJSON, RepeatedScalarChild:
+	default:
+		return nil, fmt.Errorf("unknown repeated scalar strategy %q", opts.RepeatedScalar)
+	}
+	switch opts.JSONCase {
+	case "", JSONCaseSnake, JSONCaseCamel, JSONCaseCamelPackage:
+	default:
+		return nil, fmt.Errorf("unknown JSON case %q", opts.JSONCase)
+	}
+	switch opts.EnumUnspecified {
+	case "", EnumUnspecifiedChoice, EnumUnspecifiedNull:
+	default:
+		return nil, fmt.Errorf("unknown enum unspecified policy %q", opts.EnumUnspecified)
+	}
+	if opts.OnDelete == "" {
+		opts.OnDelete = OnDeleteCascade
+	}
+	switch {
+	case opts.StringMaxLength == 0:
+		opts.StringMaxLength = DefaultStringMaxLength
+	case opts.StringMaxLength < 0:
+		return nil, fmt.Errorf("invalid string max length %d", opts.StringMaxLength)
+	}
+	if !validOnDelete(opts.OnDelete) {
+		return nil, fmt.Errorf("unknown on_delete policy %q", opts.OnDelete)
+	}
+
+	messages, skipped, err := selectMessages(file.Messages, opts)
+	if err != nil {
+		return nil, err
+	}
+	layerRules, err := parseLayerRules(opts.Layers)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if opts.ProjectRoot != "" {
+		if data.AppModule, err = appModule(opts.ProjectRoot, outputDir); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkPatterns("one-to-one", opts.OneToOne); err != nil {
+		return nil, err
+	}
+
+	defined := map[string]ProtoMessage{}
+	for _, msg := range messages {
+		defined[msg.Name] = msg
+	}
+	enums := map[string]RenderedEnum{}
+	for _, e := range file.Enums {
+		if _, ok := enums[e.Name]; ok {
+			slog.Warn("duplicate enum name, choices class not generated", "pos", fmt.Sprintf("%s:%d:%d", e.Source, e.Line, e.Column), "enum", e.Name)
+			continue
+		}
+		enums[e.Name] = renderEnum(e, opts.EnumUnspecified)
+		data.Enums = append(data.Enums, enums[e.Name])
 	}
 
-	var rendered []RenderedMessage
-	for _, msg := range rawMessages {
+	// Child foreign keys are collected first so they can be attached to the
+	// referenced model regardless of definition order.
+	childFields := map[string][]RenderedField{}
+	for _, msg := range messages {
+		for _, f := range msg.Fields {
+			child, ok := defined[f.Type]
+			if !f.Repeated || opts.RepeatedMessage != RepeatedMessageFK || !ok {
+				continue
+			}
+			cf := childForeignKey(msg.Name, f)
+			if protoHasField(child, cf.Name) || hasField(childFields[f.Type], cf.Name) {
+				cf.Name += "_" + snakeCase(f.Name)
+				cf.ProtoName = cf.Name
+			}
+			childFields[f.Type] = append(childFields[f.Type], cf)
+		}
+	}
+
+	validators := map[string]bool{}
+	for _, msg := range messages {
+		if len(msg.Reserved) > 0 {
+			slog.Debug("reserved field numbers and names skipped", "message", msg.Name, "reserved", strings.Join(msg.Reserved, ", "))
+		}
+		for _, g := range msg.Groups {
+			slog.Debug("group field skipped", "message", msg.Name, "field", g.Name, "group", g.Type)
+		}
 		var fields []RenderedField
+		var children []RenderedMessage
+		var numbers []FieldNumber
+		// pkField is the field declared the model's primary key, if any.
+		var pkField string
 		for _, f := range msg.Fields {
-			fields = append(fields, RenderedField{
-				Name:       f.Name,
+			if skipped[f.Type] {
+				slog.Warn("field references skipped message, omitted", "message", msg.Name, "field", f.Name, "type", f.Type)
+				continue
+			}
+			target := f.Type
+			if !isScalar(target) && target != authUserModel {
+				target = modelTarget(target)
+			}
+			if !isScalar(target) {
+				switch module, external := file.Externals[f.Type]; {
+				case f.Type == authUserModel:
+					data.ModelImports = appendUnique(data.ModelImports, "from django.conf import settings")
+					data.RelatedImports = appendUnique(data.RelatedImports, "from django.contrib.auth import get_user_model")
+				case external:
+					data.RelatedImports = appendUnique(data.RelatedImports, "from "+module+" import "+modelClass(f.Type))
+				case strings.Contains(f.Type, "."):
+					app := f.Type[:strings.LastIndex(f.Type, ".")]
+					data.Dependencies = appendUnique(data.Dependencies, app)
+					data.RelatedImports = appendUnique(data.RelatedImports, "from "+siblingModule(data.AppModule, app)+".models import "+modelClass(f.Type))
+				}
+			}
+			djangoType := PythonType(target)
+			// The user model is named through the setting, not a string.
+			djangoType = strings.Replace(djangoType, "'"+authUserModel+"'", authUserModel, 1)
+			rules := validationRules(msg.Name, f)
+			var maxLength int
+			if f.Type == "string" {
+				var err error
+				if djangoType, maxLength, err = stringField(f, rules.MaxLength, opts); err != nil {
+					slog.Warn("field string_type ignored", "message", msg.Name, "field", f.Name, "reason", err)
+				}
+			}
+			switch decimal, ok, err := decimalField(f, opts); {
+			case err != nil:
+				slog.Warn("field decimal options ignored", "message", msg.Name, "field", f.Name, "reason", err)
+			case ok:
+				djangoType, maxLength = decimal, 0
+			}
+			enum, isEnum := enums[f.Enum]
+			if isEnum {
+				djangoType = addKwarg(djangoType, "choices="+enum.Name+".choices")
+			}
+			_, wellKnown := wellKnownType(f.Type)
+			if wellKnown && !f.Repeated {
+				var imp string
+				djangoType, imp = wellKnownDjangoType(f.Type, opts)
+				if imp != "" {
+					data.ModelImports = appendUnique(data.ModelImports, imp)
+				}
+			}
+			if f.Repeated && isScalar(f.Type) {
+				switch {
+				case wellKnown:
+					// Lists of google.type values have no column mapping; keep
+					// them as JSON whatever the repeated scalar strategy.
+					djangoType = "models.JSONField(default=list)"
+				case opts.RepeatedScalar == RepeatedScalarArray:
+					djangoType = "ArrayField(" + djangoType + ", default=list)"
+					data.ModelImports = appendUnique(data.ModelImports, "from django.contrib.postgres.fields import ArrayField")
+				case opts.RepeatedScalar == RepeatedScalarChild:
+					child := scalarChildModel(msg.Name, f, djangoType)
+					slog.Debug("repeated scalar stored in child model", "message", msg.Name, "field", f.Name, "model", child.Name)
+					children = append(children, child)
+					numbers = append(numbers, FieldNumber{snakeCase(f.Name), f.Number})
+					continue
+				default:
+					djangoType = "models.JSONField(default=list)"
+				}
+			}
+			if f.Repeated && !isScalar(f.Type) {
+				if _, ok := defined[f.Type]; ok && opts.RepeatedMessage == RepeatedMessageFK {
+					slog.Debug("repeated message stored as child foreign key", "message", msg.Name, "field", f.Name, "model", pascalCase(f.Type))
+					numbers = append(numbers, FieldNumber{snakeCase(f.Name), f.Number})
+					continue
+				}
+				djangoType = "models.ManyToManyField('" + target + "')"
+			}
+			if f.Type == msg.Name {
+				djangoType = selfReference(f)
+			}
+			switch one, err := oneToOne(f, opts.OneToOne); {
+			case err != nil:
+				slog.Warn("field relation ignored", "message", msg.Name, "field", f.Name, "reason", err)
+			case one && strings.HasPrefix(djangoType, "models.ForeignKey("):
+				djangoType = "models.OneToOneField(" + strings.TrimPrefix(djangoType, "models.ForeignKey(")
+			case one && f.Options[relationOption] != "":
+				slog.Warn("field relation ignored", "message", msg.Name, "field", f.Name, "reason", "only singular message fields can be one-to-one")
+			}
+			name, reason := sanitizeFieldName(snakeCase(f.Name))
+			primary, err := primaryKeyField(f)
+			switch {
+			case err != nil:
+				slog.Warn("field primary_key ignored", "message", msg.Name, "field", f.Name, "reason", err)
+			case primary && pkField != "":
+				slog.Warn("field primary_key ignored", "message", msg.Name, "field", f.Name, "reason", "the model's primary key is "+pkField)
+				primary = false
+			case primary && name == "id_field" && snakeCase(f.Name) == "id":
+				// A field named id replaces the implicit one.
+				name, reason = "id", ""
+			}
+			if strings.Contains(djangoType, "on_delete=") {
+				policy, err := onDelete(f, opts.OnDelete)
+				if err != nil {
+					slog.Warn("field on_delete ignored", "message", msg.Name, "field", f.Name, "reason", err)
+				}
+				if _, ok := fieldDefault(f); policy == OnDeleteSetDefault && !ok {
+					slog.Warn("SET_DEFAULT relation has no default, which Django's checks reject", "message", msg.Name, "field", f.Name)
+				}
+				djangoType = withOnDelete(djangoType, policy)
+			}
+			if isRelation(djangoType) {
+				related, err := relatedName(msg.Name, f, name, djangoType)
+				if err != nil {
+					slog.Warn("field related_name ignored", "message", msg.Name, "field", f.Name, "reason", err)
+				}
+				djangoType = addKwarg(djangoType, "related_name='"+related+"'")
+			}
+			if reason != "" {
+				slog.Warn("field renamed", "message", msg.Name, "field", f.Name, "reason", reason, "name", name)
+				if !strings.Contains(djangoType, "ManyToManyField") {
+					djangoType = addKwarg(djangoType, "db_column='"+snakeCase(f.Name)+"'")
+				}
+			}
+			if djangoType, err = withDBColumn(djangoType, f); err != nil {
+				slog.Warn("field db_column ignored", "message", msg.Name, "field", f.Name, "reason", err)
+			}
+			if !f.Repeated {
+				if enum.ZeroNull {
+					// The unspecified value has no choice of its own.
+					djangoType = withNullability(djangoType, true, true)
+				}
+				null, blank, err := nullability(f, djangoType, opts)
+				if err != nil {
+					slog.Warn("field null/blank option ignored", "message", msg.Name, "field", f.Name, "reason", err)
+				}
+				if null != strings.Contains(djangoType, "null=True") || blank != strings.Contains(djangoType, "blank=True") {
+					djangoType = withNullability(djangoType, null, blank)
+				}
+			}
+			if primary {
+				djangoType = addKwarg(withNullability(djangoType, false, false), "primary_key=True")
+				pkField = name
+			}
+			behavior := fieldBehaviors(f)
+			rules.Required = rules.Required || behavior.Required || f.Label == LabelRequired
+			djangoType = applyRules(djangoType, rules)
+			auto, err := autoTimestamp(f)
+			if err != nil {
+				slog.Warn("field auto_now option ignored", "message", msg.Name, "field", f.Name, "reason", err)
+			}
+			if auto != "" {
+				// Django makes the field non-editable itself.
+				djangoType = addKwarg(djangoType, auto+"=True")
+			} else if behavior.OutputOnly {
+				djangoType = addKwarg(djangoType, "editable=False")
+			}
+			var def string
+			if _, ok := fieldDefault(f); ok && auto != "" {
+				slog.Warn("field default ignored", "message", msg.Name, "field", f.Name, "reason", "the field is set by "+auto)
+			} else if v, ok := fieldDefault(f); ok {
+				literal, err := pyDefault(f.Type, v)
+				if isEnum {
+					literal, err = enumDefault(enum, v)
+				}
+				if strings.Contains(djangoType, "on_delete=") {
+					literal, err = relationDefault(v), nil
+				}
+				if err == nil && f.Repeated {
+					err = fmt.Errorf("defaults are not supported for repeated fields")
+				}
+				if err != nil {
+					slog.Warn("field default ignored", "message", msg.Name, "field", f.Name, "reason", err)
+				} else {
+					def = literal
+					djangoType = addKwarg(djangoType, "default="+def)
+				}
+			} else if isEnum && enum.Unspecified != "" && !f.Repeated && f.Label != LabelOptional {
+				// Unset proto3 enums read as their unspecified value.
+				def = enum.Name + "." + enum.Unspecified
+				djangoType = addKwarg(djangoType, "default="+def)
+			}
+			deprecated := f.Options["deprecated"] == "true"
+			omitted := deprecated && opts.OmitDeprecated
+			if (behavior.OutputOnly && auto == "" || omitted) && def == "" && !primary && !f.Repeated && !strings.Contains(djangoType, "null=True") {
+				djangoType = withWriteDefault(djangoType, f.Type)
+			}
+			if deprecated {
+				djangoType = addKwarg(djangoType, "help_text="+pyString(deprecationNote(f.Comment)))
+			}
+			for _, v := range rules.Validators {
+				validators[v[:strings.IndexByte(v, '(')]] = true
+			}
+			rf := RenderedField{
+				Name:       name,
+				ProtoName:  f.Name,
 				Type:       f.Type,
 				Repeated:   f.Repeated,
-				DjangoType: PythonType(f.Type),
-			})
+				DjangoType: djangoType,
+				MaxLength:  maxLength,
+				Validators: rules.Validators,
+				ReadOnly:   behavior.OutputOnly || auto != "" || opts.ReadOnly,
+				Immutable:  behavior.Immutable && !behavior.OutputOnly && auto == "",
+				Deprecated: deprecated,
+				Default:    def,
+				Optional:   f.Label == LabelOptional && !f.Repeated,
+				Enum:       enum.Name,
+				ZeroNull:   enum.ZeroNull,
+				Oneof:      f.Oneof,
+				JSONName:   serializerName(f, opts.JSONCase),
+			}
+			slog.Debug("mapped field", "message", msg.Name, "field", f.Name, "proto_type", f.Type, "django_field", rf.Name, "django_type", djangoType)
+			// Reserved proto names cannot be declared on the serializer either,
+			// so those fields are exposed under their model name.
+			if reason == "" && rf.Name != rf.JSONName && !omitted {
+				rf.SerializerType = SerializerType(rf, msg.Name)
+				if rf.Enum != "" {
+					data.RelatedImports = appendUnique(data.RelatedImports, "from .models import "+rf.Enum)
+				}
+			}
+			fields = append(fields, rf)
+			numbers = append(numbers, FieldNumber{rf.Name, f.Number})
+			if f.Type == moneyType && !f.Repeated && !opts.DjangoMoney {
+				fields = append(fields, moneyCurrencyField(rf))
+			}
+		}
+		fields = append(fields, childFields[msg.Name]...)
+
+		var renamed, exclude, listDisplay, readOnly, immutable, immutableAttrs []string
+		var inputFields []RenderedField
+		for _, f := range fields {
+			if f.SerializerType != "" {
+				renamed = append(renamed, f.Name)
+			}
+			switch {
+			case f.SerializerType != "":
+				exclude = append(exclude, f.Name)
+			case f.Deprecated && opts.OmitDeprecated:
+				slog.Debug("deprecated field omitted from serializer", "message", msg.Name, "field", f.Name)
+				exclude = append(exclude, f.Name)
+			}
+			// The changelist cannot show many-to-many fields.
+			if !f.Deprecated && !strings.Contains(f.DjangoType, "ManyToManyField") {
+				listDisplay = append(listDisplay, f.Name)
+			}
+			switch {
+			case f.ReadOnly || opts.ReadOnly:
+				// Declared serializer fields ignore Meta.read_only_fields
+				// and are marked read-only where they are declared.
+				if f.SerializerType == "" {
+					readOnly = append(readOnly, f.Name)
+				}
+				continue
+			case f.Immutable && f.SerializerType != "":
+				immutable = append(immutable, f.JSONName)
+			case f.Immutable:
+				immutable = append(immutable, f.Name)
+			}
+			if f.Immutable {
+				immutableAttrs = append(immutableAttrs, f.Name)
+			}
+			inputFields = append(inputFields, f)
+		}
+		policy, ok := servicePermission(file.Services, msg.Name)
+		if !ok {
+			policy = opts.Permission
+		}
+		permissionClasses := resolvePermissions(policy, &data)
+		throttle := messageThrottleScope(file.Services, msg.Name)
+		authClasses, _ := serviceOption(file.Services, msg.Name, authenticationOption)
+		authentication := resolveAuthentication(authClasses, &data)
+		base := "models.Model"
+		if baseModel(msg, fields, opts) {
+			base = "BaseModel"
+			data.BaseModel = true
+		}
+		pk, err := primaryKey(msg, opts)
+		if err != nil {
+			return nil, err
+		}
+		if pkField != "" && pk == PrimaryKeyUUID {
+			slog.Warn("UUID primary key ignored", "message", msg.Name, "reason", "the model's primary key is "+pkField)
+			pk = PrimaryKeyAuto
+		}
+		table, managed, err := modelTable(msg)
+		if err != nil {
+			slog.Warn("model table options ignored", "message", msg.Name, "reason", err)
+		}
+		layers := messageLayers(msg, layerRules)
+		managed = managed && slices.Contains(layers, LayerModel)
+		data.UUID = data.UUID || pk == PrimaryKeyUUID
+		soft := softDelete(msg, fields, opts)
+		if soft {
+			data.SoftDelete = true
+			data.ModelImports = appendUnique(data.ModelImports, "from django.utils import timezone")
+		}
+		indexes, constraints := modelMeta(msg, fields)
+		var search []string
+		if opts.Search {
+			search = searchFields(fields)
+		}
+		if len(search) > 0 {
+			data.Search = true
+			data.ModelImports = appendUnique(data.ModelImports, "from django.contrib.postgres.indexes import GinIndex")
+			data.ModelImports = appendUnique(data.ModelImports, "from django.contrib.postgres.search import SearchVector, SearchVectorField")
+			indexes = append(indexes, "GinIndex(fields=['"+searchVectorField+"'])")
+			exclude = append(exclude, searchVectorField)
+		}
+		prefix := msg.Options[routePrefixOption]
+		if segments, ok := resourcePattern(msg); ok && prefix == "" {
+			prefix = resourcePrefix(segments)
+		}
+		if prefix == "" {
+			prefix = routePrefix(pascalCase(msg.Name))
+		}
+		data.Messages = append(data.Messages, RenderedMessage{
+			Name:              pascalCase(msg.Name),
+			SnakeName:         snakeCase(pascalCase(msg.Name)),
+			PluralName:        pluralName(pascalCase(msg.Name)),
+			RoutePrefix:       prefix,
+			ProtoName:         msg.Name,
+			Description:       msg.Comment,
+			Fields:            fields,
+			Renamed:           renamed,
+			PermissionClasses: permissionClasses,
+			ThrottleScope:     throttle,
+			Authentication:    authentication,
+			StrField:          strField(fields, snakeCase(msg.Options[strFieldOption]), snakeCase(opts.StrField)),
+			SchemaDecorators:  schemaDecorators(file.Services, msg.Name),
+			FieldNumbers:      numbers,
+			Base:              base,
+			UUIDPrimaryKey:    pk == PrimaryKeyUUID,
+			SoftDelete:        soft,
+			InputFields:       inputFields,
+			ReadOnlyFields:    readOnly,
+			ImmutableFields:   immutable,
+			ImmutableAttrs:    immutableAttrs,
+			SerializerExclude: exclude,
+			ListDisplay:       listDisplay,
+			Indexes:           indexes,
+			Constraints:       constraints,
+			DBTable:           table,
+			Unmanaged:         !managed,
+			Layers:            layers,
+			SearchFields:      search,
+			History:           historyAttr(fields, opts),
+			Versions:          msg.Versions,
+		})
+		if !managed {
+			warnUnmanaged(data.Messages[len(data.Messages)-1])
+		}
+		for _, child := range children {
+			child.PermissionClasses = permissionClasses
+			child.ThrottleScope = throttle
+			child.Authentication = authentication
+			child.StrField = strField(child.Fields)
+			child.Versions = msg.Versions
+			// Child tables are named after the (already plural) repeated field.
+			child.RoutePrefix = strings.ReplaceAll(snakeCase(child.Name), "_", "-")
+			child.SnakeName = snakeCase(child.Name)
+			child.PluralName = child.SnakeName + "_list"
+			child.Base = base
+			child.SoftDelete = soft
+			child.History = historyAttr(child.Fields, opts)
+			child.Layers = layers
+			for _, f := range child.Fields {
+				child.ListDisplay = append(child.ListDisplay, f.Name)
+				if opts.ReadOnly {
+					child.ReadOnlyFields = append(child.ReadOnlyFields, f.Name)
+				}
+			}
+			if !opts.ReadOnly {
+				child.InputFields = child.Fields
+			}
+			data.Messages = append(data.Messages, child)
 		}
-		rendered = append(rendered, RenderedMessage{Name: msg.Name, Fields: fields})
+	}
+	if opts.History && len(data.Messages) > 0 {
+		data.History = true
+		data.ModelImports = appendUnique(data.ModelImports, "from simple_history.models import HistoricalRecords")
 	}
 
-	appName := filepath.Base(outputDir)
-	data := TemplateData{
-		AppName:  appName,
-		AppTitle: caser.String(appName),
-		Messages: rendered,
+	markUUIDRelations(data.Messages)
+	data.APIMessages = layerMessages(data.Messages, LayerAPI)
+	data.AdminMessages = layerMessages(data.Messages, LayerAdmin)
+	if len(data.APIMessages) == 0 && len(data.Messages) > 0 {
+		slog.Debug("no model has the api layer, APIs skipped")
+		data.APIs = map[string]bool{}
 	}
 
-	if err := os.MkdirAll(filepath.Join(outputDir, "migrations"), os.ModePerm); err != nil {
-		return fmt.Errorf("failed to create migrations directory: %w", err)
+	if data.APIs[APIDRF] {
+		data.NestedRouters = applyResources(file, data.APIMessages)
+		for _, msg := range file.Messages {
+			for _, v := range msg.Versions {
+				data.Versions = appendUnique(data.Versions, v)
+			}
+		}
+		sort.Slice(data.Versions, func(i, j int) bool { return versionLess(data.Versions[i], data.Versions[j]) })
+		data.Routers = apiRouters(data.APIMessages, data.NestedRouters, data.Versions)
+		assignActions(file.Services, data.APIMessages)
+		data.RequestSerializers = assignRPCActions(file, data.APIMessages, opts.JSONCase)
+		if opts.ReadOnly {
+			data.RequestSerializers = readOnlyActions(data.APIMessages, data.RequestSerializers)
+		}
+		data.ThrottleScopes = throttleScopes(file.Services)
+		data.CamelCasePackage = opts.JSONCase == JSONCaseCamelPackage
+		for _, msg := range data.APIMessages {
+			data.Actions = data.Actions || len(msg.Actions) > 0
+		}
+	}
+	if opts.GRPC || opts.Celery || opts.Channels {
+		data.Clients, data.GRPCImports = grpcClients(file, opts.GRPCPackage)
+	}
+	if opts.GRPCServer {
+		var imports []string
+		data.Servicers, imports = grpcClients(file, opts.GRPCPackage)
+		data.ServicerImports = servicerImports(imports)
+	}
+	if opts.Celery {
+		data.Tasks, data.TaskImports = celeryTasks(data)
+	}
+	if opts.GRPC {
+		data.Converters, data.ConverterImports = converters(file, data, opts.GRPCPackage)
+		data.SyncCommands = syncCommands(file, data)
+		data.ConvertsDecimals = convertsDecimals(data.Converters)
+		data.RoundTrips, data.RoundTripImports = roundTrips(file, data, opts.GRPCPackage)
+	}
+	if opts.Channels {
+		data.Consumers, data.ConsumerImports = channelsConsumers(data)
+	}
+	if opts.Seed {
+		data.Seed = seedCommand(data)
+	}
+	if len(validators) > 0 {
+		data.ModelImports = appendUnique(data.ModelImports, validatorsImport(validators))
+	}
+
+	if opts.DjangoVersion == "" {
+		opts.DjangoVersion = DefaultDjangoVersion
+	}
+	if data.Requirements, err = resolveRequirements(data, opts.DjangoVersion); err != nil {
+		return nil, err
 	}
-	writeFile(filepath.Join(outputDir, "migrations", "__init__.py"), "")
-	writeFile(filepath.Join(outputDir, "__init__.py"), "")
-	writeFile(filepath.Join(outputDir, "tests.py"), "# placeholder\n")
 
 	files := map[string]string{
-		"models.py":      modelsTemplate,
-		"serializers.py": serializersTemplate,
-		"viewsets.py":    viewsetsTemplate,
-		"urls.py":        urlsTemplate,
-		"admin.py":       adminTemplate,
-		"apps.py":        appsTemplate,
-	}
-	for name, tmpl := range files {
-		if err := renderToFile(tmpl, data, filepath.Join(outputDir, name)); err != nil {
+		"models.py": modelsTemplate,
+		"urls.py":   urlsTemplate,
+		"admin.py":  adminTemplate,
+		"apps.py":   appsTemplate,
+	}
+	if data.SoftDelete {
+		files["softdelete.py"] = softDeleteTemplate
+	}
+	if data.APIs[APIDRF] {
+		files["serializers.py"] = serializersTemplate
+		files["viewsets.py"] = viewsetsTemplate
+		files["permissions.py"] = permissionsTemplate
+		if len(data.ThrottleScopes) > 0 {
+			files["throttling.py"] = throttlingTemplate
+		}
+	}
+	if data.APIs[APIGraphQL] {
+		files["schema.py"] = schemaTemplate
+	}
+	if data.APIs[APINinja] {
+		files["api.py"] = ninjaTemplate
+	}
+	if (data.APIs[APIGraphQL] || data.APIs[APINinja]) && !data.ReadOnly {
+		files["utils.py"] = utilsTemplate
+	}
+	if len(data.Clients) > 0 {
+		files["clients.py"] = clientsTemplate
+	}
+	if len(data.Servicers) > 0 {
+		files["handlers.py"] = handlersTemplate
+		files["grpc_settings.py"] = grpcSettingsTemplate
+	}
+	if len(data.Tasks) > 0 {
+		files["tasks.py"] = tasksTemplate
+	}
+	if len(data.Converters) > 0 {
+		files["converters.py"] = convertersTemplate
+	}
+	if len(data.RoundTrips) > 0 {
+		files["tests.py"] = roundTripTemplate
+	}
+	if len(data.Consumers) > 0 {
+		files["consumers.py"] = consumersTemplate
+		files["routing.py"] = routingTemplate
+	}
+	switch opts.Manifest {
+	case "", ManifestRequirements:
+		files["requirements.txt"] = requirementsTemplate
+	case ManifestPyproject:
+		files["pyproject.toml"] = pyprojectTemplate
+	default:
+		return nil, fmt.Errorf("unknown manifest format %q", opts.Manifest)
+	}
+	if opts.Templates != "" {
+		if err := overrideTemplates(opts.Templates, files); err != nil {
+			return nil, err
+		}
+	}
+	return &preparedApp{file: file, outputDir: outputDir, name: appName, opts: opts, data: data, files: files}, nil
+}
+
+// writeApp renders the files of app, as many at once as limit allows, and
+// returns its plan, which is all it does with DryRun.
+func writeApp(app *preparedApp, limit limiter) (*AppPlan, error) {
+	file, outputDir, appName, opts, data, files := app.file, app.outputDir, app.name, app.opts, app.data, app.files
+	if opts.DryRun {
+		return planApp(file, outputDir, data, files), nil
+	}
+
+	if err := os.MkdirAll(filepath.Join(outputDir, "migrations"), os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create migrations directory: %w", err)
+	}
+	writeFile(filepath.Join(outputDir, "migrations", "__init__.py"), "", data)
+	writeFile(filepath.Join(outputDir, "__init__.py"), "", data)
+	if data.Typed {
+		writeFile(filepath.Join(outputDir, "py.typed"), "", data)
+	}
+	if _, ok := files["tests.py"]; !ok {
+		writeFile(filepath.Join(outputDir, "tests.py"), "# placeholder\n", data)
+	}
+	if err := writeManagers(filepath.Join(outputDir, "managers.py"), data); err != nil {
+		return nil, fmt.Errorf("failed to scaffold managers.py: %w", err)
+	}
+	if data.Actions {
+		if err := writeActions(filepath.Join(outputDir, "actions.py"), data); err != nil {
+			return nil, fmt.Errorf("failed to scaffold actions.py: %w", err)
+		}
+	}
+	if data.Signals {
+		if err := writeSignals(filepath.Join(outputDir, "signals.py"), data); err != nil {
+			return nil, fmt.Errorf("failed to scaffold signals.py: %w", err)
+		}
+	}
+	if err := writeSyncCommands(outputDir, data); err != nil {
+		return nil, err
+	}
+	if err := writeSeedCommand(outputDir, data); err != nil {
+		return nil, err
+	}
+	if err := writeGRPCServer(outputDir, data); err != nil {
+		return nil, err
+	}
+
+	var split []string
+	if opts.SplitFiles {
+		for name := range files {
+			if _, ok := splitFiles[name]; ok {
+				split = append(split, name)
+			}
+		}
+		sort.Strings(split)
+	}
+	var modules []string
+	for _, name := range split {
+		written, err := writePackage(files[name], data, outputDir, name, opts.Merge)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render %s: %w", name, err)
+		}
+		delete(files, name)
+		modules = append(modules, written...)
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	err := parallel(len(names), limit, func(i int) error {
+		name := names[i]
+		render := renderToFile
+		if opts.Merge {
+			render = mergeToFile
+		}
+		if err := render(files[name], data, filepath.Join(outputDir, name)); err != nil {
 			return fmt.Errorf("failed to render %s: %w", name, err)
 		}
+		slog.Debug("wrote file", "app", appName, "path", filepath.Join(outputDir, name))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range modules {
+		files[name] = ""
 	}
 
-	return nil
+	return planApp(file, outputDir, data, files), nil
 }
 
-// writeFile creates or overwrites a file with the given content.
-func writeFile(path, content string) {
-	_ = os.WriteFile(path, []byte(content), 0644)
+// writeFile creates or overwrites a generated file with the given content.
+func writeFile(path, content string, data TemplateData) {
+	_ = writeGenerated(path, []byte(content), data)
 }
 
 // renderToFile renders a text/template with provided data and writes to file.
@@ -160,109 +2145,588 @@ func renderToFile(content string, data TemplateData, outputPath string) error {
 	if err != nil {
 		return fmt.Errorf("failed to parse template: %w", err)
 	}
-	file, err := os.Create(outputPath)
-	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
-	}
-	defer file.Close()
-	return tmpl.Execute(file, data)
-}
-
-// funcMap defines custom template functions.
-var funcMap = template.FuncMap{
-	"ToLower": strings.ToLower,
+	return streamGenerated(outputPath, data, func(w io.Writer) error {
+		return tmpl.Execute(w, data)
+	})
 }
 
 // Templates
 
-const modelsTemplate = `from django.db import models
+const modelsTemplate = `{{ if .UUID }}import uuid
+
+{{ end }}from django.db import models
+{{- range .ModelImports }}
+{{ . }}
+{{- end }}
+
+from . import managers
+{{ range .Enums }}
+class {{ .Name }}(models.IntegerChoices):
+{{- range .Values }}
+    {{ .Name }} = {{ .Number }}, {{ Quote .Label }}
+{{- end }}
+{{ end }}{{ if .BaseModel }}
+class BaseModel(models.Model):
+    created_at = models.DateTimeField(auto_now_add=True)
+    updated_at = models.DateTimeField(auto_now=True)
+
+    class Meta:
+        abstract = True
 
+{{ end }}
 {{- range .Messages }}
-class {{ .Name }}(models.Model):
-{{- if not .Fields }}
-    pass
-{{- else }}
+class {{ .Name }}({{ .Base }}):
+{{- if .UUIDPrimaryKey }}
+    id = models.UUIDField(primary_key=True, default=uuid.uuid4, editable=False)
+{{- end }}
 {{- range .Fields }}
     {{ .Name }} = {{ .DjangoType }}
 {{- end }}
+{{- if .SoftDelete }}
+    is_deleted = models.BooleanField(default=False, editable=False)
+    deleted_at = models.DateTimeField(null=True, blank=True, editable=False)
+{{- end }}
+{{- if .SearchFields }}
+    search_vector = SearchVectorField(null=True, editable=False)
+{{- end }}
+{{ if or .Fields .UUIDPrimaryKey .SoftDelete }}
+{{ end }}    objects = managers.{{ .Name }}Manager()
+{{- if .SoftDelete }}
+    all_objects = models.Manager()
+{{- end }}
+{{- if .History }}
+    {{ .History }} = HistoricalRecords()
+{{- end }}
+{{- if .FieldNumbers }}
+
+    # Proto field numbers keyed by model attribute, stable across renames.
+    PROTO_FIELD_NUMBERS = {
+{{- range .FieldNumbers }}
+        '{{ .Name }}': {{ .Number }},
+{{- end }}
+    }
+{{- end }}
+{{- if or .DBTable .Unmanaged .Indexes .Constraints }}
+
+    class Meta:
+{{- if .DBTable }}
+        db_table = '{{ .DBTable }}'
+{{- end }}
+{{- if .Unmanaged }}
+        managed = False
+{{- end }}
+{{- if .Indexes }}
+        indexes = [
+{{- range .Indexes }}
+            {{ . }},
+{{- end }}
+        ]
+{{- end }}
+{{- if .Constraints }}
+        constraints = [
+{{- range .Constraints }}
+            {{ . }},
+{{- end }}
+        ]
+{{- end }}
+{{- end }}
+
+    def __str__(self):
+        return str(self.{{ .StrField }})
+{{- if .SoftDelete }}
+
+    def soft_delete(self):
+        self.is_deleted = True
+        self.deleted_at = timezone.now()
+        self.save(update_fields=['is_deleted', 'deleted_at'])
+{{- end }}
+{{- if .SearchFields }}
+
+    def save(self, *args, **kwargs):
+        super().save(*args, **kwargs)
+        # The vector is computed by the database from the saved row.
+        type(self)._base_manager.filter(pk=self.pk).update(
+            search_vector=SearchVector({{ range $i, $f := .SearchFields }}{{ if $i }}, {{ end }}'{{ $f }}'{{ end }})
+        )
 {{- end }}
 {{ end }}
 `
 
-const serializersTemplate = `from rest_framework import serializers
-{{ range .Messages }}
+const serializersTemplate = `{{ if .Typed }}from __future__ import annotations
+
+{{ end }}from rest_framework import serializers
+{{- range .RelatedImports }}
+{{ . }}
+{{- end }}
+{{ range .APIMessages }}
 from .models import {{ .Name }}
 {{ end }}
 
-{{ range .Messages }}
+{{ range .APIMessages }}
 class {{ .Name }}Serializer(serializers.ModelSerializer):
+{{- if .UUIDPrimaryKey }}
+    id{{ if $.Typed }}: serializers.UUIDField{{ end }} = serializers.UUIDField(read_only=True)
+{{- end }}
+{{- range .Fields }}
+{{- if .SerializerType }}
+    {{ .JSONName }}{{ if $.Typed }}: {{ SerializerClass .SerializerType }}{{ end }} = {{ .SerializerType }}
+{{- end }}
+{{- end }}
+{{- if or .Renamed .UUIDPrimaryKey }}
+{{ end }}
     class Meta:
         model = {{ .Name }}
+{{- if .SerializerExclude }}
+        exclude = [{{ range $i, $name := .SerializerExclude }}{{ if $i }}, {{ end }}'{{ $name }}'{{ end }}]
+{{- else }}
         fields = '__all__'
+{{- end }}
+{{- if .ReadOnlyFields }}
+        read_only_fields = [{{ range $i, $name := .ReadOnlyFields }}{{ if $i }}, {{ end }}'{{ $name }}'{{ end }}]
+{{- end }}
+{{- if .ImmutableFields }}
+
+    def get_fields(self){{ if $.Typed }} -> dict[str, serializers.Field]{{ end }}:
+        fields = super().get_fields()
+        # Immutable fields may be set on create but not changed afterwards.
+        if self.instance is not None:
+            for name in [{{ range $i, $name := .ImmutableFields }}{{ if $i }}, {{ end }}'{{ $name }}'{{ end }}]:
+                fields[name].read_only = True
+        return fields
+{{- end }}
+{{ end }}
+{{- range .RequestSerializers }}
+
+class {{ .Name }}(serializers.Serializer):
+    """Body of the actions taking {{ .Message }} requests."""
+{{- range .Fields }}
+    {{ .Name }}{{ if $.Typed }}: {{ SerializerClass .SerializerType }}{{ end }} = {{ .SerializerType }}
+{{- end }}
 {{ end }}
 `
 
-const viewsetsTemplate = `from rest_framework import viewsets
-{{ range .Messages }}
+const viewsetsTemplate = `{{ if .Typed }}from __future__ import annotations
+
+{{ if or .Search .Actions }}from typing import Any
+
+{{ end }}{{ end }}{{ if .OpenAPI }}from drf_spectacular.utils import extend_schema, extend_schema_view
+{{ end }}{{ if .Search }}from django.contrib.postgres.search import SearchQuery, SearchRank
+{{ end }}{{ if or .Search .Typed }}from django.db.models import {{ if .Search }}F{{ if .Typed }}, {{ end }}{{ end }}{{ if .Typed }}QuerySet{{ end }}
+{{ end }}from rest_framework import {{ if .Search }}filters, {{ end }}permissions, viewsets
+{{- if .Actions }}
+from rest_framework.decorators import action
+{{- end }}
+{{- if and .Typed (or .Search .Actions) }}
+from rest_framework.request import Request
+{{- end }}
+{{- if and .Typed .Actions }}
+from rest_framework.response import Response
+{{- end }}
+{{- if and .Typed .Search }}
+from rest_framework.views import APIView
+{{- end }}
+{{- range .AuthenticationImports }}
+{{ . }}
+{{- end }}
+{{- range .PermissionImports }}
+{{ . }}
+{{- end }}
+{{- if .CamelCasePackage }}
+from djangorestframework_camel_case.parser import CamelCaseFormParser, CamelCaseJSONParser, CamelCaseMultiPartParser
+from djangorestframework_camel_case.render import CamelCaseBrowsableAPIRenderer, CamelCaseJSONRenderer
+{{- end }}
+{{- if .Versions }}
+from rest_framework.versioning import NamespaceVersioning
+{{- end }}
+{{- if .ThrottleScopes }}
+from .throttling import ScopedRateThrottle
+{{- end }}
+{{- if .Actions }}
+from . import actions
+{{- end }}
+{{ range .APIMessages }}
 from .models import {{ .Name }}
 from .serializers import {{ .Name }}Serializer
 {{ end }}
+{{- range .RequestSerializers }}
+from .serializers import {{ .Name }}
+{{- end }}
+{{- if .Search }}` + searchFilterTemplate + `{{ end }}
 
-{{ range .Messages }}
-class {{ .Name }}ViewSet(viewsets.ModelViewSet):
-    queryset = {{ .Name }}.objects.all()
+{{ range .APIMessages }}
+{{- if $.OpenAPI }}
+{{- range .SchemaDecorators }}
+{{ . }}
+{{- end }}
+{{- end }}
+class {{ .Name }}ViewSet(viewsets.{{ if $.ReadOnly }}ReadOnly{{ end }}ModelViewSet):
+{{- if and $.OpenAPI .Description }}
+    {{ Docstring .Description }}
+{{ end }}
+    queryset{{ if $.Typed }}: QuerySet[{{ .Name }}]{{ end }} = {{ .Name }}.objects.all()
     serializer_class = {{ .Name }}Serializer
+{{- if .SearchFields }}
+    filter_backends = [*viewsets.{{ if $.ReadOnly }}ReadOnly{{ end }}ModelViewSet.filter_backends, SearchVectorFilter]
+{{- end }}
+{{- if .LookupField }}
+    lookup_field = '{{ .LookupField }}'
+    lookup_url_kwarg = 'pk'
+{{- else if .UUIDPrimaryKey }}
+    lookup_field = 'id'
+    lookup_value_regex = '[0-9a-f-]{36}'
+{{- end }}
+{{- if .PermissionClasses }}
+    permission_classes = [{{ Join .PermissionClasses ", " }}]
+{{- end }}
+{{- if .Authentication }}
+    authentication_classes = [{{ Join .Authentication ", " }}]
+{{- end }}
+{{- if $.CamelCasePackage }}
+    renderer_classes = [CamelCaseJSONRenderer, CamelCaseBrowsableAPIRenderer]
+    parser_classes = [CamelCaseJSONParser, CamelCaseFormParser, CamelCaseMultiPartParser]
+{{- end }}
+{{- if .Versions }}
+    versioning_class = NamespaceVersioning
+    allowed_versions = [{{ range $i, $v := .Versions }}{{ if $i }}, {{ end }}'{{ $v }}'{{ end }}]
+{{- end }}
+{{- if .ThrottleScope }}
+    throttle_classes = [ScopedRateThrottle]
+    throttle_scope = '{{ .ThrottleScope }}'
+{{- end }}
+{{- if .ParentFilters }}
+
+    def get_queryset(self){{ if $.Typed }} -> QuerySet[{{ .Name }}]{{ end }}:
+        return super().get_queryset().filter({{ range $i, $f := .ParentFilters }}{{ if $i }}, {{ end }}{{ $f }}{{ end }})
+{{- end }}
+{{- if and .SoftDelete (not $.ReadOnly) }}
+
+    def perform_destroy(self, instance{{ if $.Typed }}: {{ .Name }}{{ end }}){{ if $.Typed }} -> None{{ end }}:
+        instance.soft_delete()
+{{- end }}
+{{- range .Actions }}
+
+    @action(detail={{ if .Detail }}True{{ else }}False{{ end }}, methods=['{{ .HTTPMethod }}'], url_path='{{ .URLPath }}'{{ if .Serializer }}, serializer_class={{ .Serializer }}{{ end }})
+{{- if $.Typed }}
+    def {{ .Name }}(self, request: Request, pk: str | None = None{{ if .Nested }}, **kwargs: Any{{ end }}) -> Response:
+{{- else }}
+    def {{ .Name }}(self, request, pk=None{{ if .Nested }}, **kwargs{{ end }}):
+{{- end }}
+{{- if .Serializer }}
+        serializer = self.get_serializer(data=request.data)
+        serializer.is_valid(raise_exception=True)
+        return actions.{{ .Name }}(self, request, pk, serializer.validated_data)
+{{- else }}
+        return actions.{{ .Name }}(self, request, pk)
+{{- end }}
+{{- end }}
 {{ end }}
 `
 
 const urlsTemplate = `from django.urls import path, include
+{{- if .APIs.graphql }}
+from django.views.decorators.csrf import csrf_exempt
+from graphene_django.views import GraphQLView
+{{- end }}
+{{- if .APIs.ninja }}
+from ninja import NinjaAPI
+{{- end }}
+{{- if .APIs.drf }}
+{{- if .OpenAPI }}
+from drf_spectacular.views import SpectacularAPIView, SpectacularSwaggerView
+{{- end }}
 from rest_framework.routers import DefaultRouter
-{{ range .Messages }}
+{{- if .NestedRouters }}
+from rest_framework_nested.routers import NestedDefaultRouter
+{{- end }}
+{{ range .APIMessages }}
 from .viewsets import {{ .Name }}ViewSet
 {{ end }}
+{{- end }}
+{{- if .APIs.graphql }}
+from .schema import schema
+{{- end }}
+{{- if .APIs.ninja }}
+from .api import router as ninja_router
+{{- end }}
+{{- if .APIs.drf }}
 
-router = DefaultRouter()
-{{ range .Messages }}
-router.register(r'{{ .Name | ToLower }}', {{ .Name }}ViewSet)
+{{ range $i, $r := .Routers }}{{ if $i }}
+{{ end }}{{ .Name }} = DefaultRouter()
+{{ range .Messages }}{{ if not .ParentKwarg }}
+{{ $r.Name }}.register(r'{{ .RoutePrefix }}', {{ .Name }}ViewSet)
+{{ end }}{{ end }}
+{{- range .Nested }}
+{{ .Name }} = NestedDefaultRouter({{ .Parent }}, r'{{ .Prefix }}', lookup='{{ .Lookup }}')
+{{- $router := .Name }}
+{{- range .Children }}
+{{ $router }}.register(r'{{ .RoutePrefix }}', {{ .Name }}ViewSet, basename='{{ .SnakeName }}')
+{{- end }}
 {{ end }}
+{{- end }}
+{{- end }}
+{{- if .APIs.ninja }}
+
+api = NinjaAPI(urls_namespace='{{ .AppName }}')
+api.add_router('/', ninja_router)
+{{- end }}
 
 urlpatterns = [
-    path('', include(router.urls)),
+{{- if .APIs.drf }}
+{{- range .Routers }}
+{{- if .Version }}
+    path('{{ .Version }}/', include(({{ .Name }}.urls{{ range .Nested }} + {{ .Name }}.urls{{ end }}, '{{ .Version }}'))),
+{{- else }}
+    path('', include({{ .Name }}.urls)),
+{{- range .Nested }}
+    path('', include({{ .Name }}.urls)),
+{{- end }}
+{{- end }}
+{{- end }}
+{{- if .OpenAPI }}
+    # Requires 'drf_spectacular' in INSTALLED_APPS and REST_FRAMEWORK's
+    # DEFAULT_SCHEMA_CLASS set to 'drf_spectacular.openapi.AutoSchema'.
+    path('schema/', SpectacularAPIView.as_view(), name='{{ .AppName }}-schema'),
+    path('schema/swagger/', SpectacularSwaggerView.as_view(url_name='{{ .AppName }}-schema'), name='{{ .AppName }}-swagger'),
+{{- end }}
+{{- end }}
+{{- if .APIs.graphql }}
+    path('graphql/', csrf_exempt(GraphQLView.as_view(graphiql=True, schema=schema))),
+{{- end }}
+{{- if .APIs.ninja }}
+    path('{{ if .APIs.drf }}ninja/{{ end }}', api.urls),
+{{- end }}
 ]
 `
 
 const adminTemplate = `from django.contrib import admin
-{{ range .Messages }}
+{{- if .History }}
+from simple_history.admin import SimpleHistoryAdmin
+{{- end }}
+{{ range .AdminMessages }}
 from .models import {{ .Name }}
 {{ end }}
 
-{{ range .Messages }}
-admin.site.register({{ .Name }})
+{{ range .AdminMessages }}
+{{- if .ListDisplay }}
+@admin.register({{ .Name }})
+class {{ .Name }}Admin({{ if .History }}SimpleHistoryAdmin{{ else }}admin.ModelAdmin{{ end }}):
+    list_display = [{{ range $i, $name := .ListDisplay }}{{ if $i }}, {{ end }}'{{ $name }}'{{ end }}]
+{{- else }}
+admin.site.register({{ .Name }}{{ if .History }}, SimpleHistoryAdmin{{ end }})
+{{- end }}
 {{ end }}
 `
 
+const utilsTemplate = `def save_instance(instance, data):
+    """Apply API input to a model instance, assigning relations by primary key."""
+    many = {}
+    for field in instance._meta.get_fields():
+        if field.name not in data:
+            continue
+        value = data[field.name]
+        if field.many_to_many:
+            many[field.name] = value
+        elif field.is_relation:
+            setattr(instance, field.attname, value)
+        else:
+            setattr(instance, field.name, value)
+    instance.save()
+    for name, value in many.items():
+        getattr(instance, name).set(value)
+    return instance
+`
+
 const appsTemplate = `from django.apps import AppConfig
 
 class {{ .AppTitle }}Config(AppConfig):
     default_auto_field = 'django.db.models.BigAutoField'
-    name = '{{ .AppName }}'
+    name = '{{ .AppModule }}'
+{{- if ne .AppModule .AppName }}
+    label = '{{ .AppName }}'
+{{- end }}
+{{- if .AppVerboseName }}
+    verbose_name = {{ Quote .AppVerboseName }}
+{{- end }}
+{{- if .Signals }}
+
+    def ready(self):
+        from . import signals  # noqa: F401
+{{- end }}
 `
 
-// main is the entry point of the CLI application.
-func main() {
-	var protoPath, outputDir string
+const permissionsTemplate = `from rest_framework import permissions
+{{ if not .CustomPermissions }}
+# Define custom permission classes here and reference them with -permission
+# or the (django.permission_classes) service option.
+{{ end }}
+{{- range .CustomPermissions }}
 
-	flag.StringVar(&protoPath, "proto", "", "Path to the .proto file")
-	flag.StringVar(&outputDir, "out", "generated_app", "Output directory for Django app")
-	flag.Parse()
+class {{ . }}(permissions.BasePermission):
+    def has_permission(self, request, view):
+        return True
 
-	if protoPath == "" {
-		log.Fatal("Please provide a .proto file with -proto flag")
+    def has_object_permission(self, request, view, obj):
+        return True
+{{ end }}
+`
+
+// stringList is a flag.Value collecting comma-separated values across repeated flags.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
 	}
+	return nil
+}
+
+// optionFlags registers the flags that set generation Options on fs, shared
+// by generation and the diff-schema subcommand.
+func optionFlags(fs *flag.FlagSet, opts *Options) {
+	fs.Var((*stringList)(&opts.APIs), "api", "API layers to generate: drf, graphql, ninja (repeatable, comma-separated; default drf)")
+	fs.BoolVar(&opts.OpenAPI, "openapi", false, "Document DRF ViewSets with drf-spectacular and mount schema/Swagger URLs")
+	fs.StringVar(&opts.DjangoVersion, "django-version", DefaultDjangoVersion, "Django release the generated dependency manifest targets")
+	fs.StringVar(&opts.Manifest, "manifest", ManifestRequirements, "Dependency manifest format: requirements or pyproject")
+	fs.StringVar(&opts.AppName, "app-name", "", "Django app name (defaults to the output directory name)")
+	fs.IntVar(&opts.StringMaxLength, "string-max-length", DefaultStringMaxLength, "max_length of string CharFields without a string.max_len rule")
+	fs.IntVar(&opts.TextThreshold, "text-threshold", 0, "Store string fields whose string.max_len exceeds this as TextFields (0 disables)")
+	fs.BoolVar(&opts.StringHeuristics, "string-heuristics", false, "Store string fields named email, *_url, slug and the like as EmailField, URLField and SlugField")
+	fs.BoolVar(&opts.DecimalHeuristics, "decimal-heuristics", false, "Store double, float and string fields named amount, price, *_amount or *_price as DecimalFields")
+	fs.BoolVar(&opts.Typed, "typed", false, "Annotate serializers, ViewSets and converters for mypy with django-stubs and add a py.typed marker")
+	fs.BoolVar(&opts.Merge, "merge", false, "Add definitions for new messages to an existing app's modules, leaving existing classes untouched")
+	fs.StringVar(&opts.ProjectRoot, "project-root", "", "Django project directory containing the output directory; adds the app to its INSTALLED_APPS and root urls.py")
+	fs.StringVar(&opts.PrimaryKey, "pk", PrimaryKeyAuto, "Primary key of generated models: auto or uuid")
+	fs.BoolVar(&opts.BaseModel, "base-model", false, "Inherit models from an abstract BaseModel with created_at/updated_at audit fields")
+	fs.BoolVar(&opts.SoftDelete, "soft-delete", false, "Soft-delete rows with is_deleted/deleted_at instead of removing them")
+	fs.BoolVar(&opts.Search, "search", false, "Add a Postgres full-text search_vector with a GIN index to models with string fields, searchable with ?search=")
+	fs.BoolVar(&opts.History, "history", false, "Record model changes with django-simple-history and browse them in the admin ('simple_history' must be in INSTALLED_APPS)")
+	fs.BoolVar(&opts.Signals, "signals", false, "Scaffold signals.py with pre_save/post_save receivers and connect it in apps.py")
+	fs.BoolVar(&opts.GeoDjango, "geodjango", false, "Store google.type.LatLng fields as GeoDjango PointFields")
+	fs.BoolVar(&opts.DjangoMoney, "django-money", false, "Store google.type.Money fields as django-money MoneyFields")
+	fs.BoolVar(&opts.OmitDeprecated, "omit-deprecated", false, "Leave fields marked [deprecated = true] out of generated serializers")
+	fs.BoolVar(&opts.ReadOnly, "read-only", false, "Generate read-only APIs for data owned by another service: ReadOnlyModelViewSets, read-only serializers and no write routes or mutations")
+	fs.StringVar(&opts.ModelMap, "model-map", "", "JSON file mapping proto message names to existing Django models (e.g. {\"auth.User\": \"settings.AUTH_USER_MODEL\"})")
+	fs.BoolVar(&opts.GRPC, "grpc", false, "Generate clients.py with grpcio client wrappers for parsed services and sync_<model> commands for List RPCs")
+	fs.BoolVar(&opts.GRPCServer, "grpc-server", false, "Generate servicers.py, handlers.py and grpc_settings.py serving the parsed services on django-socio-grpc's server, and a grpcserver command")
+	fs.StringVar(&opts.GRPCPackage, "grpc-package", "", "Python package containing the protoc-generated _pb2 modules (default: top level)")
+	fs.BoolVar(&opts.Celery, "celery", false, "Generate tasks.py with a Celery task per RPC calling the service (implies -grpc)")
+	fs.BoolVar(&opts.Channels, "channels", false, "Generate Channels consumers.py and routing.py for server-streaming and bidi RPCs (implies -grpc)")
+	fs.BoolVar(&opts.Seed, "seed", false, "Generate a seed_<app> management command creating sample rows of every model")
+	fs.StringVar(&opts.Templates, "templates", "", "Directory of templates replacing the built-in ones, each named after the file it renders, e.g. models.py")
+	fs.StringVar(&opts.Format, "format", FormatProto, "Format of the -proto inputs: proto source or descriptor, a FileDescriptorSet as written by protoc -o or buf build -o")
+	fs.IntVar(&opts.Jobs, "jobs", 0, "Maximum files parsed and rendered concurrently (default: number of CPUs)")
+	fs.BoolVar(&opts.Cache, "cache", false, "Skip generation when the protos and options are unchanged since a cached run")
+	fs.StringVar(&opts.CacheDir, "cache-dir", "", "Directory of the generation cache (default: ~/.cache/proto2django)")
+	fs.BoolVar(&opts.Strict, "strict", false, "Fail on references to message types that are not defined")
+	fs.BoolVar(&opts.SplitPackages, "split-packages", false, "Generate one app per proto package beneath the output directory")
+	fs.BoolVar(&opts.SplitFiles, "split-files", false, "Write models, serializers and viewsets as packages with a module per message")
+	fs.StringVar(&opts.Permission, "permission", "", "Default permission classes for generated ViewSets (comma-separated DRF names or dotted paths)")
+	fs.StringVar(&opts.RepeatedMessage, "repeated-message", RepeatedMessageM2M, "Storage for repeated message fields: m2m or fk")
+	fs.StringVar(&opts.RepeatedScalar, "repeated-scalar", RepeatedScalarJSON, "Storage for repeated scalar fields: arrayfield, jsonfield or child-table")
+	fs.StringVar(&opts.JSONCase, "json-case", JSONCaseSnake, "Naming of REST API JSON fields: snake, camel (proto JSON names through serializer sources) or djangorestframework-camel-case")
+	fs.StringVar(&opts.EnumUnspecified, "enum-unspecified", EnumUnspecifiedChoice, "Storage for the unspecified zero value of enums: choice or null")
+	fs.StringVar(&opts.StrField, "str-field", "", "Field returned by generated __str__ methods when present on a model")
+	fs.Var((*stringList)(&opts.Include), "include", "Glob of message names to generate (repeatable, comma-separated)")
+	fs.Var((*stringList)(&opts.Exclude), "exclude", "Glob of message names to skip (repeatable, comma-separated)")
+	fs.Var((*ruleList)(&opts.Layers), "layers", "GLOB=LAYERS rule choosing the layers generated for matching messages, of model, admin and api, e.g. 'Audit*=model,admin' (repeatable)")
+	fs.BoolVar(&opts.NullableScalars, "nullable-scalars", false, "Make singular scalar fields null=True, blank=True unless (django.field).null says otherwise")
+	fs.BoolVar(&opts.BlankStrings, "blank-strings", false, "Make string fields blank=True unless (django.field).blank says otherwise")
+	fs.StringVar(&opts.OnDelete, "on-delete", OnDeleteCascade, "on_delete policy of singular relations: CASCADE, PROTECT, SET_NULL or SET_DEFAULT")
+	fs.Var((*stringList)(&opts.OneToOne), "one-to-one", "Glob of singular message field names stored as OneToOneFields, e.g. profile (repeatable, comma-separated)")
+}
+
+// generateCommand sets up `proto2django generate`, the default command,
+// which generates the Django app for -proto into -out.
+func generateCommand(fs *flag.FlagSet) func() int {
+	var protoPaths stringList
+	var outputDir string
+	var watch, verbose, quiet, checkDrift bool
+	var logFormat, archive, errorFormat string
+	var opts Options
+	optionFlags(fs, &opts)
+
+	fs.Var(&protoPaths, "proto", "Path to a .proto file, or - to read it from stdin (repeatable, comma-separated)")
+	fs.StringVar(&outputDir, "out", "generated_app", "Output directory for Django app, or - to write an archive of it to stdout")
+	fs.StringVar(&archive, "archive", "", "Write the app as a tar or zip archive to -out instead of a directory (default tar when -out is -)")
+	fs.BoolVar(&watch, "watch", false, "Regenerate whenever the proto files change")
+	fs.BoolVar(&checkDrift, "check-drift", false, "Report generated files in the output directory that were edited by hand, without generating")
+	fs.BoolVar(&verbose, "verbose", false, "Log per-message and per-file generation decisions")
+	fs.BoolVar(&quiet, "quiet", false, "Only log errors")
+	fs.StringVar(&logFormat, "log-format", LogFormatText, "Log output format: text or json")
+	fs.StringVar(&errorFormat, "error-format", ErrorFormatText, "Error output format: text, logged like warnings, or json, a diagnostic object per line on stderr")
+	fs.StringVar(&opts.EmitIR, "emit-ir", "", "Write the parsed messages, type mappings and planned files as JSON to this path")
+
+	return func() int {
+		logger, err := newLogger(os.Stderr, verbose, quiet, logFormat)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitUsage
+		}
+		slog.SetDefault(logger)
+		if errorFormat != ErrorFormatText && errorFormat != ErrorFormatJSON {
+			slog.Error(fmt.Sprintf("unknown error format %q", errorFormat))
+			return ExitUsage
+		}
 
-	if err := GenerateApp(protoPath, outputDir); err != nil {
-		log.Fatalf("Error: %v", err)
+		if checkDrift {
+			drifted, err := CheckDrift(outputDir)
+			if err != nil {
+				slog.Error(err.Error())
+				return ExitFailure
+			}
+			for _, path := range drifted {
+				slog.Warn("generated file edited by hand", "path", path)
+			}
+			if len(drifted) > 0 {
+				return ExitFailure
+			}
+			slog.Info("no drift detected", "dir", outputDir)
+			return 0
+		}
+
+		if len(protoPaths) == 0 {
+			slog.Error("Please provide a .proto file with -proto flag")
+			return ExitUsage
+		}
+		if watch && slices.Contains(protoPaths, stdinPath) {
+			slog.Error("-watch needs proto files, not stdin")
+			return ExitUsage
+		}
+
+		if outputDir == "-" || archive != "" {
+			if watch {
+				slog.Error("-watch needs an output directory, not an archive")
+				return ExitUsage
+			}
+			if opts.ProjectRoot != "" {
+				slog.Error("-project-root needs an output directory, not an archive")
+				return ExitUsage
+			}
+			if err := generateArchive(protoPaths, outputDir, archive, opts); err != nil {
+				return reportError(os.Stderr, err, errorFormat)
+			}
+			slog.Info("Django app archived", "out", outputDir)
+			return 0
+		}
+
+		if err := GenerateApp(protoPaths, outputDir, opts); err != nil {
+			return reportError(os.Stderr, err, errorFormat)
+		}
+
+		slog.Info("Django app generated", "dir", outputDir)
+
+		if watch {
+			Watch(protoPaths, outputDir, opts)
+		}
+		return 0
 	}
+}
 
-	fmt.Println("✅ Django app generated at", outputDir)
+// main is the entry point of the CLI application.
+func main() {
+	os.Exit(runCLI(os.Args[1:]))
 }
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"regexp"
+	"text/template"
+)
+
+// managersImports opens a freshly scaffolded managers.py.
+const managersImports = "from django.db import models\n"
+
+// softDeleteImport brings the generated soft-delete base classes into managers.py.
+const softDeleteImport = "\nfrom .softdelete import SoftDeleteManager, SoftDeleteQuerySet\n"
+
+// managerPairTemplate renders the QuerySet/Manager pair for one model.
+const managerPairTemplate = `
+
+class {{ .Name }}QuerySet({{ if .SoftDelete }}SoftDeleteQuerySet{{ else }}models.QuerySet{{ end }}):
+    pass
+
+
+class {{ .Name }}Manager({{ if .SoftDelete }}SoftDeleteManager{{ else }}models.Manager{{ end }}.from_queryset({{ .Name }}QuerySet)):
+    pass
+`
+
+// softDeleteTemplate holds the base classes behind -soft-delete. They live
+// outside models.py so that the hand-maintained managers.py can extend them
+// without a circular import.
+const softDeleteTemplate = `from django.db import models
+from django.utils import timezone
+
+
+class SoftDeleteQuerySet(models.QuerySet):
+    def delete(self):
+        deleted = self.update(is_deleted=True, deleted_at=timezone.now())
+        return deleted, {self.model._meta.label: deleted}
+
+
+class SoftDeleteManager(models.Manager):
+    def get_queryset(self):
+        return super().get_queryset().filter(is_deleted=False)
+`
+
+var (
+	querySetClassRe = regexp.MustCompile(`(?m)^class (\w+)QuerySet\((\w+)`)
+	importLineRe    = regexp.MustCompile(`(?m)^(?:from|import) .*\n`)
+)
+
+// writeManagers scaffolds managers.py with a QuerySet/Manager pair per model.
+// The file belongs to the app's maintainers once written: it carries no
+// generated header, existing classes are never rewritten, and later runs only
+// append pairs for models that are new.
+func writeManagers(path string, data TemplateData) error {
+	content, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if content == nil {
+		content = []byte(managersImports)
+	}
+
+	existing := map[string]string{}
+	for _, m := range querySetClassRe.FindAllSubmatch(content, -1) {
+		existing[string(m[1])] = string(m[2])
+	}
+
+	tmpl := template.Must(template.New("managers").Parse(managerPairTemplate))
+	var added bytes.Buffer
+	needsSoftDelete := false
+	for _, msg := range data.Messages {
+		if base, ok := existing[msg.Name]; ok {
+			if msg.SoftDelete != (base == "SoftDeleteQuerySet") {
+				slog.Warn("managers.py queryset does not match the soft-delete setting, update it by hand", "model", msg.Name, "base", base)
+			}
+			continue
+		}
+		if err := tmpl.Execute(&added, msg); err != nil {
+			return err
+		}
+		needsSoftDelete = needsSoftDelete || msg.SoftDelete
+		slog.Debug("scaffolded manager", "model", msg.Name)
+	}
+	if added.Len() == 0 {
+		return nil
+	}
+
+	if needsSoftDelete && !bytes.Contains(content, []byte(softDeleteImport)) {
+		at := 0
+		for _, loc := range importLineRe.FindAllIndex(content, -1) {
+			at = loc[1]
+		}
+		content = append(content[:at:at], append([]byte(softDeleteImport), content[at:]...)...)
+	}
+	content = append(content, added.Bytes()...)
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return fmt.Errorf("failed to write managers: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+var (
+	pyDefRe    = regexp.MustCompile(`^(?:async\s+)?(?:def|class)\s+(\w+)`)
+	pyAssignRe = regexp.MustCompile(`^(\w+)\s*(?::[^=]*)?=[^=]`)
+	pyFromRe   = regexp.MustCompile(`^from\s+([\w.]+)\s+import\s+\(?([^)#]*)\)?\s*$`)
+)
+
+// pyChunk is a top-level statement of a Python module with the blank lines
+// and comments before it. Definitions and assignments are keyed by the name
+// they bind, any other statement by its text.
+type pyChunk struct {
+	text, key string
+}
+
+// pyChunks splits the Python source src into its top-level statements.
+// Trailing blank lines and comments make a last chunk with no key.
+func pyChunks(src []byte) []pyChunk {
+	// Logical lines start after newlines outside brackets and strings.
+	starts := []int{0}
+	depth := 0
+	for i := 0; i < len(src); i = pySkip(src, i) + 1 {
+		switch src[i] {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth = max(depth-1, 0)
+		case '\n':
+			if depth == 0 && (i == 0 || src[i-1] != '\\') && i+1 < len(src) {
+				starts = append(starts, i+1)
+			}
+		}
+	}
+	starts = append(starts, len(src))
+
+	var chunks []pyChunk
+	pending := ""
+	decorated := false
+	for n := 0; n+1 < len(starts); n++ {
+		line := string(src[starts[n]:starts[n+1]])
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || strings.HasPrefix(trimmed, "#"):
+			pending += line
+			continue
+		case len(chunks) > 0 && (line[0] == ' ' || line[0] == '\t' || decorated || pyClauseRe.MatchString(trimmed)):
+			chunks[len(chunks)-1].text += pending + line
+		default:
+			chunks = append(chunks, pyChunk{text: pending + line})
+		}
+		pending = ""
+		last := &chunks[len(chunks)-1]
+		decorated = strings.HasPrefix(trimmed, "@")
+		if last.key == "" && !decorated {
+			last.key = pyChunkKey(line)
+		}
+	}
+	if pending != "" {
+		chunks = append(chunks, pyChunk{text: pending})
+	}
+	return chunks
+}
+
+// pyClauseRe matches the clauses continuing a compound statement.
+var pyClauseRe = regexp.MustCompile(`^(?:elif|else|except|finally)\b`)
+
+// pyChunkKey returns the key of the top-level statement starting with line.
+func pyChunkKey(line string) string {
+	if m := pyDefRe.FindStringSubmatch(line); m != nil {
+		return "def " + m[1]
+	}
+	if m := pyAssignRe.FindStringSubmatch(line); m != nil {
+		return "= " + m[1]
+	}
+	if m := pyFromRe.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+		return "from " + m[1]
+	}
+	return strings.Join(strings.Fields(line), " ")
+}
+
+// mergePython adds the top-level statements of the Python module generated
+// that existing lacks, each after the statement preceding it in generated,
+// and the names its from-imports lack to the last import from the same
+// module. It returns the result with the keys of the statements changed.
+// Statements existing already has are otherwise kept as they are.
+func mergePython(name string, existing, generated []byte) ([]byte, []string) {
+	old := pyChunks(existing)
+	index := map[string]int{}
+	imported := map[string][]string{}
+	for i, c := range old {
+		if c.key != "" {
+			index[c.key] = i
+		}
+		if m := pyFromRe.FindStringSubmatch(pyStatement(c.text)); m != nil {
+			imported[m[1]] = append(imported[m[1]], importNames(m[2])...)
+		}
+	}
+
+	// inserts holds the new statements to add after each old one, those
+	// before the first under -1.
+	inserts := map[int][]string{}
+	inserted := map[string]bool{}
+	var added []string
+	anchor := -1
+	for _, c := range pyChunks(generated) {
+		if c.key == "" || inserted[c.key] && !strings.HasPrefix(c.key, "from ") {
+			continue
+		}
+		i, ok := index[c.key]
+		if !ok {
+			inserts[anchor] = append(inserts[anchor], c.text)
+			inserted[c.key] = true
+			added = append(added, c.key)
+			continue
+		}
+		anchor = max(anchor, i)
+		switch {
+		case strings.HasPrefix(c.key, "from "):
+			m := pyFromRe.FindStringSubmatch(pyStatement(c.text))
+			var missing []string
+			for _, n := range importNames(m[2]) {
+				if !slices.Contains(imported[m[1]], n) {
+					missing = append(missing, n)
+				}
+			}
+			if len(missing) > 0 {
+				stmt := pyStatement(old[i].text)
+				names := importNames(pyFromRe.FindStringSubmatch(stmt)[2])
+				lead := old[i].text[:strings.Index(old[i].text, stmt)]
+				old[i].text = lead + "from " + m[1] + " import " + strings.Join(append(names, missing...), ", ") + "\n"
+				imported[m[1]] = append(imported[m[1]], missing...)
+				added = append(added, c.key)
+			}
+		case strings.HasPrefix(c.key, "def ") && strings.TrimSpace(old[i].text) != strings.TrimSpace(c.text):
+			slog.Info("existing definition kept", "file", name, "name", strings.TrimPrefix(c.key, "def "))
+		}
+	}
+	if len(added) == 0 {
+		return existing, nil
+	}
+
+	var out bytes.Buffer
+	for _, text := range inserts[-1] {
+		out.WriteString(text)
+	}
+	for i, c := range old {
+		text := c.text
+		if c.key != "" && len(inserts[i]) > 0 && !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		out.WriteString(text)
+		for _, text := range inserts[i] {
+			out.WriteString(text)
+		}
+	}
+	return out.Bytes(), added
+}
+
+// pyStatement returns the statement of chunk text without the blank lines
+// and comments before it.
+func pyStatement(text string) string {
+	rest := text
+	for rest != "" {
+		line, after, _ := strings.Cut(rest, "\n")
+		if t := strings.TrimSpace(line); t != "" && !strings.HasPrefix(t, "#") {
+			break
+		}
+		rest = after
+	}
+	return strings.TrimSpace(rest)
+}
+
+// importNames returns the names imported by the list of a from-import.
+func importNames(list string) []string {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.Join(strings.Fields(name), " "); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// mergeToFile renders the template content with data and, under -merge,
+// adds what it generates to the Python module at outputPath instead of
+// replacing it. Other files, and modules not generated yet, are rendered as
+// usual. A merged file edited by hand keeps its header, so it still reads
+// as edited.
+func mergeToFile(content string, data TemplateData, outputPath string) error {
+	existing, err := os.ReadFile(outputPath)
+	if errors.Is(err, fs.ErrNotExist) || !strings.HasSuffix(outputPath, ".py") {
+		return renderToFile(content, data, outputPath)
+	}
+	if err != nil {
+		return err
+	}
+	tmpl, err := template.New("template").Funcs(funcMap).Parse(content)
+	if err != nil {
+		return fmt.Errorf("failed to parse template: %w", err)
+	}
+	var generated bytes.Buffer
+	if err := tmpl.Execute(&generated, data); err != nil {
+		return err
+	}
+	return mergeGenerated(existing, generated.Bytes(), data, outputPath)
+}
+
+// mergeGenerated adds what the Python module generated defines to existing,
+// the content of outputPath, like mergeToFile.
+func mergeGenerated(existing, generated []byte, data TemplateData, outputPath string) error {
+	header, body := splitHeader(existing)
+	merged, added := mergePython(filepath.Base(outputPath), body, generated)
+	if len(added) == 0 {
+		return nil
+	}
+	slog.Info("merged new definitions", "path", outputPath, "added", len(added))
+	if edited, ok := hasDrifted(existing); ok && !edited {
+		return writeGenerated(outputPath, merged, data)
+	}
+	check := newTemplateCheck(filepath.Base(outputPath))
+	check.Write(merged)
+	if err := check.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(outputPath, append(header, merged...), 0644)
+}
+
+// splitHeader splits content into its generated-file header, if any, and
+// the body that follows.
+func splitHeader(content []byte) (header, body []byte) {
+	n := 0
+	for _, prefix := range []string{headerPrefix, checksumPrefix} {
+		end := bytes.IndexByte(content[n:], '\n')
+		if end < 0 || !bytes.HasPrefix(content[n:], []byte(prefix)) {
+			break
+		}
+		n += end + 1
+	}
+	return content[:n], content[n:]
+}
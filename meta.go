@@ -0,0 +1,72 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+)
+
+// metaOption is the prefix of the message options rendered into the
+// model's Meta: (django.meta).indexes and (django.meta).unique_together,
+// each a comma-separated list of fields, with several sets separated by
+// semicolons, e.g. "user,slug; tenant,code".
+const metaOption = "django.meta"
+
+// modelMeta renders the Meta.indexes and Meta.constraints of the model
+// generated from msg with fields. Fields are named by their proto or model
+// name; sets naming a field the model lacks, or a many-to-many field, are
+// left out with a warning.
+func modelMeta(msg ProtoMessage, fields []RenderedField) (indexes, constraints []string) {
+	for _, set := range fieldSets(msg, fields, "indexes") {
+		indexes = append(indexes, "models.Index(fields=["+quotedList(set)+"])")
+	}
+	for _, set := range fieldSets(msg, fields, "unique_together") {
+		name := "%(app_label)s_%(class)s_" + strings.Join(set, "_") + "_uniq"
+		constraints = append(constraints, "models.UniqueConstraint(fields=["+quotedList(set)+"], name='"+name+"')")
+	}
+	return indexes, constraints
+}
+
+// fieldSets returns the sets of model field names of the (django.meta)
+// option key of msg.
+func fieldSets(msg ProtoMessage, fields []RenderedField, key string) [][]string {
+	var sets [][]string
+	for _, text := range strings.Split(msg.Options[metaOption+"."+key], ";") {
+		var set []string
+		for _, name := range strings.Split(text, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			field, ok := metaField(fields, name)
+			if !ok {
+				slog.Warn("meta option names an unknown field, ignored", "message", msg.Name, "option", key, "field", name)
+				set = nil
+				break
+			}
+			set = append(set, field)
+		}
+		if len(set) > 0 {
+			sets = append(sets, set)
+		}
+	}
+	return sets
+}
+
+// metaField returns the model name of the field called name, by its proto
+// or model name, that can be indexed.
+func metaField(fields []RenderedField, name string) (string, bool) {
+	for _, f := range fields {
+		if (f.ProtoName == name || f.Name == name || f.Name == snakeCase(name)) && !strings.Contains(f.DjangoType, "ManyToManyField") {
+			return f.Name, true
+		}
+	}
+	return "", false
+}
+
+// quotedList renders names as a comma-separated list of Python strings.
+func quotedList(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = "'" + name + "'"
+	}
+	return strings.Join(quoted, ", ")
+}
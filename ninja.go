@@ -0,0 +1,149 @@
+package main
+
+// NinjaType maps a rendered field to the annotation used on the generated
+// Ninja input schema. Every input field is optional so the same schema serves
+// partial updates; relations are accepted by primary key.
+func NinjaType(f RenderedField) string {
+	typ := "int"
+	if f.RelatedUUID {
+		typ = "UUID"
+	}
+	if isScalar(f.Type) {
+		switch f.Type {
+		case "string":
+			typ = "str"
+		case "bytes":
+			typ = "bytes"
+		case "bool":
+			typ = "bool"
+		case "float", "double":
+			typ = "float"
+		case dateType:
+			typ = "date"
+		case timestampType:
+			typ = "datetime"
+		case moneyType:
+			typ = "Decimal"
+		case latLngType:
+			typ = "dict"
+			if isPointField(f) {
+				typ = "str"
+			}
+		}
+		if isDecimalField(f) {
+			typ = "Decimal"
+		}
+	}
+	if f.Repeated {
+		typ = "List[" + typ + "]"
+	}
+	return "Optional[" + typ + "] = None"
+}
+
+// markUUIDRelations sets RelatedUUID on the relations of messages to models
+// of messages with a UUID primary key.
+func markUUIDRelations(messages []RenderedMessage) {
+	uuids := map[string]bool{}
+	for _, msg := range messages {
+		uuids[msg.Name] = msg.UUIDPrimaryKey
+	}
+	for _, msg := range messages {
+		for _, fields := range [][]RenderedField{msg.Fields, msg.InputFields} {
+			for i := range fields {
+				fields[i].RelatedUUID = !isScalar(fields[i].Type) && uuids[modelClass(fields[i].Type)]
+			}
+		}
+	}
+}
+
+// NinjaImports returns the standard library imports of api.py in import order.
+func NinjaImports(data TemplateData) []string {
+	var dates, timestamps, decimals bool
+	for _, msg := range data.APIMessages {
+		for _, f := range msg.Fields {
+			dates = dates || f.Type == dateType
+			timestamps = timestamps || f.Type == timestampType
+			decimals = decimals || f.Type == moneyType || isDecimalField(f)
+		}
+	}
+	var imports []string
+	switch {
+	case dates && timestamps:
+		imports = append(imports, "from datetime import date, datetime")
+	case dates:
+		imports = append(imports, "from datetime import date")
+	case timestamps:
+		imports = append(imports, "from datetime import datetime")
+	}
+	if decimals {
+		imports = append(imports, "from decimal import Decimal")
+	}
+	imports = append(imports, "from typing import List, Optional")
+	if data.UUID {
+		imports = append(imports, "from uuid import UUID")
+	}
+	return imports
+}
+
+const ninjaTemplate = `{{ range NinjaImports . }}{{ . }}
+{{ end }}
+from django.shortcuts import get_object_or_404
+from ninja import ModelSchema, Router{{ if not .ReadOnly }}, Schema{{ end }}
+
+from .models import {{ range $i, $m := .APIMessages }}{{ if $i }}, {{ end }}{{ $m.Name }}{{ end }}
+{{- if not .ReadOnly }}
+from .utils import save_instance
+{{- end }}
+
+router = Router()
+{{ range .APIMessages }}
+{{- if not $.ReadOnly }}
+
+class {{ .Name }}In(Schema):
+{{- range .InputFields }}
+    {{ .Name }}: {{ NinjaType . }}
+{{- else }}
+    pass
+{{- end }}
+{{ end }}
+
+class {{ .Name }}Out(ModelSchema):
+    class Meta:
+        model = {{ .Name }}
+{{- if .SearchFields }}
+        exclude = ['search_vector']
+{{- else }}
+        fields = '__all__'
+{{- end }}
+
+
+@router.get('/{{ .RoutePrefix }}', response=List[{{ .Name }}Out], tags=['{{ .Name }}'])
+def list_{{ .PluralName }}(request):
+    return {{ .Name }}.objects.all()
+{{- if not $.ReadOnly }}
+
+
+@router.post('/{{ .RoutePrefix }}', response={201: {{ .Name }}Out}, tags=['{{ .Name }}'])
+def create_{{ .SnakeName }}(request, payload: {{ .Name }}In):
+    return 201, save_instance({{ .Name }}(), payload.dict(exclude_unset=True))
+{{- end }}
+
+
+@router.get('/{{ .RoutePrefix }}/{pk}', response={{ .Name }}Out, tags=['{{ .Name }}'])
+def get_{{ .SnakeName }}(request, pk: {{ if .UUIDPrimaryKey }}UUID{{ else }}int{{ end }}):
+    return get_object_or_404({{ .Name }}, pk=pk)
+{{- if not $.ReadOnly }}
+
+
+@router.put('/{{ .RoutePrefix }}/{pk}', response={{ .Name }}Out, tags=['{{ .Name }}'])
+def update_{{ .SnakeName }}(request, pk: {{ if .UUIDPrimaryKey }}UUID{{ else }}int{{ end }}, payload: {{ .Name }}In):
+    instance = get_object_or_404({{ .Name }}, pk=pk)
+    return save_instance(instance, payload.dict(exclude_unset=True{{ if .ImmutableAttrs }}, exclude={{ "{" }}{{ range $i, $name := .ImmutableAttrs }}{{ if $i }}, {{ end }}'{{ $name }}'{{ end }}{{ "}" }}{{ end }}))
+
+
+@router.delete('/{{ .RoutePrefix }}/{pk}', response={204: None}, tags=['{{ .Name }}'])
+def delete_{{ .SnakeName }}(request, pk: {{ if .UUIDPrimaryKey }}UUID{{ else }}int{{ end }}):
+    get_object_or_404({{ .Name }}, pk=pk).{{ if .SoftDelete }}soft_delete{{ else }}delete{{ end }}()
+    return 204, None
+{{- end }}
+{{ end }}`
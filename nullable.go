@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Field options overriding the -nullable-scalars and -blank-strings
+// policies: [(django.field).null = true] and [(django.field).blank = false].
+const (
+	nullOption  = fieldOption + ".null"
+	blankOption = fieldOption + ".blank"
+)
+
+// nullability returns whether the singular field f, declared as djangoType,
+// is nullable and may be blank. Scalars are nullable and blank under
+// -nullable-scalars and strings may be blank under -blank-strings, unless
+// f is labelled: optional fields are always nullable and blank and required
+// ones never. (django.field).null and .blank options override all of these as well as what
+// djangoType already declares; null = true implies blank unless the blank
+// option is set.
+func nullability(f ProtoField, djangoType string, opts Options) (null, blank bool, err error) {
+	null = strings.Contains(djangoType, "null=True")
+	blank = strings.Contains(djangoType, "blank=True")
+	if isScalar(f.Type) {
+		null = null || opts.NullableScalars
+		blank = blank || opts.NullableScalars || opts.BlankStrings && f.Type == "string"
+	}
+	switch f.Label {
+	case LabelOptional:
+		null, blank = true, true
+	case LabelRequired:
+		null, blank = false, false
+	}
+	for _, o := range []struct {
+		name  string
+		value *bool
+	}{{nullOption, &null}, {blankOption, &blank}} {
+		switch v := f.Options[o.name]; v {
+		case "":
+		case "true":
+			*o.value = true
+		case "false":
+			*o.value = false
+		default:
+			err = fmt.Errorf("invalid %s %q", o.name, v)
+		}
+	}
+	// A nullable field has nothing to require, unless told otherwise.
+	if f.Options[nullOption] == "true" && f.Options[blankOption] == "" {
+		blank = true
+	}
+	return null, blank, err
+}
+
+// withNullability sets the null and blank kwargs of djangoType, leaving
+// them out when false.
+func withNullability(djangoType string, null, blank bool) string {
+	for _, kwarg := range []string{"null=True", "blank=True"} {
+		djangoType = strings.Replace(djangoType, ", "+kwarg, "", 1)
+		djangoType = strings.Replace(djangoType, "("+kwarg+")", "()", 1)
+	}
+	switch {
+	case null && blank:
+		djangoType = addKwarg(djangoType, "null=True, blank=True")
+	case null:
+		djangoType = addKwarg(djangoType, "null=True")
+	case blank:
+		djangoType = addKwarg(djangoType, "blank=True")
+	}
+	return djangoType
+}
@@ -0,0 +1,32 @@
+package main
+
+import "regexp"
+
+// oneofRe matches the start of a oneof in a message body, up to its opening
+// brace.
+var oneofRe = regexp.MustCompile(`\boneof\s+(\w+)\s*{`)
+
+// oneofAt returns a function giving the oneof a field declared at an offset
+// of body belongs to, "" for none.
+func oneofAt(body string) func(offset int) string {
+	type span struct {
+		name       string
+		start, end int
+	}
+	var spans []span
+	for _, loc := range oneofRe.FindAllStringSubmatchIndex(body, -1) {
+		end := bracketEnd(body, loc[1]-1)
+		if end < 0 {
+			end = len(body)
+		}
+		spans = append(spans, span{body[loc[2]:loc[3]], loc[1], end})
+	}
+	return func(offset int) string {
+		for _, s := range spans {
+			if s.start <= offset && offset < s.end {
+				return s.name
+			}
+		}
+		return ""
+	}
+}
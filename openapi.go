@@ -0,0 +1,57 @@
+package main
+
+import "strings"
+
+// crudActions returns the ViewSet actions implemented by an RPC that follows
+// the standard method naming for a resource (GetUser, ListUsers, CreateUser,
+// UpdateUser, DeleteUser), or nil for any other method.
+func crudActions(method, className string) []string {
+	plural := pascalCase(strings.ReplaceAll(routePrefix(className), "-", "_"))
+	switch method {
+	case "Get" + className:
+		return []string{"retrieve"}
+	case "List" + plural, "List" + className + "s":
+		return []string{"list"}
+	case "Create" + className:
+		return []string{"create"}
+	case "Update" + className:
+		return []string{"update", "partial_update"}
+	case "Delete" + className:
+		return []string{"destroy"}
+	}
+	return nil
+}
+
+// schemaDecorators builds the drf-spectacular decorators for a model's
+// ViewSet: tags naming every service that exchanges the message, and
+// per-action descriptions taken from the comments of its CRUD RPCs.
+func schemaDecorators(services []ProtoService, msgName string) []string {
+	className := pascalCase(msgName)
+	var tags, actions []string
+	for _, svc := range services {
+		for _, m := range svc.Methods {
+			if m.InputType == msgName || m.OutputType == msgName {
+				tags = appendUnique(tags, svc.Name)
+			}
+			if m.Comment == "" {
+				continue
+			}
+			for _, action := range crudActions(m.Name, className) {
+				actions = append(actions, "    "+action+"=extend_schema(description="+pyString(m.Comment)+"),")
+			}
+		}
+	}
+
+	var decorators []string
+	if len(tags) > 0 {
+		quoted := make([]string, len(tags))
+		for i, tag := range tags {
+			quoted[i] = pyString(tag)
+		}
+		decorators = append(decorators, "@extend_schema(tags=["+strings.Join(quoted, ", ")+"])")
+	}
+	if len(actions) > 0 {
+		decorators = append(decorators, "@extend_schema_view(\n"+strings.Join(actions, "\n")+"\n)")
+	}
+	return decorators
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// skipLiteral returns the offset just past the string literal or comment
+// starting at text[i], or i itself when none starts there.
+func skipLiteral(text string, i int) int {
+	switch {
+	case text[i] == '"' || text[i] == '\'':
+		for j := i + 1; j < len(text); j++ {
+			switch text[j] {
+			case '\\':
+				j++
+			case text[i]:
+				return j + 1
+			}
+		}
+		return len(text)
+	case strings.HasPrefix(text[i:], "//"):
+		if end := strings.IndexByte(text[i:], '\n'); end >= 0 {
+			return i + end
+		}
+		return len(text)
+	case strings.HasPrefix(text[i:], "/*"):
+		if end := strings.Index(text[i+2:], "*/"); end >= 0 {
+			return i + 2 + end + 2
+		}
+		return len(text)
+	}
+	return i
+}
+
+// bracketEnd returns the offset of the bracket closing the one at text[open],
+// ignoring brackets inside string literals and comments, or -1 when the
+// bracket is never closed.
+func bracketEnd(text string, open int) int {
+	closer := map[byte]byte{'{': '}', '[': ']', '(': ')'}[text[open]]
+	depth := 0
+	for i := open; i < len(text); i++ {
+		if j := skipLiteral(text, i); j != i {
+			i = j - 1
+			continue
+		}
+		switch text[i] {
+		case text[open]:
+			depth++
+		case closer:
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// fieldOptionsText returns the bracketed option list following a field
+// number at text[offset:], without the brackets, and the offset just past it.
+func fieldOptionsText(text string, offset int) (string, int) {
+	i := offset
+	for i < len(text) && (text[i] == ' ' || text[i] == '\t' || text[i] == '\n' || text[i] == '\r') {
+		i++
+	}
+	if i >= len(text) || text[i] != '[' {
+		return "", offset
+	}
+	end := bracketEnd(text, i)
+	if end < 0 {
+		return text[i+1:], len(text)
+	}
+	return text[i+1 : end], end + 1
+}
+
+// optionTokens splits option text into string literals (kept quoted),
+// punctuation and runs of name or number characters.
+func optionTokens(text string) []string {
+	var tokens []string
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"' || c == '\'' || strings.HasPrefix(text[i:], "//") || strings.HasPrefix(text[i:], "/*"):
+			j := skipLiteral(text, i)
+			if c == '"' || c == '\'' {
+				tokens = append(tokens, text[i:j])
+			}
+			i = j
+		case strings.IndexByte("{}[]():,;=", c) >= 0:
+			tokens = append(tokens, string(c))
+			i++
+		default:
+			j := i
+			for j < len(text) && strings.IndexByte(" \t\n\r\"'{}[]():,;=", text[j]) < 0 {
+				j++
+			}
+			tokens = append(tokens, text[i:j])
+			i = j
+		}
+	}
+	return tokens
+}
+
+// optionParser flattens option assignments into dotted keys, so that
+// `(buf.validate.field).string = {max_len: 5}` and
+// `(buf.validate.field).string.max_len = 5` both yield
+// buf.validate.field.string.max_len = 5. List values and repeated
+// assignments to the same key are comma-joined.
+type optionParser struct {
+	tokens  []string
+	pos     int
+	options map[string]string
+}
+
+// parseOptionList parses the contents of a field's [...] option list, or a
+// block of `option (...) = ...;` statements such as an RPC body.
+func parseOptionList(text string) map[string]string {
+	p := &optionParser{tokens: optionTokens(text), options: map[string]string{}}
+	for p.pos < len(p.tokens) {
+		switch p.peek() {
+		case ",", ";", "option":
+			p.pos++
+			continue
+		}
+		start := p.pos
+		name := p.name()
+		if p.peek() == "=" {
+			p.pos++
+			p.value(name)
+		}
+		if p.pos == start {
+			p.pos++
+		}
+	}
+	return p.options
+}
+
+func (p *optionParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+// name reads an option name: a plain identifier or a parenthesized extension,
+// optionally followed by a .sub.field path.
+func (p *optionParser) name() string {
+	var b strings.Builder
+	for {
+		switch tok := p.peek(); {
+		case tok == "(":
+			p.pos++
+			b.WriteString(p.peek())
+			p.pos++
+			if p.peek() == ")" {
+				p.pos++
+			}
+		case tok != "" && strings.IndexByte("{}[]():,;=\"'", tok[0]) < 0:
+			b.WriteString(tok)
+			p.pos++
+		default:
+			return b.String()
+		}
+	}
+}
+
+// value reads a scalar, list or message literal assigned to key.
+func (p *optionParser) value(key string) {
+	switch tok := p.peek(); tok {
+	case "{":
+		p.pos++
+		for p.pos < len(p.tokens) && p.peek() != "}" {
+			switch p.peek() {
+			case ",", ";":
+				p.pos++
+				continue
+			}
+			start := p.pos
+			field := p.name()
+			if p.peek() == ":" {
+				p.pos++
+			}
+			if field != "" {
+				p.value(key + "." + field)
+			}
+			if p.pos == start {
+				p.pos++
+			}
+		}
+		p.pos++
+	case "[":
+		p.pos++
+		var items []string
+		for p.pos < len(p.tokens) && p.peek() != "]" {
+			if tok := p.peek(); tok != "," {
+				items = append(items, unquoteOption(tok))
+			}
+			p.pos++
+		}
+		p.pos++
+		p.set(key, strings.Join(items, ","))
+	case "":
+	default:
+		p.pos++
+		p.set(key, unquoteOption(tok))
+	}
+}
+
+func (p *optionParser) set(key, value string) {
+	if prev, ok := p.options[key]; ok {
+		value = prev + "," + value
+	}
+	p.options[key] = value
+}
+
+// unquoteOption decodes a proto string literal, leaving other tokens as-is.
+func unquoteOption(tok string) string {
+	if len(tok) < 2 || (tok[0] != '"' && tok[0] != '\'') {
+		return tok
+	}
+	if tok[0] == '\'' {
+		tok = `"` + strings.ReplaceAll(strings.ReplaceAll(tok[1:len(tok)-1], `\'`, `'`), `"`, `\"`) + `"`
+	}
+	if s, err := strconv.Unquote(tok); err == nil {
+		return s
+	}
+	return tok[1 : len(tok)-1]
+}
+
+// mergeOptions adds the options of from missing in into it, allocating it
+// when needed, and returns it.
+func mergeOptions(into, from map[string]string) map[string]string {
+	for key, value := range from {
+		if into == nil {
+			into = map[string]string{}
+		}
+		if _, ok := into[key]; !ok {
+			into[key] = value
+		}
+	}
+	return into
+}
+
+// optionStatements returns the `option ... ;` statements at the top level of
+// a block body, for parseOptionList. Bracketed text, such as field option
+// lists and oneof bodies, and literals and comments are skipped.
+func optionStatements(body string) string {
+	identByte := func(c byte) bool {
+		return c == '_' || c == '.' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+	}
+	var b strings.Builder
+	for i := 0; i < len(body); i++ {
+		if j := skipLiteral(body, i); j != i {
+			i = j - 1
+			continue
+		}
+		if strings.IndexByte("{[(", body[i]) >= 0 {
+			if end := bracketEnd(body, i); end >= 0 {
+				i = end
+				continue
+			}
+			break
+		}
+		if !strings.HasPrefix(body[i:], "option") || (i > 0 && identByte(body[i-1])) || (i+6 < len(body) && identByte(body[i+6])) {
+			continue
+		}
+		end := i
+		for end < len(body) && body[end] != ';' {
+			if j := skipLiteral(body, end); j != end {
+				end = j
+				continue
+			}
+			if strings.IndexByte("{[(", body[end]) >= 0 {
+				if close := bracketEnd(body, end); close >= 0 {
+					end = close + 1
+					continue
+				}
+				end = len(body)
+				break
+			}
+			end++
+		}
+		if end == len(body) {
+			b.WriteString(body[i:])
+			break
+		}
+		b.WriteString(body[i : end+1])
+		b.WriteByte('\n')
+		i = end
+	}
+	return b.String()
+}
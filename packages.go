@@ -0,0 +1,427 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// modelRef locates the Django model generated for a proto message, or the
+// existing model it is mapped onto when External is set. Enum is set for
+// the choices class of an enum instead.
+type modelRef struct {
+	App      string
+	Message  string
+	External *externalModel
+	Enum     bool
+}
+
+// typeRegistry maps fully-qualified proto message and enum names to their
+// models and choices classes.
+type typeRegistry map[string]modelRef
+
+// resolve looks up a message type referenced from package pkg, following
+// protobuf scoping: absolute names (leading dot) are used as-is, otherwise the
+// enclosing package scopes are searched from innermost to outermost.
+func (r typeRegistry) resolve(pkg, typ string) (modelRef, bool) {
+	if strings.HasPrefix(typ, ".") {
+		ref, ok := r[typ[1:]]
+		return ref, ok
+	}
+	scope := pkg
+	for {
+		name := typ
+		if scope != "" {
+			name = scope + "." + typ
+		}
+		if ref, ok := r[name]; ok {
+			return ref, true
+		}
+		if scope == "" {
+			return modelRef{}, false
+		}
+		if i := strings.LastIndex(scope, "."); i >= 0 {
+			scope = scope[:i]
+		} else {
+			scope = ""
+		}
+	}
+}
+
+// qualifiedName joins a package and message name the way protoc does.
+func qualifiedName(pkg, name string) string {
+	if pkg == "" {
+		return name
+	}
+	return pkg + "." + name
+}
+
+// versionSegmentRe matches proto package version components like v1 or v2beta1.
+var versionSegmentRe = regexp.MustCompile(`^v\d+((alpha|beta)\d*)?$`)
+
+// packageAppName derives a Django app name from a proto package by dropping
+// version components and taking the last remaining segment (billing.v1 becomes
+// billing).
+func packageAppName(pkg string) string {
+	segments := strings.Split(pkg, ".")
+	for i := len(segments) - 1; i >= 0; i-- {
+		if !versionSegmentRe.MatchString(segments[i]) {
+			return snakeCase(segments[i])
+		}
+	}
+	return ""
+}
+
+// siblingModule returns the module of the generated app named app, which
+// -split-packages places beside the app whose module is module.
+func siblingModule(module, app string) string {
+	return module[:strings.LastIndex(module, ".")+1] + app
+}
+
+// resolveTypes rewrites the message references in file so that models in the
+// same app are named by their plain message name and models in other apps as
+// app.Message. References to undefined types are errors in strict mode;
+// otherwise unqualified ones fall back to a ForeignKey on a same-named model
+// and qualified ones, which cannot name a local model, are dropped. Either
+// way a warning with the declaration's position is logged.
+func resolveTypes(file *ProtoFile, appName string, registry typeRegistry, strict bool) error {
+	ref := func(typ string) (string, bool) {
+		r, ok := registry.resolve(file.Package, typ)
+		switch {
+		case !ok:
+			return typ, false
+		case r.External != nil:
+			if r.External.Module != "" {
+				if file.Externals == nil {
+					file.Externals = map[string]string{}
+				}
+				file.Externals[r.External.Label] = r.External.Module
+			}
+			return r.External.Label, true
+		case r.App == appName:
+			return r.Message, true
+		default:
+			return r.App + "." + r.Message, true
+		}
+	}
+
+	var errs []error
+	for i := range file.Messages {
+		msg := &file.Messages[i]
+		var fields []ProtoField
+		for _, f := range msg.Fields {
+			if typ, ok := wellKnownType(f.Type); ok {
+				f.Type = typ
+			}
+			if r, ok := resolveEnum(registry, file.Package, f.Type); ok {
+				// Enums are int32 on the wire; only those of the app
+				// itself have a choices class to check them against.
+				f.Type = "int32"
+				if r.App == appName {
+					f.Enum = r.Message
+				}
+				fields = append(fields, f)
+				continue
+			}
+			if !isScalar(f.Type) {
+				typ, ok := ref(f.Type)
+				if !ok {
+					pos := fmt.Sprintf("%s:%d:%d", msg.Source, f.Line, f.Column)
+					switch {
+					case strict && isWellKnownPackage(f.Type):
+						errs = append(errs, errorAt(CodeUnsupportedType, msg.Source, f.Line, f.Column, "%s.%s has unsupported type %s", msg.Name, f.Name, f.Type))
+						continue
+					case strict:
+						errs = append(errs, errorAt(CodeUndefinedType, msg.Source, f.Line, f.Column, "%s.%s references undefined type %s", msg.Name, f.Name, f.Type))
+						continue
+					case strings.Contains(f.Type, "."):
+						slog.Warn("field has unknown type, omitted", "pos", pos, "message", msg.Name, "field", f.Name, "type", f.Type)
+						continue
+					default:
+						slog.Warn("field has unknown type, falling back to ForeignKey", "pos", pos, "message", msg.Name, "field", f.Name, "type", f.Type)
+					}
+				}
+				f.Type = typ
+			}
+			fields = append(fields, f)
+		}
+		msg.Fields = fields
+	}
+	for i := range file.Services {
+		for j := range file.Services[i].Methods {
+			m := &file.Services[i].Methods[j]
+			m.InputType, _ = ref(m.InputType)
+			m.OutputType, _ = ref(m.OutputType)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// resolveEnum looks up the enum type referenced from package pkg. Nested
+// enums are registered by their own name, so a reference qualified by the
+// enclosing message, such as Order.Status, falls back to its last segment.
+func resolveEnum(registry typeRegistry, pkg, typ string) (modelRef, bool) {
+	r, ok := registry.resolve(pkg, typ)
+	if !ok && strings.Contains(strings.TrimPrefix(typ, "."), ".") {
+		r, ok = registry.resolve(pkg, typ[strings.LastIndex(typ, ".")+1:])
+	}
+	return r, ok && r.Enum
+}
+
+// combineHashes folds another source hash into an accumulated one; a single
+// source keeps its own hash so headers match `sha256sum foo.proto`.
+func combineHashes(acc, next string) string {
+	if acc == "" {
+		return next
+	}
+	return sourceHash([]byte(acc + next))
+}
+
+// modelTarget returns the lazy reference used for a related model: the class
+// name for models in the same app and app_label.ClassName for other apps.
+func modelTarget(typ string) string {
+	if i := strings.LastIndex(typ, "."); i >= 0 {
+		return typ[:i+1] + pascalCase(typ[i+1:])
+	}
+	return pascalCase(typ)
+}
+
+// modelClass returns the class name of a (possibly app-qualified) model reference.
+func modelClass(typ string) string {
+	return pascalCase(typ[strings.LastIndex(typ, ".")+1:])
+}
+
+// GenerateApp parses the given .proto files and generates a Django app in
+// outputDir, or one app per proto package beneath it with SplitPackages.
+func GenerateApp(protoPaths []string, outputDir string, opts Options) error {
+	var dir, key string
+	if opts.Cache && slices.Contains(protoPaths, stdinPath) {
+		slog.Warn("input read from stdin is not cached")
+		opts.Cache = false
+	}
+	if opts.Cache {
+		var err error
+		if dir, err = cacheDir(opts.CacheDir); err != nil {
+			return err
+		}
+		if key, err = cacheKey(protoPaths, outputDir, opts); err != nil {
+			return err
+		}
+		if ir, ok := loadCached(dir, key, outputDir); ok {
+			slog.Info("inputs unchanged, generation skipped", "dir", outputDir)
+			return finishApp(ir, opts)
+		}
+	}
+
+	ir, err := generateApps(protoPaths, outputDir, opts)
+	if err != nil {
+		return err
+	}
+	if opts.Cache {
+		if err := storeCache(dir, key, outputDir, ir); err != nil {
+			slog.Warn("failed to cache generated app", "err", err)
+		}
+	}
+	return finishApp(ir, opts)
+}
+
+// finishApp wires the generated apps of ir into the -project-root and
+// writes the -emit-ir dump.
+func finishApp(ir IR, opts Options) error {
+	if opts.ProjectRoot != "" && !opts.DryRun {
+		if err := WireProject(opts.ProjectRoot, ir); err != nil {
+			return err
+		}
+	}
+	if opts.EmitIR != "" {
+		return writeIR(opts.EmitIR, ir)
+	}
+	return nil
+}
+
+// generateApps does the work of GenerateApp and returns the plan of every
+// app, which is all it does with DryRun.
+func generateApps(protoPaths []string, outputDir string, opts Options) (IR, error) {
+	if err := checkStdin(protoPaths); err != nil {
+		return IR{}, err
+	}
+	// One limiter bounds the parsing, the apps and the files each renders.
+	limit := newLimiter(opts.Jobs)
+	parsed := make([][]*ProtoFile, len(protoPaths))
+	err := parallel(len(protoPaths), limit, func(i int) error {
+		var err error
+		if parsed[i], err = parseInput(protoPaths[i], opts.Format); err != nil {
+			return err
+		}
+		for _, file := range parsed[i] {
+			if err := validateProto(file); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return IR{}, err
+	}
+	files := slices.Concat(parsed...)
+
+	apps, defaultApp, err := resolveApps(files, outputDir, opts)
+	if err != nil {
+		return IR{}, err
+	}
+
+	names, dirs := appDirs(apps, defaultApp, outputDir, opts)
+	appError := func(i int, err error) error {
+		if opts.SplitPackages {
+			return fmt.Errorf("app %s: %w", names[i], err)
+		}
+		return err
+	}
+
+	// Every app is prepared and checked for conflicts before any is written.
+	prepared := make([]*preparedApp, len(names))
+	err = parallel(len(names), limit, func(i int) error {
+		app, err := prepareApp(apps[names[i]], dirs[i], names[i], opts)
+		if err != nil {
+			return appError(i, err)
+		}
+		prepared[i] = app
+		return nil
+	})
+	if err != nil {
+		return IR{}, err
+	}
+	if err := checkConflicts(prepared); err != nil {
+		return IR{}, err
+	}
+
+	ir := IR{Version: Version, Apps: make([]AppPlan, len(names))}
+	err = parallel(len(names), limit, func(i int) error {
+		plan, err := writeApp(prepared[i], limit)
+		if err != nil {
+			return appError(i, err)
+		}
+		ir.Apps[i] = *plan
+		return nil
+	})
+	if err != nil {
+		return IR{}, err
+	}
+	return ir, nil
+}
+
+// appDirs returns the names of the apps resolveApps returned, in order, and
+// the directories they are generated into.
+func appDirs(apps map[string]*ProtoFile, defaultApp, outputDir string, opts Options) ([]string, []string) {
+	if !opts.SplitPackages {
+		return []string{defaultApp}, []string{outputDir}
+	}
+	var names []string
+	for name := range apps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	dirs := make([]string, len(names))
+	for i, name := range names {
+		dirs[i] = filepath.Join(outputDir, name)
+	}
+	return names, dirs
+}
+
+// resolveApps resolves the field types of the parsed files against each
+// other and the -model-map, and merges them into apps keyed by name. It also
+// returns the name of the app files go to without -split-packages.
+func resolveApps(files []*ProtoFile, outputDir string, opts Options) (map[string]*ProtoFile, string, error) {
+	if opts.SplitPackages && opts.AppName != "" {
+		return nil, "", fmt.Errorf("-app-name cannot be combined with -split-packages")
+	}
+	defaultApp := opts.AppName
+	if defaultApp == "" && !opts.SplitPackages {
+		name, err := optionAppName(files)
+		if err != nil {
+			return nil, "", err
+		}
+		defaultApp = name
+	}
+	if defaultApp == "" {
+		defaultApp = filepath.Base(outputDir)
+	}
+	// With -split-packages, files go to the app their (django.app).name
+	// option names, or else to the app of their package.
+	appFor := func(file *ProtoFile) string {
+		switch {
+		case !opts.SplitPackages:
+			return defaultApp
+		case file.Options[appNameOption] != "":
+			return file.Options[appNameOption]
+		case file.Package != "":
+			return packageAppName(file.Package)
+		}
+		return defaultApp
+	}
+
+	externals := map[string]externalModel{}
+	if opts.ModelMap != "" {
+		var err error
+		if externals, err = loadModelMap(opts.ModelMap); err != nil {
+			return nil, "", err
+		}
+	}
+
+	registry := typeRegistry{}
+	for _, file := range files {
+		var kept []ProtoMessage
+		for _, msg := range file.Messages {
+			name := qualifiedName(file.Package, msg.Name)
+			if _, ok := externals[name]; ok {
+				slog.Debug("message mapped to existing model, not generated", "message", name)
+				continue
+			}
+			registry[name] = modelRef{App: appFor(file), Message: msg.Name}
+			kept = append(kept, msg)
+		}
+		file.Messages = kept
+		for _, enum := range file.Enums {
+			registry[qualifiedName(file.Package, enum.Name)] = modelRef{App: appFor(file), Message: enum.Name, Enum: true}
+		}
+	}
+	for name, m := range externals {
+		registry[name] = modelRef{External: &m}
+	}
+
+	apps := map[string]*ProtoFile{}
+	declared := map[string]map[string]string{}
+	var errs []error
+	for _, file := range files {
+		app := appFor(file)
+		if err := resolveTypes(file, app, registry, opts.Strict); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		merged, ok := apps[app]
+		if !ok {
+			merged = &ProtoFile{Package: file.Package}
+			apps[app] = merged
+			declared[app] = map[string]string{}
+		}
+		merged.Sources = append(merged.Sources, file.Sources...)
+		merged.SourceHash = combineHashes(merged.SourceHash, file.SourceHash)
+		mergeVersioned(merged, file, declared[app])
+		merged.Options = mergeOptions(merged.Options, file.Options)
+		for label, module := range file.Externals {
+			if merged.Externals == nil {
+				merged.Externals = map[string]string{}
+			}
+			merged.Externals[label] = module
+		}
+	}
+	if len(errs) > 0 {
+		return nil, "", errors.Join(errs...)
+	}
+	return apps, defaultApp, nil
+}
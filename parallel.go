@@ -0,0 +1,52 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+)
+
+// limiter bounds the goroutines of parallel calls sharing it, nested ones
+// included, to a number of jobs. The goroutine creating it is one of them.
+type limiter chan struct{}
+
+// newLimiter returns a limiter of jobs goroutines, or runtime.NumCPU() when
+// jobs is not positive.
+func newLimiter(jobs int) limiter {
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+	limit := make(limiter, jobs)
+	limit <- struct{}{}
+	return limit
+}
+
+// parallel calls fn for every index below n, on a goroutine of its own while
+// limit has room and on the calling goroutine otherwise, so that nested
+// calls never exceed the limit nor wait on a slot their caller holds.
+// Callers write results into slots indexed by i so output does not depend
+// on scheduling; likewise the error returned is that of the lowest failing
+// index.
+func parallel(n int, limit limiter, fn func(i int) error) error {
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		select {
+		case limit <- struct{}{}:
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-limit }()
+				errs[i] = fn(i)
+			}()
+		default:
+			errs[i] = fn(i)
+		}
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
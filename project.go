@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Markers around the lines -project-root adds to a project's INSTALLED_APPS
+// and urlpatterns; later runs add to the marked block instead of starting a
+// new one.
+const (
+	wireBegin = "# proto2django: begin"
+	wireEnd   = "# proto2django: end"
+)
+
+var (
+	settingsModuleRe = regexp.MustCompile(`DJANGO_SETTINGS_MODULE['"]\s*,\s*['"]([\w.]+)['"]`)
+	rootURLConfRe    = regexp.MustCompile(`(?m)^ROOT_URLCONF\s*=\s*['"]([\w.]+)['"]`)
+	installedAppsRe  = regexp.MustCompile(`(?m)^INSTALLED_APPS\s*=\s*[\[(]`)
+	urlpatternsRe    = regexp.MustCompile(`(?m)^urlpatterns\s*=\s*\[`)
+	urlsImportRe     = regexp.MustCompile(`(?m)^from django\.urls import (\([^)]*\)|[^\n]*)`)
+	topImportRe      = regexp.MustCompile(`(?m)^(?:from|import) (?:[^\n(]*\([^)]*\)[^\n]*|[^\n]*)\n`)
+)
+
+// wireEntry is a line added to a project list, present when the list
+// already quotes key.
+type wireEntry struct {
+	line, key string
+}
+
+// installedApps returns the third-party INSTALLED_APPS the app rendered
+// from data needs, in the order they should be installed.
+func installedApps(data TemplateData) []string {
+	var apps []string
+	if data.APIs[APIDRF] {
+		apps = append(apps, "rest_framework")
+		if data.TokenAuthentication {
+			apps = append(apps, "rest_framework.authtoken")
+		}
+		if data.OpenAPI {
+			apps = append(apps, "drf_spectacular")
+		}
+	}
+	if data.APIs[APIGraphQL] {
+		apps = append(apps, "graphene_django")
+	}
+	if len(data.Consumers) > 0 {
+		apps = append(apps, "channels")
+	}
+	if len(data.Servicers) > 0 {
+		apps = append(apps, "django_socio_grpc")
+	}
+	for _, imp := range data.ModelImports {
+		switch {
+		case strings.Contains(imp, "django.contrib.postgres"):
+			apps = appendUnique(apps, "django.contrib.postgres")
+		case strings.Contains(imp, "django.contrib.gis"):
+			apps = appendUnique(apps, "django.contrib.gis")
+		case strings.Contains(imp, "djmoney"):
+			apps = appendUnique(apps, "djmoney")
+		}
+	}
+	if data.History {
+		apps = append(apps, "simple_history")
+	}
+	return apps
+}
+
+// appModule returns the dotted Python module of the app in dir, relative
+// to the project in root.
+func appModule(root, dir string) (string, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(absRoot, absDir)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("app directory %s is not inside the project root %s", dir, root)
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for _, part := range parts {
+		if !identifierRe.MatchString(part) {
+			return "", fmt.Errorf("app directory %s is not an importable module of %s", dir, root)
+		}
+	}
+	return strings.Join(parts, "."), nil
+}
+
+// modulePath returns the file of the dotted Python module in root.
+func modulePath(root, module string) string {
+	path := filepath.Join(root, filepath.FromSlash(strings.ReplaceAll(module, ".", "/")))
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return filepath.Join(path, "__init__.py")
+	}
+	return path + ".py"
+}
+
+// projectSettings returns the settings file of the project in root: the
+// DJANGO_SETTINGS_MODULE of its manage.py, or else its only */settings.py.
+func projectSettings(root string) (string, error) {
+	if manage, err := os.ReadFile(filepath.Join(root, "manage.py")); err == nil {
+		if m := settingsModuleRe.FindSubmatch(manage); m != nil {
+			return modulePath(root, string(m[1])), nil
+		}
+	}
+	matches, _ := filepath.Glob(filepath.Join(root, "*", "settings.py"))
+	if len(matches) != 1 {
+		return "", fmt.Errorf("cannot find the settings of the Django project in %s: no manage.py naming DJANGO_SETTINGS_MODULE and %d */settings.py files", root, len(matches))
+	}
+	return matches[0], nil
+}
+
+// WireProject adds the apps of ir, and the third-party apps they need, to
+// the INSTALLED_APPS of the Django project in root and includes their URLs
+// from its ROOT_URLCONF. Lines already present are left alone, so running
+// it again changes nothing; where a list cannot be found the lines to add
+// are logged instead.
+func WireProject(root string, ir IR) error {
+	settingsPath, err := projectSettings(root)
+	if err != nil {
+		return err
+	}
+	settings, err := os.ReadFile(settingsPath)
+	if err != nil {
+		return fmt.Errorf("failed to read project settings: %w", err)
+	}
+
+	var apps, urls []wireEntry
+	for _, plan := range ir.Apps {
+		module, err := appModule(root, plan.Dir)
+		if err != nil {
+			return err
+		}
+		for _, app := range plan.InstalledApps {
+			if !hasEntry(apps, app) {
+				apps = append(apps, wireEntry{line: "'" + app + "',", key: app})
+			}
+		}
+		apps = append(apps, wireEntry{line: "'" + module + "',", key: module})
+		urls = append(urls, wireEntry{
+			line: fmt.Sprintf("path('%s', include('%s.urls')),", plan.URLPrefix, module),
+			key:  module + ".urls",
+		})
+	}
+
+	if err := wireFile(settingsPath, settings, installedAppsRe, apps, "INSTALLED_APPS"); err != nil {
+		return err
+	}
+
+	m := rootURLConfRe.FindSubmatch(settings)
+	if m == nil {
+		slog.Warn("settings have no ROOT_URLCONF; include the app URLs by hand", "settings", settingsPath, "lines", entryLines(urls))
+		return nil
+	}
+	urlsPath := modulePath(root, string(m[1]))
+	src, err := os.ReadFile(urlsPath)
+	if err != nil {
+		return fmt.Errorf("failed to read project URLconf: %w", err)
+	}
+	return wireFile(urlsPath, withURLImports(src), urlpatternsRe, urls, "urlpatterns")
+}
+
+// hasEntry reports whether entries already has one for key.
+func hasEntry(entries []wireEntry, key string) bool {
+	for _, e := range entries {
+		if e.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// entryLines joins the lines of entries for a log message.
+func entryLines(entries []wireEntry) string {
+	lines := make([]string, len(entries))
+	for i, e := range entries {
+		lines[i] = e.line
+	}
+	return strings.Join(lines, " ")
+}
+
+// wireFile adds the entries missing from the list assigned at listRe in
+// src, the content of path, and writes it back when anything changed.
+func wireFile(path string, src []byte, listRe *regexp.Regexp, entries []wireEntry, list string) error {
+	out, ok := wireList(src, listRe, entries)
+	if !ok {
+		slog.Warn("cannot find "+list+"; add the lines by hand", "file", path, "lines", entryLines(entries))
+		return nil
+	}
+	if bytes.Equal(out, src) {
+		slog.Debug("project already wired", "file", path)
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, out, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to update %s: %w", path, err)
+	}
+	slog.Info("added app to "+list, "file", path)
+	return nil
+}
+
+// wireList returns src with the entries not yet quoted in the Python list
+// assigned at listRe added to its marked block, which is started before the
+// closing bracket when missing. It reports false when there is no such list.
+func wireList(src []byte, listRe *regexp.Regexp, entries []wireEntry) ([]byte, bool) {
+	loc := listRe.FindIndex(src)
+	if loc == nil {
+		return nil, false
+	}
+	end := pyBracketEnd(src, loc[1]-1)
+	if end < 0 {
+		return nil, false
+	}
+	body := string(src[loc[1]:end])
+
+	var missing []string
+	for _, e := range entries {
+		if !strings.Contains(body, "'"+e.key+"'") && !strings.Contains(body, `"`+e.key+`"`) {
+			missing = append(missing, e.line)
+		}
+	}
+	if len(missing) == 0 {
+		return src, true
+	}
+
+	indent := "    "
+	for _, line := range strings.Split(body, "\n") {
+		if trimmed := strings.TrimLeft(line, " \t"); trimmed != "" && trimmed != line {
+			indent = line[:len(line)-len(trimmed)]
+			break
+		}
+	}
+	var block strings.Builder
+	for _, line := range missing {
+		block.WriteString(indent + line + "\n")
+	}
+
+	var out bytes.Buffer
+	if i := strings.Index(body, wireEnd); i >= 0 {
+		at := loc[1] + strings.LastIndexByte(body[:i], '\n') + 1
+		out.Write(src[:at])
+		out.WriteString(block.String())
+		out.Write(src[at:])
+		return out.Bytes(), true
+	}
+
+	at := end
+	lineStart := bytes.LastIndexByte(src[:end], '\n') + 1
+	prefix := ""
+	if strings.TrimSpace(string(src[lineStart:end])) == "" {
+		at = lineStart
+	} else {
+		prefix = "\n"
+	}
+	// The last item needs a trailing comma before the block.
+	last := pyLastCode(src, loc[1], at)
+	if last > loc[1] && src[last-1] != ',' {
+		out.Write(src[:last])
+		out.WriteString(",")
+		out.Write(src[last:at])
+	} else {
+		out.Write(src[:at])
+	}
+	out.WriteString(prefix + indent + wireBegin + "\n" + block.String() + indent + wireEnd + "\n")
+	out.Write(src[at:])
+	return out.Bytes(), true
+}
+
+// pyBracketEnd returns the index of the bracket closing the one at open in
+// the Python source src, skipping strings and comments, or -1.
+func pyBracketEnd(src []byte, open int) int {
+	depth := 0
+	for i := open; i < len(src); i = pySkip(src, i) + 1 {
+		switch src[i] {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// pyLastCode returns the end of the last code in src[from:to], past its
+// trailing comments and whitespace.
+func pyLastCode(src []byte, from, to int) int {
+	last := from
+	for i := from; i < to; i = pySkip(src, i) + 1 {
+		switch src[i] {
+		case ' ', '\t', '\n', '#':
+		default:
+			last = pySkip(src, i) + 1
+		}
+	}
+	return last
+}
+
+// pySkip returns the index of the last byte of the string or comment
+// starting at i in the Python source src, or i when there is none.
+func pySkip(src []byte, i int) int {
+	switch src[i] {
+	case '#':
+		for i+1 < len(src) && src[i+1] != '\n' {
+			i++
+		}
+	case '"', '\'':
+		quote := src[i : i+1]
+		if triple := bytes.Repeat(quote, 3); bytes.HasPrefix(src[i:], triple) {
+			quote = triple
+		}
+		i += len(quote)
+		for i < len(src) && !bytes.HasPrefix(src[i:], quote) {
+			if src[i] == '\\' {
+				i++
+			}
+			i++
+		}
+		i = min(i+len(quote), len(src)) - 1
+	}
+	return i
+}
+
+// withURLImports returns the URLconf src importing include and path from
+// django.urls, adding an import after the last top-level one when needed.
+func withURLImports(src []byte) []byte {
+	imported := map[string]bool{}
+	for _, m := range urlsImportRe.FindAllSubmatch(src, -1) {
+		for _, name := range strings.FieldsFunc(string(m[1]), func(r rune) bool {
+			return r == ',' || r == '(' || r == ')' || r == ' ' || r == '\n' || r == '\t'
+		}) {
+			imported[name] = true
+		}
+	}
+	var names []string
+	for _, name := range []string{"include", "path"} {
+		if !imported[name] {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return src
+	}
+	line := "from django.urls import " + strings.Join(names, ", ") + "  # proto2django\n"
+	at := 0
+	if locs := topImportRe.FindAllIndex(src, -1); len(locs) > 0 {
+		at = locs[len(locs)-1][1]
+	}
+	return append(append(append([]byte{}, src[:at]...), line...), src[at:]...)
+}
@@ -0,0 +1,30 @@
+package main
+
+import "log/slog"
+
+// readOnlyActions drops the @actions of messages that do not use GET, which
+// a read-only ViewSet does not serve, and returns the request serializers
+// still validating the body of a remaining action.
+func readOnlyActions(messages []RenderedMessage, serializers []RenderedRequestSerializer) []RenderedRequestSerializer {
+	used := map[string]bool{}
+	for i := range messages {
+		msg := &messages[i]
+		var kept []RenderedAction
+		for _, action := range msg.Actions {
+			if action.HTTPMethod != "get" {
+				slog.Warn("read-only ViewSet omits action", "model", msg.Name, "action", action.Name, "method", action.HTTPMethod)
+				continue
+			}
+			kept = append(kept, action)
+			used[action.Serializer] = true
+		}
+		msg.Actions = kept
+	}
+	var kept []RenderedRequestSerializer
+	for _, s := range serializers {
+		if used[s.Name] {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// relationOption selects the relation a singular message field is stored
+// as: [(django.field).relation = ONE_TO_ONE] or FOREIGN_KEY.
+const relationOption = fieldOption + ".relation"
+
+// Relations of relationOption.
+const (
+	RelationForeignKey = "FOREIGN_KEY"
+	RelationOneToOne   = "ONE_TO_ONE"
+)
+
+// oneToOne reports whether the singular message field f is stored as a
+// OneToOneField: when its (django.field).relation option says so or, without
+// the option, when its name matches one of the patterns.
+func oneToOne(f ProtoField, patterns []string) (bool, error) {
+	if v, ok := f.Options[relationOption]; ok {
+		switch v = strings.TrimPrefix(v, "django.Relation."); v {
+		case RelationOneToOne:
+			return true, nil
+		case RelationForeignKey:
+			return false, nil
+		}
+		return false, fmt.Errorf("unknown relation %q (want %s or %s)", v, RelationForeignKey, RelationOneToOne)
+	}
+	for _, pattern := range patterns {
+		// Patterns are checked by checkPatterns before generation.
+		if ok, _ := path.Match(pattern, f.Name); ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// checkPatterns returns an error for the first malformed glob of patterns,
+// named by flag.
+func checkPatterns(flag string, patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid %s pattern %q: %w", flag, pattern, err)
+		}
+	}
+	return nil
+}
+
+// relatedNameOption overrides the related_name of a relation field, e.g.
+// [(django.field).related_name = "reports"]; "+" disables the reverse
+// accessor.
+const relatedNameOption = fieldOption + ".related_name"
+
+// relatedName returns the related_name of the relation field f, renamed
+// name, of model, declared as djangoType: its (django.field).related_name
+// option or else <model>_<field>_set, which cannot clash between two
+// relations to the same model. One-to-one reverse accessors name a single
+// row and drop the _set. An invalid option is reported along with the
+// default.
+func relatedName(model string, f ProtoField, name, djangoType string) (string, error) {
+	related := snakeCase(pascalCase(model)) + "_" + strings.Trim(name, "_")
+	if !strings.HasPrefix(djangoType, "models.OneToOneField(") {
+		related += "_set"
+	}
+	v, ok := f.Options[relatedNameOption]
+	switch {
+	case !ok:
+		return related, nil
+	case v != "+" && !identifierRe.MatchString(strings.TrimSuffix(v, "+")):
+		return related, fmt.Errorf("invalid related_name %q", v)
+	}
+	return v, nil
+}
+
+// isRelation reports whether djangoType declares a relation to another model.
+func isRelation(djangoType string) bool {
+	for _, class := range []string{"models.ForeignKey(", "models.OneToOneField(", "models.ManyToManyField("} {
+		if strings.HasPrefix(djangoType, class) {
+			return true
+		}
+	}
+	return false
+}
+
+// onDeleteOption overrides the on_delete policy of a singular relation,
+// e.g. [(django.field).on_delete = PROTECT].
+const onDeleteOption = fieldOption + ".on_delete"
+
+// on_delete policies of relations, named like Django's.
+const (
+	OnDeleteCascade    = "CASCADE"
+	OnDeleteProtect    = "PROTECT"
+	OnDeleteSetNull    = "SET_NULL"
+	OnDeleteSetDefault = "SET_DEFAULT"
+)
+
+// validOnDelete reports whether policy is one of the OnDelete policies.
+func validOnDelete(policy string) bool {
+	switch policy {
+	case OnDeleteCascade, OnDeleteProtect, OnDeleteSetNull, OnDeleteSetDefault:
+		return true
+	}
+	return false
+}
+
+// onDelete returns the on_delete policy of f: its (django.field).on_delete
+// option, or else fallback. An invalid option is reported along with
+// fallback.
+func onDelete(f ProtoField, fallback string) (string, error) {
+	v, ok := f.Options[onDeleteOption]
+	if !ok {
+		return fallback, nil
+	}
+	v = strings.ToUpper(strings.TrimPrefix(v, "django.OnDelete."))
+	if !validOnDelete(v) {
+		return fallback, fmt.Errorf("unknown on_delete policy %q", v)
+	}
+	return v, nil
+}
+
+// withOnDelete sets the on_delete of the ForeignKey or OneToOneField
+// djangoType to policy. SET_NULL needs a nullable column, which it makes
+// the field.
+func withOnDelete(djangoType, policy string) string {
+	djangoType = strings.Replace(djangoType, "on_delete=models.CASCADE", "on_delete=models."+policy, 1)
+	if policy == OnDeleteSetNull && !strings.Contains(djangoType, "null=True") {
+		djangoType = addKwarg(djangoType, "null=True, blank=True")
+	}
+	return djangoType
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultDjangoVersion is the Django release targeted when none is given.
+const DefaultDjangoVersion = "5.2"
+
+// dependencyPins lists, per supported Django release, the version ranges of
+// every package the generated code may import.
+var dependencyPins = map[string]map[string]string{
+	"4.2": {
+		"Django":                         ">=4.2,<5.0",
+		"djangorestframework":            ">=3.14,<3.17",
+		"djangorestframework-camel-case": ">=1.4,<2",
+		"drf-spectacular":                ">=0.26,<0.29",
+		"graphene-django":                ">=3.1,<3.3",
+		"django-ninja":                   ">=1.0,<1.5",
+		"django-money":                   ">=3.2,<4",
+		"psycopg[binary]":                ">=3.1,<4",
+		"grpcio":                         ">=1.60,<2",
+		"protobuf":                       ">=4.25,<7",
+		"googleapis-common-protos":       ">=1.62,<2",
+		"django-socio-grpc":              ">=0.22,<0.25",
+		"celery":                         ">=5.3,<6",
+		"channels":                       ">=4.0,<5",
+		"drf-nested-routers":             ">=0.94,<1",
+		"django-simple-history":          ">=3.4,<4",
+		"django-stubs":                   ">=4.2.7,<5",
+		"djangorestframework-stubs":      ">=3.14.5,<3.17",
+	},
+	"5.0": {
+		"Django":                         ">=5.0,<5.1",
+		"djangorestframework":            ">=3.15,<3.17",
+		"djangorestframework-camel-case": ">=1.4,<2",
+		"drf-spectacular":                ">=0.27,<0.29",
+		"graphene-django":                ">=3.2,<3.3",
+		"django-ninja":                   ">=1.1,<1.5",
+		"django-money":                   ">=3.4,<4",
+		"psycopg[binary]":                ">=3.1,<4",
+		"grpcio":                         ">=1.60,<2",
+		"protobuf":                       ">=4.25,<7",
+		"googleapis-common-protos":       ">=1.62,<2",
+		"django-socio-grpc":              ">=0.22,<0.25",
+		"celery":                         ">=5.3,<6",
+		"channels":                       ">=4.0,<5",
+		"drf-nested-routers":             ">=0.94,<1",
+		"django-simple-history":          ">=3.5,<4",
+		"django-stubs":                   ">=5.0,<5.1",
+		"djangorestframework-stubs":      ">=3.15,<3.17",
+	},
+	"5.1": {
+		"Django":                         ">=5.1,<5.2",
+		"djangorestframework":            ">=3.15.2,<3.17",
+		"djangorestframework-camel-case": ">=1.4,<2",
+		"drf-spectacular":                ">=0.27.2,<0.29",
+		"graphene-django":                ">=3.2.2,<3.3",
+		"django-ninja":                   ">=1.3,<1.5",
+		"django-money":                   ">=3.5,<4",
+		"psycopg[binary]":                ">=3.1.8,<4",
+		"grpcio":                         ">=1.62,<2",
+		"protobuf":                       ">=4.25,<7",
+		"googleapis-common-protos":       ">=1.62,<2",
+		"django-socio-grpc":              ">=0.23,<0.25",
+		"celery":                         ">=5.3,<6",
+		"channels":                       ">=4.0,<5",
+		"drf-nested-routers":             ">=0.94,<1",
+		"django-simple-history":          ">=3.7,<4",
+		"django-stubs":                   ">=5.1,<5.2",
+		"djangorestframework-stubs":      ">=3.15,<3.17",
+	},
+	"5.2": {
+		"Django":                         ">=5.2,<6.0",
+		"djangorestframework":            ">=3.16,<3.17",
+		"djangorestframework-camel-case": ">=1.4,<2",
+		"drf-spectacular":                ">=0.28,<0.29",
+		"graphene-django":                ">=3.2.3,<3.3",
+		"django-ninja":                   ">=1.4,<1.5",
+		"django-money":                   ">=3.5,<4",
+		"psycopg[binary]":                ">=3.1.8,<4",
+		"grpcio":                         ">=1.62,<2",
+		"protobuf":                       ">=4.25,<7",
+		"googleapis-common-protos":       ">=1.62,<2",
+		"django-socio-grpc":              ">=0.24,<0.25",
+		"celery":                         ">=5.3,<6",
+		"channels":                       ">=4.0,<5",
+		"drf-nested-routers":             ">=0.94,<1",
+		"django-simple-history":          ">=3.8,<4",
+		"django-stubs":                   ">=5.2,<5.3",
+		"djangorestframework-stubs":      ">=3.16,<3.17",
+	},
+}
+
+// resolveRequirements returns the pinned requirement specifiers for the
+// packages the generated app imports, sorted by package name.
+func resolveRequirements(data TemplateData, djangoVersion string) ([]string, error) {
+	pins, ok := dependencyPins[djangoVersion]
+	if !ok {
+		var supported []string
+		for v := range dependencyPins {
+			supported = append(supported, v)
+		}
+		sort.Strings(supported)
+		return nil, fmt.Errorf("unsupported Django version %q (supported: %s)", djangoVersion, strings.Join(supported, ", "))
+	}
+
+	packages := []string{"Django"}
+	if data.APIs[APIDRF] {
+		packages = append(packages, "djangorestframework")
+		if data.OpenAPI {
+			packages = append(packages, "drf-spectacular")
+		}
+		if len(data.NestedRouters) > 0 {
+			packages = append(packages, "drf-nested-routers")
+		}
+		if data.CamelCasePackage {
+			packages = append(packages, "djangorestframework-camel-case")
+		}
+	}
+	if data.APIs[APIGraphQL] {
+		packages = append(packages, "graphene-django")
+	}
+	if data.APIs[APINinja] {
+		packages = append(packages, "django-ninja")
+	}
+	switch {
+	case len(data.Clients) > 0 || len(data.Servicers) > 0:
+		packages = append(packages, "grpcio", "protobuf")
+	case len(data.Converters) > 0:
+		packages = append(packages, "protobuf")
+	}
+	for _, imp := range data.ConverterImports {
+		if strings.HasPrefix(imp, "from google.type ") {
+			packages = append(packages, "googleapis-common-protos")
+			break
+		}
+	}
+	if len(data.Servicers) > 0 {
+		packages = append(packages, "django-socio-grpc")
+	}
+	if len(data.Tasks) > 0 {
+		packages = append(packages, "celery")
+	}
+	if len(data.Consumers) > 0 {
+		packages = append(packages, "channels")
+	}
+	if data.History {
+		packages = append(packages, "django-simple-history")
+	}
+	if data.Typed {
+		packages = append(packages, "django-stubs")
+		if data.APIs[APIDRF] {
+			packages = append(packages, "djangorestframework-stubs")
+		}
+	}
+	postgres := false
+	for _, imp := range data.ModelImports {
+		switch {
+		case strings.Contains(imp, "django.contrib.postgres"), strings.Contains(imp, "django.contrib.gis"):
+			postgres = true
+		case strings.Contains(imp, "djmoney"):
+			packages = append(packages, "django-money")
+		}
+	}
+	if postgres {
+		packages = append(packages, "psycopg[binary]")
+	}
+
+	sort.Slice(packages, func(i, j int) bool { return strings.ToLower(packages[i]) < strings.ToLower(packages[j]) })
+	requirements := make([]string, len(packages))
+	for i, pkg := range packages {
+		requirements[i] = pkg + pins[pkg]
+	}
+	return requirements, nil
+}
+
+const requirementsTemplate = `{{ range .Requirements }}{{ . }}
+{{ end }}`
+
+const pyprojectTemplate = `[project]
+name = "{{ .AppName }}"
+version = "0.1.0"
+requires-python = ">=3.10"
+dependencies = [
+{{- range .Requirements }}
+    {{ Quote . }},
+{{- end }}
+]
+`
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+// resourceOption is the google.api message annotation naming a resource
+// type and its name pattern, e.g. projects/{project}/datasets/{dataset}.
+const resourceOption = "google.api.resource"
+
+// resourceSegment is a collection/{variable} pair of a resource pattern.
+type resourceSegment struct {
+	Collection string
+	Variable   string
+}
+
+// NestedRouter is a drf-nested-routers router for the children of a resource.
+type NestedRouter struct {
+	Name string
+	// Parent is the router the resource itself is registered on.
+	Parent string
+	Prefix string
+	// Lookup names the parent's URL kwarg, <Lookup>_pk.
+	Lookup string
+	// Children are the models registered on the router.
+	Children []RenderedMessage
+	depth    int
+	// versions are those of the resource the router nests beneath.
+	versions []string
+}
+
+// resourcePattern parses the first google.api.resource pattern of msg; ok is
+// false when msg has none or it is not made of collection/{variable} pairs.
+func resourcePattern(msg ProtoMessage) ([]resourceSegment, bool) {
+	pattern, _, _ := strings.Cut(msg.Options[resourceOption+".pattern"], ",")
+	parts := strings.Split(strings.Trim(pattern, "/"), "/")
+	if pattern == "" || len(parts)%2 != 0 {
+		return nil, false
+	}
+	var segments []resourceSegment
+	for i := 0; i < len(parts); i += 2 {
+		v := parts[i+1]
+		if !strings.HasPrefix(v, "{") || !strings.HasSuffix(v, "}") {
+			return nil, false
+		}
+		segments = append(segments, resourceSegment{Collection: parts[i], Variable: snakeCase(v[1 : len(v)-1])})
+	}
+	return segments, true
+}
+
+// resourcePrefix returns the router prefix of a resource, its collection.
+func resourcePrefix(segments []resourceSegment) string {
+	return strings.ReplaceAll(snakeCase(segments[len(segments)-1].Collection), "_", "-")
+}
+
+// applyResources derives ViewSet lookups and nested routes from the
+// google.api.resource patterns of file's messages. A resource is looked up by
+// the model field named after its pattern's last variable, when there is one,
+// and is registered beneath the resource whose pattern its own extends,
+// filtered by its ForeignKey to that parent and on through its ancestors.
+// Resources without a ForeignKey to their parent are not nested. It returns the nested routers,
+// parents first, since each can only be created once its parent resource is
+// registered.
+func applyResources(file *ProtoFile, messages []RenderedMessage) []NestedRouter {
+	patterns := map[string][]resourceSegment{}
+	for _, msg := range file.Messages {
+		if segments, ok := resourcePattern(msg); ok {
+			patterns[msg.Name] = segments
+		}
+	}
+	key := func(segments []resourceSegment) string {
+		var parts []string
+		for _, s := range segments {
+			parts = append(parts, s.Collection)
+		}
+		return strings.Join(parts, "/")
+	}
+	byPattern := map[string]int{}
+	for i, msg := range messages {
+		if segments, ok := patterns[msg.ProtoName]; ok {
+			byPattern[key(segments)] = i
+		}
+	}
+
+	routers := map[int]*NestedRouter{}
+	var routerFor func(i int) *NestedRouter
+	routerFor = func(i int) *NestedRouter {
+		if r, ok := routers[i]; ok {
+			return r
+		}
+		msg := &messages[i]
+		segments := patterns[msg.ProtoName]
+		r := &NestedRouter{
+			Name:     msg.SnakeName + "_router",
+			Parent:   msg.Router,
+			Prefix:   msg.RoutePrefix,
+			Lookup:   segments[len(segments)-1].Variable,
+			versions: msg.Versions,
+		}
+		if msg.NestedParent >= 0 {
+			r.depth = routerFor(msg.NestedParent).depth + 1
+		}
+		routers[i] = r
+		return r
+	}
+
+	for i := range messages {
+		msg := &messages[i]
+		msg.Router = "router"
+		msg.NestedParent = -1
+		segments, ok := patterns[msg.ProtoName]
+		if !ok {
+			continue
+		}
+		variable := segments[len(segments)-1].Variable
+		for _, f := range msg.Fields {
+			if !f.Repeated && (f.Name == variable || f.Name == variable+"_id") && isScalar(f.Type) {
+				msg.LookupField = f.Name
+				break
+			}
+		}
+		if len(segments) > 1 {
+			parent, ok := byPattern[key(segments[:len(segments)-1])]
+			if !ok {
+				slog.Warn("resource parent has no ViewSet, route not nested", "message", msg.Name, "parent", key(segments[:len(segments)-1]))
+				continue
+			}
+			for _, f := range msg.Fields {
+				if !f.Repeated && modelClass(f.Type) == messages[parent].Name && !strings.Contains(f.Type, ".") {
+					msg.ParentField = f.Name
+				}
+			}
+			if msg.ParentField == "" {
+				// Its ViewSet could not filter by the parent in the URL.
+				slog.Warn("resource has no ForeignKey to its parent, route not nested", "message", msg.Name, "parent", messages[parent].Name)
+				continue
+			}
+			msg.NestedParent = parent
+		}
+	}
+
+	// Registration routers depend on the parents' routers, so resolve them
+	// once every parent is known.
+	for i := range messages {
+		if p := messages[i].NestedParent; p >= 0 {
+			parent := routerFor(p)
+			messages[i].Router = parent.Name
+			messages[i].ParentKwarg = parent.Lookup + "_pk"
+			// Filter through the ForeignKeys up to every ancestor in the URL.
+			path := ""
+			for c := i; messages[c].NestedParent >= 0; c = messages[c].NestedParent {
+				a := messages[c].NestedParent
+				path += messages[c].ParentField
+				lookup := path
+				if messages[a].LookupField != "" {
+					lookup += "__" + messages[a].LookupField
+				}
+				messages[i].ParentFilters = append(messages[i].ParentFilters, lookup+"=self.kwargs['"+routerFor(a).Lookup+"_pk']")
+				path += "__"
+			}
+			slog.Debug("nested resource route", "model", messages[i].Name, "parent", messages[p].Name)
+		}
+	}
+	for i, r := range routers {
+		r.Parent = messages[i].Router
+	}
+	for i := range messages {
+		if p := messages[i].NestedParent; p >= 0 {
+			routers[p].Children = append(routers[p].Children, messages[i])
+		}
+	}
+
+	var nested []NestedRouter
+	for _, r := range routers {
+		nested = append(nested, *r)
+	}
+	sort.Slice(nested, func(i, j int) bool {
+		if nested[i].depth != nested[j].depth {
+			return nested[i].depth < nested[j].depth
+		}
+		return nested[i].Name < nested[j].Name
+	})
+	return nested
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// djangoProtoTypes maps Django field classes to the proto types they are
+// generated from, or store best.
+var djangoProtoTypes = map[string]string{
+	"CharField":                 "string",
+	"TextField":                 "string",
+	"SlugField":                 "string",
+	"EmailField":                "string",
+	"URLField":                  "string",
+	"UUIDField":                 "string",
+	"GenericIPAddressField":     "string",
+	"FileField":                 "string",
+	"ImageField":                "string",
+	"DecimalField":              "string",
+	"AutoField":                 "int32",
+	"SmallAutoField":            "int32",
+	"IntegerField":              "int32",
+	"SmallIntegerField":         "int32",
+	"PositiveSmallIntegerField": "uint32",
+	"PositiveIntegerField":      "uint32",
+	"BigAutoField":              "int64",
+	"BigIntegerField":           "int64",
+	"PositiveBigIntegerField":   "uint64",
+	"FloatField":                "double",
+	"BooleanField":              "bool",
+	"NullBooleanField":          "bool",
+	"BinaryField":               "bytes",
+	"DateTimeField":             "google.protobuf.Timestamp",
+	"DurationField":             "google.protobuf.Duration",
+	"DateField":                 dateType,
+	"TimeField":                 "google.type.TimeOfDay",
+	"PointField":                latLngType,
+	"MoneyField":                moneyType,
+}
+
+// wellKnownImports are the .proto files declaring the well-known types
+// reversed fields use.
+var wellKnownImports = map[string]string{
+	"google.protobuf.Timestamp": "google/protobuf/timestamp.proto",
+	"google.protobuf.Duration":  "google/protobuf/duration.proto",
+	"google.protobuf.Struct":    "google/protobuf/struct.proto",
+	"google.protobuf.ListValue": "google/protobuf/struct.proto",
+	dateType:                    "google/type/date.proto",
+	"google.type.TimeOfDay":     "google/type/timeofday.proto",
+	latLngType:                  "google/type/latlng.proto",
+	moneyType:                   "google/type/money.proto",
+}
+
+var (
+	relationTargetRe = regexp.MustCompile(`^\s*'([\w.]+)'`)
+	dbColumnRe       = regexp.MustCompile(`\bdb_column='(\w+)'`)
+)
+
+// reverseField returns the proto type of the model field declared as decl,
+// e.g. models.CharField(max_length=255), in the model named model; ok is
+// false when the field has no proto equivalent.
+func reverseField(model, decl string) (typ string, repeated, ok bool) {
+	class, args, _ := strings.Cut(decl, "(")
+	class = class[strings.LastIndexByte(class, '.')+1:]
+	args = strings.TrimSuffix(args, ")")
+	switch class {
+	case "ForeignKey", "OneToOneField", "ManyToManyField":
+		m := relationTargetRe.FindStringSubmatch(args)
+		if m == nil {
+			return "", false, false
+		}
+		target := m[1][strings.LastIndexByte(m[1], '.')+1:]
+		if target == "self" {
+			target = model
+		}
+		return target, class == "ManyToManyField", true
+	case "ArrayField":
+		typ, _, ok := reverseField(model, args)
+		return typ, true, ok
+	case "JSONField":
+		if strings.Contains(args, "default=list") {
+			return "google.protobuf.ListValue", false, true
+		}
+		return "google.protobuf.Struct", false, true
+	}
+	typ, ok = djangoProtoTypes[class]
+	return typ, false, ok
+}
+
+// Reverse writes a proto3 file declaring a message per model of the
+// models.py at path to w. Fields keep the numbers recorded in generated
+// models' PROTO_FIELD_NUMBERS and the names of their db_column; the rest are
+// numbered after them in declaration order.
+func Reverse(w io.Writer, path, pkg string) error {
+	models, err := pyModels(path)
+	if err != nil {
+		return err
+	}
+	var body strings.Builder
+	imports := map[string]bool{}
+	for _, model := range models {
+		if !strings.Contains(model.Bases, "Model") || strings.Contains(model.Bases, "Choices") {
+			continue
+		}
+		next := 1
+		for _, n := range model.Numbers {
+			next = max(next, n+1)
+		}
+		fmt.Fprintf(&body, "\nmessage %s {\n", model.Name)
+		for _, attr := range model.Order {
+			typ, repeated, ok := reverseField(model.Name, model.Fields[attr])
+			if !ok {
+				slog.Warn("model field has no proto type, skipped", "model", model.Name, "field", attr, "declaration", model.Fields[attr])
+				continue
+			}
+			if file, ok := wellKnownImports[typ]; ok {
+				imports[file] = true
+			}
+			name := attr
+			if m := dbColumnRe.FindStringSubmatch(model.Fields[attr]); m != nil {
+				name = m[1]
+			}
+			number, ok := model.Numbers[attr]
+			if !ok {
+				number = next
+				next++
+			}
+			label := ""
+			if repeated {
+				label = "repeated "
+			}
+			fmt.Fprintf(&body, "  %s%s %s = %d;\n", label, typ, name, number)
+		}
+		body.WriteString("}\n")
+	}
+
+	fmt.Fprintf(w, "syntax = \"proto3\";\n\npackage %s;\n", pkg)
+	if len(imports) > 0 {
+		files := make([]string, 0, len(imports))
+		for file := range imports {
+			files = append(files, file)
+		}
+		sort.Strings(files)
+		fmt.Fprintln(w)
+		for _, file := range files {
+			fmt.Fprintf(w, "import %q;\n", file)
+		}
+	}
+	_, err = io.WriteString(w, body.String())
+	return err
+}
+
+// reverseCommand sets up `proto2django reverse -models models.py`, which
+// writes a .proto for existing Django models.
+func reverseCommand(fs *flag.FlagSet) func() int {
+	var modelsPath, pkg, out string
+	var quiet bool
+	fs.StringVar(&modelsPath, "models", "", "Path to the models.py to read")
+	fs.StringVar(&pkg, "package", "", "Proto package of the messages (default: the models' app directory name)")
+	fs.StringVar(&out, "out", "-", "Path of the .proto to write, or - for stdout")
+	fs.BoolVar(&quiet, "quiet", false, "Only log errors")
+	return func() int {
+		logger, err := newLogger(os.Stderr, false, quiet, LogFormatText)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitUsage
+		}
+		slog.SetDefault(logger)
+		if modelsPath == "" {
+			slog.Error("Please provide a models.py with -models flag")
+			return ExitUsage
+		}
+		if pkg == "" {
+			abs, err := filepath.Abs(modelsPath)
+			if err != nil {
+				return reportError(os.Stderr, err, ErrorFormatText)
+			}
+			pkg = filepath.Base(filepath.Dir(abs))
+		}
+
+		w := os.Stdout
+		if out != "-" {
+			if w, err = os.Create(out); err != nil {
+				return reportError(os.Stderr, err, ErrorFormatText)
+			}
+			defer w.Close()
+		}
+		if err := Reverse(w, modelsPath, pkg); err != nil {
+			return reportError(os.Stderr, err, ErrorFormatText)
+		}
+		if out != "-" {
+			slog.Info("proto written", "path", out)
+		}
+		return 0
+	}
+}
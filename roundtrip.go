@@ -0,0 +1,137 @@
+package main
+
+import "sort"
+
+// RenderedRoundTrip is a tests.py case converting a model instance to its
+// protobuf message and back.
+type RenderedRoundTrip struct {
+	Model     string
+	SnakeName string
+	// Message is the protobuf class, e.g. sample_pb2.User.
+	Message string
+	Fields  []RoundTripValue
+}
+
+// RoundTripValue is a field of a round trip and the Python literal the test
+// instance sets it to.
+type RoundTripValue struct {
+	ProtoAttr
+	Value string
+}
+
+// sampleLiteral returns a Python value of a scalar proto type that differs
+// from the proto3 default, so that dropped fields do not compare equal.
+func sampleLiteral(typ, name string) string {
+	switch typ {
+	case "string":
+		return pyString(name)
+	case "bytes":
+		return `b'\x00\xff'`
+	case "bool":
+		return "True"
+	case "float":
+		return "1.5"
+	case "double":
+		return "2.25"
+	case "decimal":
+		return "decimal.Decimal('12.50')"
+	}
+	return "42"
+}
+
+// roundTrips renders a round trip per model of data generated from a proto
+// message in file, over its scalar and Timestamp fields, along with the
+// imports of the protoc-generated modules in pkg. Only the first member of
+// each oneof is set, since setting another would clear it.
+func roundTrips(file *ProtoFile, data TemplateData, pkg string) ([]RenderedRoundTrip, []string) {
+	modules := map[string]string{}
+	classes := map[string]string{}
+	for _, msg := range file.Messages {
+		modules[msg.Name] = pbModule(msg.Source) + "_pb2"
+		classes[msg.Name] = pbClass(msg)
+	}
+	enums := map[string]RenderedEnum{}
+	for _, e := range data.Enums {
+		enums[e.Name] = e
+	}
+
+	var trips []RenderedRoundTrip
+	var imports []string
+	for _, msg := range data.Messages {
+		module, ok := modules[msg.ProtoName]
+		if !ok {
+			continue
+		}
+		trip := RenderedRoundTrip{Model: msg.Name, SnakeName: msg.SnakeName, Message: module + "." + classes[msg.ProtoName]}
+		set := map[string]bool{}
+		for _, f := range msg.Fields {
+			if f.Synthetic || !isScalar(f.Type) || set[f.Oneof] {
+				continue
+			}
+			var value string
+			switch {
+			case f.Type == timestampType && !f.Repeated:
+				value = "timezone.now()"
+				imports = appendUnique(imports, "from django.utils import timezone")
+			case f.Type == dateType || f.Type == timestampType || f.Type == moneyType || f.Type == latLngType:
+				continue
+			case f.Enum != "":
+				value = enumSample(enums[f.Enum])
+			case isDecimalField(f):
+				value = sampleLiteral("decimal", f.ProtoName)
+				imports = appendUnique(imports, "import decimal")
+			default:
+				value = sampleLiteral(f.Type, f.ProtoName)
+			}
+			if f.Repeated {
+				value = "[" + value + ", " + value + "]"
+			}
+			if f.Oneof != "" {
+				set[f.Oneof] = true
+			}
+			trip.Fields = append(trip.Fields, RoundTripValue{ProtoAttr: ProtoAttr{ProtoName: f.ProtoName, Name: f.Name, Repeated: f.Repeated}, Value: value})
+		}
+		if len(trip.Fields) == 0 {
+			continue
+		}
+		trips = append(trips, trip)
+		imports = appendUnique(imports, pbModuleImport(pkg, module))
+	}
+	sort.Strings(imports)
+	return trips, imports
+}
+
+// pbModuleImport returns the import of a protoc-generated module, found in
+// pkg when it is set.
+func pbModuleImport(pkg, module string) string {
+	if pkg != "" {
+		return "from " + pkg + " import " + module
+	}
+	return "import " + module
+}
+
+const roundTripTemplate = `from django.test import SimpleTestCase
+{{ range .RoundTripImports }}
+{{ . }}
+{{- end }}
+
+from . import converters, models
+{{ range .RoundTrips }}
+
+class {{ .Model }}RoundTripTests(SimpleTestCase):
+    """Converts {{ .Model }} instances to {{ .Message }} messages and back."""
+
+    fields = [{{ range $i, $f := .Fields }}{{ if $i }}, {{ end }}'{{ $f.Name }}'{{ end }}]
+
+    def test_round_trip_is_lossless(self):
+        instance = models.{{ .Model }}(
+{{- range .Fields }}
+            {{ .Name }}={{ .Value }},
+{{- end }}
+        )
+        message = converters.{{ .SnakeName }}_to_proto(instance)
+        message = {{ .Message }}.FromString(message.SerializeToString())
+        restored = converters.{{ .SnakeName }}_from_proto(message)
+        for attr in self.fields:
+            self.assertEqual(getattr(restored, attr), getattr(instance, attr), attr)
+{{ end }}`
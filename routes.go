@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// httpOption is the google.api.http annotation mapping an RPC onto REST.
+const httpOption = "google.api.http"
+
+// httpMethods are the google.api.HttpRule patterns, in the order checked.
+var httpMethods = []string{"get", "post", "put", "patch", "delete"}
+
+// RenderedAction is a ViewSet @action generated for an RPC that is not one
+// of the standard CRUD methods, routed by its google.api.http annotation or
+// else posted to the detail URL.
+type RenderedAction struct {
+	// Name is the ViewSet method and actions.py handler name.
+	Name string
+	// HTTPMethod is the lowercase HTTP verb.
+	HTTPMethod string
+	// Detail is set when the route addresses a single object.
+	Detail bool
+	// URLPath is the route segment appended to the list or detail URL.
+	URLPath string
+	// Pattern is the original google.api.http path, kept for reference.
+	Pattern string
+	Comment string
+	// Nested is set on routes of nested resources, which also receive their
+	// parents' URL kwargs.
+	Nested bool
+	// RPC is the signature of an unannotated RPC, e.g. ArchiveOrder(Request),
+	// and Serializer the class validating the body from its request message.
+	RPC        string
+	Serializer string
+}
+
+// pathVariableRe matches a path template variable: {id} or {name=orders/*}.
+var pathVariableRe = regexp.MustCompile(`\{[^}]*\}`)
+
+// httpRule returns the verb and path template of an RPC's google.api.http
+// annotation; ok is false for unannotated RPCs and custom verbs.
+func httpRule(m ProtoMethod) (verb, pattern string, ok bool) {
+	for _, verb := range httpMethods {
+		if pattern, ok := m.Options[httpOption+"."+verb]; ok {
+			return verb, pattern, true
+		}
+	}
+	return "", "", false
+}
+
+// httpAction derives the @action for an annotated RPC on the ViewSet whose
+// router prefix is prefix. It is a detail route when the path template has a
+// variable, and its url_path is the custom verb (`:cancel`) or else the
+// literal segments after the last variable or the collection name.
+func httpAction(m ProtoMethod, verb, pattern, prefix string) RenderedAction {
+	action := RenderedAction{
+		Name:       snakeCase(m.Name),
+		HTTPMethod: verb,
+		Pattern:    pattern,
+		Comment:    m.Comment,
+	}
+	path := pattern
+	if i := strings.LastIndex(path, ":"); i > strings.LastIndex(path, "}") {
+		action.URLPath = path[i+1:]
+		path = path[:i]
+	}
+	segments := strings.Split(strings.Trim(pathVariableRe.ReplaceAllString(path, "{}"), "/"), "/")
+	rest := -1
+	for i, seg := range segments {
+		switch {
+		case seg == "{}":
+			action.Detail = true
+			rest = i + 1
+		case seg == prefix && !action.Detail:
+			rest = i + 1
+		}
+	}
+	if action.URLPath == "" && rest >= 0 {
+		action.URLPath = strings.Join(segments[rest:], "/")
+	}
+	if action.URLPath == "" {
+		action.URLPath = strings.ReplaceAll(action.Name, "_", "-")
+	}
+	return action
+}
+
+// pathModel returns the index of the model whose router prefix is the last
+// collection of an http path template, such as books for
+// /v1/{parent=publishers/*}/books, or -1 when no model's is.
+func pathModel(pattern string, messages []RenderedMessage) int {
+	path := pattern
+	if i := strings.LastIndex(path, ":"); i > strings.LastIndex(path, "}") {
+		path = path[:i]
+	}
+	// Variables bound to a resource path, {name=orders/*}, hold collections too.
+	path = pathVariableRe.ReplaceAllStringFunc(path, func(v string) string {
+		if _, sub, ok := strings.Cut(strings.Trim(v, "{}"), "="); ok {
+			return sub
+		}
+		return "*"
+	})
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i := len(segments) - 1; i >= 0; i-- {
+		prefix := strings.ReplaceAll(snakeCase(segments[i]), "_", "-")
+		for j, msg := range messages {
+			if msg.RoutePrefix == prefix {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+// assignActions attaches an @action to a model's ViewSet for every RPC with
+// a google.api.http annotation that ModelViewSet does not already serve,
+// whichever model it is a standard method of. The RPC belongs to the model
+// it returns or, failing that, the model of the last collection in its path.
+func assignActions(services []ProtoService, messages []RenderedMessage) {
+	for _, svc := range services {
+		for _, m := range svc.Methods {
+			verb, pattern, ok := httpRule(m)
+			if !ok {
+				continue
+			}
+			if isCRUD(m.Name, messages) {
+				continue
+			}
+			target := -1
+			for i, msg := range messages {
+				if msg.ProtoName != "" && msg.ProtoName == m.OutputType {
+					target = i
+					break
+				}
+			}
+			if target < 0 {
+				target = pathModel(pattern, messages)
+			}
+			if target < 0 {
+				slog.Warn("no model for annotated rpc, route not generated", "rpc", m.Name, "path", pattern)
+				continue
+			}
+			msg := &messages[target]
+			action := httpAction(m, verb, pattern, msg.RoutePrefix)
+			action.Nested = msg.ParentKwarg != ""
+			slog.Debug("rpc mapped to viewset action", "rpc", m.Name, "model", msg.Name, "method", verb, "detail", action.Detail, "url_path", action.URLPath)
+			msg.Actions = append(msg.Actions, action)
+		}
+	}
+}
+
+// actionsImports opens a freshly scaffolded actions.py.
+const actionsImports = `from rest_framework import status
+from rest_framework.response import Response
+`
+
+// actionHandlerTemplate renders the actions.py handler behind one @action.
+const actionHandlerTemplate = `
+
+def {{ .Name }}(viewset, request, pk=None{{ if .Serializer }}, data=None{{ end }}):
+{{- if .Comment }}
+    {{ Docstring .Comment }}
+{{- end }}
+{{- if .RPC }}
+    # rpc {{ .RPC }}{{ if .Serializer }}; data is the body validated by {{ .Serializer }}{{ end }}
+{{- else }}
+    # {{ ToUpper .HTTPMethod }} {{ .Pattern }}
+{{- end }}
+    return Response(status=status.HTTP_501_NOT_IMPLEMENTED)
+`
+
+var actionHandlerRe = regexp.MustCompile(`(?m)^def (\w+)\(`)
+
+// writeActions scaffolds actions.py with a handler per generated @action.
+// The ViewSets in viewsets.py delegate to these functions, which are kept
+// across regeneration like managers.py.
+func writeActions(path string, data TemplateData) error {
+	tmpl := template.Must(template.New("actions").Funcs(funcMap).Parse(actionHandlerTemplate))
+	var blocks []scaffoldBlock
+	for _, msg := range data.APIMessages {
+		for _, action := range msg.Actions {
+			var buf bytes.Buffer
+			if err := tmpl.Execute(&buf, action); err != nil {
+				return err
+			}
+			blocks = append(blocks, scaffoldBlock{Key: action.Name, Text: buf.String()})
+		}
+	}
+	if len(blocks) == 0 {
+		return nil
+	}
+	return appendScaffold(path, actionsImports, actionHandlerRe, blocks)
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+)
+
+// RenderedRequestSerializer is the plain DRF serializer validating the body
+// of an @action from the fields of its RPC's request message.
+type RenderedRequestSerializer struct {
+	Name    string
+	Message string
+	Fields  []RequestField
+}
+
+// RequestField is a declared field of a request serializer.
+type RequestField struct {
+	Name string
+	// SerializerType is the DRF field declaration.
+	SerializerType string
+}
+
+// viewSetMethods are the ModelViewSet attributes an RPC action must not
+// shadow.
+var viewSetMethods = map[string]bool{
+	"list": true, "create": true, "retrieve": true, "update": true,
+	"partial_update": true, "destroy": true, "get_queryset": true,
+	"get_object": true, "get_serializer": true, "get_serializer_class": true,
+	"perform_create": true, "perform_update": true, "perform_destroy": true,
+}
+
+// assignRPCActions attaches a detail POST @action to a model's ViewSet for
+// every unary RPC without a google.api.http annotation that ModelViewSet
+// does not already serve, such as ArchiveOrder. The RPC belongs to the model
+// it returns or, failing that, the model named in the RPC or its service.
+// It returns the request serializers built for request messages that are
+// not models themselves, whose ModelSerializer validates the body instead.
+func assignRPCActions(file *ProtoFile, messages []RenderedMessage, jsonCase string) []RenderedRequestSerializer {
+	protoMessages := map[string]ProtoMessage{}
+	for _, msg := range file.Messages {
+		protoMessages[msg.Name] = msg
+	}
+	models := map[string]string{}
+	for _, msg := range messages {
+		if msg.ProtoName != "" {
+			models[msg.ProtoName] = msg.Name
+		}
+	}
+
+	var serializers []RenderedRequestSerializer
+	built := map[string]bool{}
+	for _, svc := range file.Services {
+		for _, m := range svc.Methods {
+			if _, _, ok := httpRule(m); ok || m.ClientStreaming || m.ServerStreaming {
+				continue
+			}
+			if isCRUD(m.Name, messages) {
+				continue
+			}
+			target := rpcModel(svc, m, messages)
+			if target < 0 {
+				slog.Warn("no model for rpc, action not generated", "rpc", m.Name)
+				continue
+			}
+			msg := &messages[target]
+			action := RenderedAction{
+				Name:       snakeCase(m.Name),
+				HTTPMethod: "post",
+				Detail:     true,
+				Comment:    m.Comment,
+				RPC:        m.Name + "(" + m.InputType + ")",
+				Nested:     msg.ParentKwarg != "",
+			}
+			if viewSetMethods[action.Name] || hasAction(msg.Actions, action.Name) {
+				slog.Warn("rpc action name taken, action not generated", "rpc", m.Name, "model", msg.Name, "name", action.Name)
+				continue
+			}
+			action.URLPath = strings.Trim(strings.Replace(action.Name, msg.SnakeName, "", 1), "_")
+			if action.URLPath == "" {
+				action.URLPath = action.Name
+			}
+			action.URLPath = strings.ReplaceAll(strings.ReplaceAll(action.URLPath, "__", "_"), "_", "-")
+
+			switch request, ok := protoMessages[m.InputType]; {
+			case models[m.InputType] != "":
+				action.Serializer = models[m.InputType] + "Serializer"
+			case ok:
+				action.Serializer = pascalCase(request.Name) + "Serializer"
+				if !built[request.Name] {
+					built[request.Name] = true
+					serializers = append(serializers, requestSerializer(request, msg.SnakeName, models, jsonCase))
+				}
+			}
+			slog.Debug("rpc mapped to viewset action", "rpc", m.Name, "model", msg.Name, "url_path", action.URLPath, "serializer", action.Serializer)
+			msg.Actions = append(msg.Actions, action)
+		}
+	}
+	return serializers
+}
+
+// rpcModel returns the index in messages of the model the RPC m of svc acts
+// on: the model it returns, else the longest model name in the RPC's name,
+// else the model its service is named after; -1 when there is none.
+func rpcModel(svc ProtoService, m ProtoMethod, messages []RenderedMessage) int {
+	for i, msg := range messages {
+		if msg.ProtoName != "" && msg.ProtoName == m.OutputType {
+			return i
+		}
+	}
+	target := -1
+	for i, msg := range messages {
+		if msg.ProtoName != "" && strings.Contains(m.Name, msg.Name) && (target < 0 || len(msg.Name) > len(messages[target].Name)) {
+			target = i
+		}
+	}
+	if target >= 0 {
+		return target
+	}
+	for i, msg := range messages {
+		if msg.ProtoName != "" && strings.TrimSuffix(svc.Name, "Service") == msg.Name {
+			return i
+		}
+	}
+	return -1
+}
+
+// isCRUD reports whether the RPC called name is a CRUD RPC of any of the
+// models in messages, which ModelViewSet serves whatever it returns.
+func isCRUD(name string, messages []RenderedMessage) bool {
+	for _, msg := range messages {
+		if msg.ProtoName != "" && crudActions(name, msg.Name) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAction reports whether actions has one called name.
+func hasAction(actions []RenderedAction, name string) bool {
+	for _, a := range actions {
+		if a.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// requestSerializer builds the serializer of the request message msg of an
+// action on the model snakeName. The fields identifying the model, id and
+// <model>_id, come from the URL instead; fields named Python keywords cannot
+// be declared and are left out. Fields are named for the -json-case policy
+// jsonCase.
+func requestSerializer(msg ProtoMessage, snakeName string, models map[string]string, jsonCase string) RenderedRequestSerializer {
+	s := RenderedRequestSerializer{Name: pascalCase(msg.Name) + "Serializer", Message: msg.Name}
+	for _, f := range msg.Fields {
+		switch name := snakeCase(f.Name); {
+		case name == "id" || name == snakeName+"_id":
+			continue
+		case pythonKeywords[f.Name]:
+			slog.Debug("request field named after a keyword left out", "message", msg.Name, "field", f.Name)
+			continue
+		}
+		s.Fields = append(s.Fields, RequestField{Name: serializerName(f, jsonCase), SerializerType: requestFieldType(f, models)})
+	}
+	return s
+}
+
+// requestFieldType returns the DRF field declaration of the request message
+// field f. Fields referencing models take their primary keys; other
+// messages and enums are accepted as JSON. Only required fields must be
+// given.
+func requestFieldType(f ProtoField, models map[string]string) string {
+	var field string
+	switch f.Type {
+	case "int32", "int64", "sint32", "sint64", "sfixed32", "sfixed64":
+		field = "serializers.IntegerField("
+	case "uint32", "uint64", "fixed32", "fixed64":
+		field = "serializers.IntegerField(min_value=0, "
+	case "string", "bytes":
+		field = "serializers.CharField("
+	case "bool":
+		field = "serializers.BooleanField("
+	case "float", "double":
+		field = "serializers.FloatField("
+	case dateType:
+		field = "serializers.DateField("
+	case timestampType:
+		field = "serializers.DateTimeField("
+	case moneyType:
+		field = "serializers.DecimalField(max_digits=19, decimal_places=2, "
+	default:
+		if model, ok := models[f.Type]; ok {
+			field = "serializers.PrimaryKeyRelatedField(queryset=" + model + ".objects.all(), "
+			if f.Repeated {
+				field = "serializers.PrimaryKeyRelatedField(many=True, queryset=" + model + ".objects.all(), "
+				f.Repeated = false
+			}
+		} else {
+			field = "serializers.JSONField("
+		}
+	}
+	required := f.Label == LabelRequired || f.Options[validateOption+".required"] == "true"
+	if f.Repeated {
+		field = "serializers.ListField(child=" + strings.TrimSuffix(field, ", ") + "), "
+	}
+	if required {
+		return strings.TrimSuffix(field, ", ") + ")"
+	}
+	return field + "required=False)"
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// templateActionRe matches a Go template action left unexecuted in rendered
+// output, such as a {{ .Name }} in text that was never parsed as a template.
+var templateActionRe = regexp.MustCompile(`\{\{-?\s*(?:[.$]|end\b|if\b|else\b|range\b|with\b|template\b|define\b|block\b|/\*)`)
+
+// templateCheck is a writer checking rendered output line by line, as it
+// streams, for the marks of a broken template: <no value> where a field was
+// missing and unexecuted template actions and, in Python files, blocks
+// without a body and inconsistent indentation. Writes fail at the first
+// finding, stopping the render.
+type templateCheck struct {
+	name   string
+	python bool
+	line   int
+	// partial is the current line up to the last write.
+	partial []byte
+	err     error
+
+	// indents is the stack of block indentations, depth the bracket
+	// nesting and quote the open triple quote at the end of the last line.
+	indents []int
+	depth   int
+	quote   string
+	// opened is the line of a block opener whose body has not started.
+	opened int
+}
+
+// newTemplateCheck returns a templateCheck for the rendered file name.
+func newTemplateCheck(name string) *templateCheck {
+	return &templateCheck{name: name, python: strings.HasSuffix(name, ".py")}
+}
+
+func (c *templateCheck) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	for rest := p; len(rest) > 0; {
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			c.partial = append(c.partial, rest...)
+			break
+		}
+		c.partial = append(c.partial, rest[:i]...)
+		c.checkLine(string(c.partial))
+		c.partial = c.partial[:0]
+		if c.err != nil {
+			return 0, c.err
+		}
+		rest = rest[i+1:]
+	}
+	return len(p), nil
+}
+
+// Close checks the last line and that the output does not end in a block
+// without a body.
+func (c *templateCheck) Close() error {
+	if c.err == nil && len(c.partial) > 0 {
+		c.checkLine(string(c.partial))
+	}
+	if c.err == nil && c.opened > 0 {
+		c.fail(c.opened, "block has no body")
+	}
+	return c.err
+}
+
+func (c *templateCheck) fail(line int, format string, args ...any) {
+	c.err = fmt.Errorf("rendered %s is broken at line %d: %s; check the template", c.name, line, fmt.Sprintf(format, args...))
+}
+
+func (c *templateCheck) checkLine(text string) {
+	c.line++
+	switch {
+	case strings.Contains(text, "<no value>"):
+		c.fail(c.line, "<no value> left where the template referenced a missing field")
+		return
+	case templateActionRe.MatchString(text):
+		c.fail(c.line, "unexecuted template action %q", templateActionRe.FindString(text))
+		return
+	}
+	if !c.python {
+		return
+	}
+
+	trimmed := strings.TrimSpace(text)
+	if c.depth == 0 && c.quote == "" && trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+		indent := text[:len(text)-len(strings.TrimLeft(text, " \t"))]
+		if strings.Contains(indent, "\t") {
+			c.fail(c.line, "indented with tabs")
+			return
+		}
+		n, top := len(indent), 0
+		if len(c.indents) > 0 {
+			top = c.indents[len(c.indents)-1]
+		}
+		switch {
+		case c.opened > 0 && n <= top:
+			c.fail(c.opened, "block has no body")
+			return
+		case c.opened > 0:
+			c.indents = append(c.indents, n)
+			top = n
+		case n > top:
+			c.fail(c.line, "unexpected indent")
+			return
+		}
+		for n < top {
+			c.indents = c.indents[:len(c.indents)-1]
+			top = 0
+			if len(c.indents) > 0 {
+				top = c.indents[len(c.indents)-1]
+			}
+		}
+		if n != top {
+			c.fail(c.line, "dedent does not match any enclosing block")
+			return
+		}
+		c.opened = 0
+	}
+
+	last := byte(0)
+	for i := 0; i < len(text); i++ {
+		if c.quote != "" {
+			switch {
+			case strings.HasPrefix(text[i:], c.quote):
+				i += len(c.quote) - 1
+				c.quote = ""
+				last = '"'
+			case text[i] == '\\':
+				i++
+			}
+			continue
+		}
+		ch := text[i]
+		switch {
+		case ch == '#':
+			i = len(text)
+			continue
+		case strings.HasPrefix(text[i:], `"""`) || strings.HasPrefix(text[i:], `'''`):
+			c.quote = text[i : i+3]
+			i += 2
+		case ch == '"' || ch == '\'':
+			for i++; i < len(text) && text[i] != ch; i++ {
+				if text[i] == '\\' {
+					i++
+				}
+			}
+		case strings.IndexByte("([{", ch) >= 0:
+			c.depth++
+		case strings.IndexByte(")]}", ch) >= 0 && c.depth > 0:
+			c.depth--
+		}
+		if ch != ' ' && ch != '\t' {
+			last = ch
+		}
+	}
+	if c.depth == 0 && c.quote == "" && last == ':' {
+		c.opened = c.line
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"regexp"
+)
+
+// scaffoldBlock is one unit of a hand-maintained scaffold file, identified
+// by the key that later runs look for before appending it again.
+type scaffoldBlock struct {
+	Key  string
+	Text string
+}
+
+// appendScaffold writes a file that belongs to the app's maintainers once
+// created: it carries no generated header and existing code is never
+// rewritten. A new file gets imports followed by every block; an existing one
+// only gains the blocks whose key keyRe's first group does not find in it.
+func appendScaffold(path, imports string, keyRe *regexp.Regexp, blocks []scaffoldBlock) error {
+	content, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if content == nil {
+		content = []byte(imports)
+	}
+
+	existing := map[string]bool{}
+	for _, m := range keyRe.FindAllSubmatch(content, -1) {
+		existing[string(m[1])] = true
+	}
+	added := false
+	for _, block := range blocks {
+		if existing[block.Key] {
+			continue
+		}
+		content = append(content, block.Text...)
+		existing[block.Key] = true
+		added = true
+		slog.Debug("scaffolded", "path", path, "key", block.Key)
+	}
+	if !added {
+		return nil
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
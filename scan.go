@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// scanDecls reads a .proto source and calls fn with each top-level
+// declaration, a statement ending in `;` or a block ending in its closing
+// brace, preceded by the comments and blank lines before it, along with the
+// line and column it starts on. Braces and semicolons inside string
+// literals and comments are ignored. Unbalanced braces and unterminated
+// strings and comments are reported as Diagnostics in the source name.
+func scanDecls(r io.Reader, name string, fn func(decl string, line, column int)) error {
+	in := bufio.NewReader(r)
+	var (
+		decl                 strings.Builder
+		depth                int
+		line, column         = 1, 0
+		start, startColumn   = 1, 1
+		openLine, openColumn int
+		quoteLine, quoteCol  int
+		commentLine, comCol  int
+		quote, prev          byte
+		escaped              bool
+		lineComment          bool
+		blockComment         bool
+	)
+	emit := func() {
+		if strings.TrimSpace(decl.String()) != "" {
+			fn(decl.String(), start, startColumn)
+		}
+		decl.Reset()
+		start, startColumn = line, column+1
+	}
+	for {
+		c, err := in.ReadByte()
+		if err == io.EOF {
+			switch {
+			case quote != 0:
+				return errorAt(CodeUnclosedString, name, quoteLine, quoteCol, "string literal is not terminated")
+			case blockComment:
+				return errorAt(CodeUnclosedComment, name, commentLine, comCol, "block comment is not terminated")
+			case depth > 0:
+				return errorAt(CodeUnclosedBlock, name, openLine, openColumn, "block is not closed before the end of the file")
+			}
+			emit()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		decl.WriteByte(c)
+		column++
+		if c == '\n' {
+			line++
+			column = 0
+		}
+		switch {
+		case lineComment:
+			lineComment = c != '\n'
+		case blockComment:
+			if prev == '*' && c == '/' {
+				blockComment = false
+				c = 0
+			}
+		case quote != 0:
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == quote:
+				quote = 0
+			}
+		case prev == '/' && c == '/':
+			lineComment = true
+		case prev == '/' && c == '*':
+			blockComment = true
+			commentLine, comCol = line, column-1
+			c = 0
+		case c == '"' || c == '\'':
+			quote = c
+			quoteLine, quoteCol = line, column
+		case c == '{':
+			if depth == 0 {
+				openLine, openColumn = line, column
+			}
+			depth++
+		case c == '}':
+			if depth == 0 {
+				return errorAt(CodeUnexpectedBrace, name, line, column, "unexpected } outside of any block")
+			}
+			depth--
+			if depth == 0 {
+				emit()
+			}
+		case c == ';' && depth == 0:
+			emit()
+		}
+		prev = c
+	}
+}
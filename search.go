@@ -0,0 +1,46 @@
+package main
+
+// searchVectorField is the model attribute holding the full-text search
+// vector of models generated with -search.
+const searchVectorField = "search_vector"
+
+// searchFields returns the model names of the singular string fields of a
+// model, which -search indexes for full-text search.
+func searchFields(fields []RenderedField) []string {
+	var names []string
+	for _, f := range fields {
+		if f.Type == "string" && !f.Repeated && !f.Synthetic {
+			names = append(names, f.Name)
+		}
+	}
+	return names
+}
+
+const searchFilterTemplate = `
+
+class SearchVectorFilter(filters.BaseFilterBackend):
+    """Filters and ranks rows matching the ?search= query against their
+    search_vector, using web search syntax."""
+
+{{ if .Typed }}    def filter_queryset(self, request: Request, queryset: QuerySet[Any], view: APIView) -> QuerySet[Any]:
+{{ else }}    def filter_queryset(self, request, queryset, view):
+{{ end }}        terms = request.query_params.get('search')
+        if not terms:
+            return queryset
+        query = SearchQuery(terms, search_type='websearch')
+        return (
+            queryset.filter(search_vector=query)
+            .annotate(search_rank=SearchRank(F('search_vector'), query))
+            .order_by('-search_rank')
+        )
+
+    def get_schema_operation_parameters(self, view{{ if .Typed }}: APIView{{ end }}){{ if .Typed }} -> list[dict[str, Any]]{{ end }}:
+        return [
+            {
+                'name': 'search',
+                'required': False,
+                'in': 'query',
+                'description': 'Full-text search terms',
+                'schema': {'type': 'string'},
+            }
+        ]`
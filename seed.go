@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// RenderedSeed is the seed_<app> management command creating sample rows
+// of every model of an app.
+type RenderedSeed struct {
+	App    string
+	Models []SeedModel
+	// ManyToMany are the many-to-many fields set once every row exists.
+	ManyToMany []SeedRelation
+	// Std and Imports are the standard library and Django modules the values
+	// need, and Text and Related are set when they call the command's text
+	// and related helpers.
+	Std     []string
+	Imports []string
+	Text    bool
+	Related bool
+}
+
+// SeedModel is a model the seed command creates rows of, after those of
+// the models it references.
+type SeedModel struct {
+	Model  string
+	Rows   string
+	Fields []SeedValue
+}
+
+// SeedValue is the Python expression a field of the n-th row created, the
+// i-th of its model, is set to.
+type SeedValue struct {
+	Name  string
+	Value string
+}
+
+// SeedRelation is a many-to-many field whose n-th row is linked to the n-th
+// row of the model it references.
+type SeedRelation struct {
+	Rows   string
+	Field  string
+	Target string
+	model  string
+}
+
+var (
+	// djangoFieldRe matches the class of a field declaration.
+	djangoFieldRe = regexp.MustCompile(`^(?:[\w.]+\.)?(\w+)\(`)
+	// seedTargetRe matches the model a relation references, quoted or
+	// a settings reference.
+	seedTargetRe = regexp.MustCompile(`^models\.(?:ForeignKey|OneToOneField|ManyToManyField)\((?:'([\w.]+)'|(settings\.\w+))`)
+	maxLengthRe  = regexp.MustCompile(`\bmax_length=(\d+)`)
+)
+
+// seedValue returns the sample value of a non-relation field of class cls.
+// Text is unique per row, so that unique columns can be seeded too.
+func seedValue(cls string, f RenderedField, seed *RenderedSeed) (string, bool) {
+	switch cls {
+	case "CharField", "TextField", "SlugField":
+		seed.Text = true
+		if m := maxLengthRe.FindStringSubmatch(f.DjangoType); m != nil {
+			return fmt.Sprintf("text('%s', i, %s)", f.Name, m[1]), true
+		}
+		return fmt.Sprintf("text('%s', i)", f.Name), true
+	case "EmailField":
+		return "f'user{i}@example.com'", true
+	case "URLField":
+		return "f'https://example.com/{i}'", true
+	case "GenericIPAddressField":
+		return "'127.0.0.1'", true
+	case "UUIDField":
+		seed.Std = appendUnique(seed.Std, "import uuid")
+		return "uuid.uuid4()", true
+	case "IntegerField", "BigIntegerField", "SmallIntegerField", "PositiveIntegerField", "PositiveBigIntegerField", "PositiveSmallIntegerField":
+		return "i", true
+	case "FloatField":
+		return "i + 0.5", true
+	case "DecimalField", "MoneyField":
+		seed.Std = appendUnique(seed.Std, "import decimal")
+		return "decimal.Decimal(i)", true
+	case "BooleanField":
+		return "i % 2 == 0", true
+	case "BinaryField":
+		return "bytes([i % 256])", true
+	case "DateTimeField":
+		seed.Imports = appendUnique(seed.Imports, "from django.utils import timezone")
+		return "timezone.now()", true
+	case "DateField":
+		seed.Imports = appendUnique(seed.Imports, "from django.utils import timezone")
+		return "timezone.now().date()", true
+	case "TimeField":
+		seed.Imports = appendUnique(seed.Imports, "from django.utils import timezone")
+		return "timezone.now().time()", true
+	case "DurationField":
+		seed.Std = appendUnique(seed.Std, "import datetime")
+		return "datetime.timedelta(seconds=i)", true
+	case "JSONField":
+		return "{}", true
+	case "ArrayField":
+		return "[]", true
+	}
+	return "", false
+}
+
+// seedCommand renders the seed command of the models of data. Models are
+// created in dependency order, those they reference by a non-null
+// ForeignKey or OneToOneField first, and nullable references are set when
+// their model precedes. Models that cannot be created, because a required
+// reference is circular or to a model that is not generated, or a required
+// field has no sample value, are left out with a warning.
+func seedCommand(data TemplateData) *RenderedSeed {
+	seed := &RenderedSeed{App: data.AppName, Imports: []string{"from django.core.management.base import BaseCommand", "from django.db import transaction"}}
+	enums := map[string]RenderedEnum{}
+	for _, e := range data.Enums {
+		enums[e.Name] = e
+	}
+	index := map[string]int{}
+	for i, msg := range data.Messages {
+		index[msg.Name] = i
+	}
+	rows := func(msg RenderedMessage) string { return msg.SnakeName + "_rows" }
+
+	// requires lists, per model, the models it cannot be created before.
+	requires := make([][]string, len(data.Messages))
+	unseedable := make([]string, len(data.Messages))
+	for i, msg := range data.Messages {
+		for _, f := range msg.Fields {
+			m := seedTargetRe.FindStringSubmatch(f.DjangoType)
+			if m == nil || m[1] == "" || strings.Contains(f.DjangoType, "ManyToManyField") || strings.Contains(f.DjangoType, "null=True") {
+				continue
+			}
+			target := m[1]
+			switch _, ok := index[target]; {
+			case target == "self":
+				unseedable[i] = f.Name + " references its own model"
+			case ok:
+				requires[i] = append(requires[i], target)
+			case !strings.Contains(target, "."):
+				unseedable[i] = f.Name + " references " + target + ", which is not generated"
+			}
+		}
+	}
+
+	created := map[string]bool{}
+	for progress := true; progress; {
+		progress = false
+	models:
+		for i, msg := range data.Messages {
+			if created[msg.Name] || unseedable[i] != "" {
+				continue
+			}
+			for _, target := range requires[i] {
+				if !created[target] {
+					continue models
+				}
+			}
+			model := SeedModel{Model: msg.Name, Rows: rows(msg)}
+			var m2m []SeedRelation
+			for _, f := range msg.Fields {
+				if f.Default != "" || strings.Contains(f.DjangoType, "default=") || strings.Contains(f.DjangoType, "auto_now") {
+					continue
+				}
+				var value string
+				if m := seedTargetRe.FindStringSubmatch(f.DjangoType); m != nil {
+					target := m[1]
+					if target == "self" {
+						target = msg.Name
+					}
+					j, local := index[target]
+					switch {
+					case strings.Contains(f.DjangoType, "ManyToManyField"):
+						if local {
+							m2m = append(m2m, SeedRelation{Rows: model.Rows, Field: f.Name, Target: rows(data.Messages[j]), model: target})
+						}
+						continue
+					case m[2] != "":
+						seed.Related = true
+						seed.Imports = appendUnique(seed.Imports, "from django.conf import settings")
+						value = "related(" + m[2] + ")"
+					case local && created[target]:
+						value = rows(data.Messages[j]) + "[n]"
+					case local:
+						continue
+					case strings.Contains(target, "."):
+						seed.Related = true
+						value = "related('" + target + "')"
+					default:
+						continue
+					}
+					model.Fields = append(model.Fields, SeedValue{Name: f.Name, Value: value})
+					continue
+				}
+				if e, ok := enums[f.Enum]; ok {
+					model.Fields = append(model.Fields, SeedValue{Name: f.Name, Value: enumSample(e)})
+					continue
+				}
+				cls := ""
+				if m := djangoFieldRe.FindStringSubmatch(f.DjangoType); m != nil {
+					cls = m[1]
+				}
+				value, ok := seedValue(cls, f, seed)
+				switch {
+				case ok:
+					model.Fields = append(model.Fields, SeedValue{Name: f.Name, Value: value})
+				case !strings.Contains(f.DjangoType, "null=True"):
+					unseedable[i] = f.Name + " is a " + cls + " without a sample value"
+					continue models
+				}
+			}
+			seed.Models = append(seed.Models, model)
+			seed.ManyToMany = append(seed.ManyToMany, m2m...)
+			created[msg.Name] = true
+			progress = true
+		}
+	}
+	for i, msg := range data.Messages {
+		switch {
+		case created[msg.Name]:
+		case unseedable[i] != "":
+			slog.Warn("model left out of the seed command", "model", msg.Name, "reason", unseedable[i])
+		default:
+			slog.Warn("model left out of the seed command", "model", msg.Name, "reason", "its required references are circular", "requires", strings.Join(requires[i], ", "))
+		}
+	}
+	var m2m []SeedRelation
+	for _, r := range seed.ManyToMany {
+		if created[r.model] {
+			m2m = append(m2m, r)
+		}
+	}
+	seed.ManyToMany = m2m
+	if seed.Related {
+		seed.Imports = appendUnique(seed.Imports, "from django.apps import apps")
+	}
+	sort.Strings(seed.Std)
+	sort.Strings(seed.Imports)
+	return seed
+}
+
+// seedCommandPath returns the path of the seed command within the app.
+func seedCommandPath(seed *RenderedSeed) string {
+	return filepath.Join("management", "commands", "seed_"+seed.App+".py")
+}
+
+// writeSeedCommand writes the seed command of data, if any.
+func writeSeedCommand(outputDir string, data TemplateData) error {
+	if data.Seed == nil {
+		return nil
+	}
+	if err := writeManagementPackage(outputDir, data); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := template.Must(template.New("seed").Funcs(funcMap).Parse(seedCommandTemplate)).Execute(&buf, data.Seed); err != nil {
+		return err
+	}
+	if err := writeGenerated(filepath.Join(outputDir, seedCommandPath(data.Seed)), buf.Bytes(), data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", seedCommandPath(data.Seed), err)
+	}
+	return nil
+}
+
+const seedCommandTemplate = `{{ range .Std }}{{ . }}
+{{ end }}{{ if .Std }}
+{{ end }}{{ range .Imports }}{{ . }}
+{{ end }}
+{{ range .Models }}from ...models import {{ .Model }}
+{{ end }}
+{{- if .Text }}
+
+def text(prefix, i, max_length=None):
+    """Sample text unique per row, cut from the left to max_length to stay so."""
+    value = f'{prefix}-{i}'
+    return value[-max_length:] if max_length else value
+{{- end }}
+{{- if .Related }}
+
+def related(label):
+    """The first row of a model of another app, which must be seeded first."""
+    return apps.get_model(label).objects.first()
+{{- end }}
+
+
+class Command(BaseCommand):
+    help = 'Creates sample rows of every {{ .App }} model for demos and local development.'
+
+    def add_arguments(self, parser):
+        parser.add_argument('--count', type=int, default=3, help='Rows created per model, added to existing ones.')
+
+    @transaction.atomic
+    def handle(self, *args, **options):
+        count = options['count']
+{{- range .Models }}
+
+        {{ .Rows }} = []
+        start = {{ .Model }}.objects.count()
+        for n in range(count):
+            i = start + n + 1
+            {{ .Rows }}.append({{ .Model }}.objects.create({{ if .Fields }}
+{{- range .Fields }}
+                {{ .Name }}={{ .Value }},
+{{- end }}
+            {{ end }}))
+{{- end }}
+{{- range .ManyToMany }}
+
+        for n, row in enumerate({{ .Rows }}):
+            row.{{ .Field }}.set([{{ .Target }}[n]])
+{{- end }}
+
+        self.stdout.write(self.style.SUCCESS(f'Seeded {count} rows of {{ len .Models }} models'))
+`
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"text/template"
+)
+
+// signalsImports opens a freshly scaffolded signals.py.
+const signalsImports = `from django.db.models.signals import post_save, pre_save
+from django.dispatch import receiver
+
+from . import models
+`
+
+// signalReceiversTemplate renders the receiver stubs for one model.
+const signalReceiversTemplate = `
+
+@receiver(pre_save, sender=models.{{ .Name }})
+def {{ .SnakeName }}_pre_save(sender, instance, **kwargs):
+    pass
+
+
+@receiver(post_save, sender=models.{{ .Name }})
+def {{ .SnakeName }}_post_save(sender, instance, created, **kwargs):
+    pass
+`
+
+var receiverSenderRe = regexp.MustCompile(`(?m)^@receiver\(\w+, sender=models\.(\w+)\)`)
+
+// writeSignals scaffolds signals.py with pre_save/post_save receivers per
+// model. Like managers.py it is left to the app's maintainers once written;
+// later runs only append stubs for models that have no receiver yet.
+func writeSignals(path string, data TemplateData) error {
+	tmpl := template.Must(template.New("signals").Parse(signalReceiversTemplate))
+	var blocks []scaffoldBlock
+	for _, msg := range data.Messages {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, msg); err != nil {
+			return err
+		}
+		blocks = append(blocks, scaffoldBlock{Key: msg.Name, Text: buf.String()})
+	}
+	return appendScaffold(path, signalsImports, receiverSenderRe, blocks)
+}
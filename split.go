@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// splitFiles maps the modules -split-files turns into packages to the
+// suffix of the class each message defines in them.
+var splitFiles = map[string]string{
+	"models.py":      "",
+	"serializers.py": "Serializer",
+	"viewsets.py":    "ViewSet",
+}
+
+// commonModule is the module of a split package holding the definitions
+// that belong to no single message, such as enums and base classes.
+const commonModule = "_common"
+
+// messageModule returns the module of a split package holding the classes
+// of the message name.
+func messageModule(name string) string {
+	module := snakeCase(name)
+	if pythonKeywords[module] || module == commonModule {
+		module += "_"
+	}
+	return module
+}
+
+// pyImportRe matches a plain import statement.
+var pyImportRe = regexp.MustCompile(`^import\s+([\w.]+)(?:\s+as\s+(\w+))?\s*$`)
+
+// pyModule is a module of a split package being assembled.
+type pyModule struct {
+	name   string
+	chunks []string
+	// defines lists the names the module's top-level statements bind.
+	defines []string
+}
+
+// writePackage renders the template content of the module name with data
+// and writes it to outputDir as a package instead: a module per message of
+// data with the classes the message defines in it, the other definitions in
+// _common and an __init__ re-exporting all of them, so that imports from the
+// module keep working. Each module keeps the imports it uses, one level
+// further up for relative ones. It returns the paths written, relative to
+// outputDir.
+func writePackage(content string, data TemplateData, outputDir, name string, merge bool) ([]string, error) {
+	tmpl, err := template.New("template").Funcs(funcMap).Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return nil, err
+	}
+
+	owners := map[string]string{}
+	for _, msg := range data.Messages {
+		owners[msg.Name+splitFiles[name]] = messageModule(msg.Name)
+	}
+	var imports []string
+	modules := map[string]*pyModule{}
+	var order []string
+	for _, c := range pyChunks(rendered.Bytes()) {
+		stmt := pyStatement(c.text)
+		switch {
+		case c.key == "":
+			continue
+		case pyFromRe.MatchString(stmt) || pyImportRe.MatchString(stmt):
+			imports = append(imports, stmt)
+			continue
+		}
+		module := commonModule
+		defined := strings.TrimPrefix(strings.TrimPrefix(c.key, "def "), "= ")
+		if owner, ok := owners[defined]; ok && strings.HasPrefix(c.key, "def ") {
+			module = owner
+		}
+		m, ok := modules[module]
+		if !ok {
+			m = &pyModule{name: module}
+			modules[module] = m
+			order = append(order, module)
+		}
+		m.chunks = append(m.chunks, strings.Trim(c.text, "\n"))
+		if defined != c.key {
+			m.defines = append(m.defines, defined)
+		}
+	}
+	definedIn := map[string]string{}
+	for _, m := range modules {
+		for _, d := range m.defines {
+			definedIn[d] = m.name
+		}
+	}
+
+	dir := filepath.Join(outputDir, strings.TrimSuffix(name, ".py"))
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, name)); err == nil {
+		slog.Warn("module is shadowed by the package split from it; remove it", "path", filepath.Join(outputDir, name), "package", dir)
+	}
+	var written []string
+	write := func(module string, body []byte) error {
+		path := filepath.Join(dir, module+".py")
+		existing, err := os.ReadFile(path)
+		switch {
+		case merge && err == nil:
+			err = mergeGenerated(existing, body, data, path)
+		case err == nil || errors.Is(err, fs.ErrNotExist):
+			err = writeGenerated(path, body, data)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		rel, _ := filepath.Rel(outputDir, path)
+		written = append(written, rel)
+		return nil
+	}
+
+	var init bytes.Buffer
+	for _, imp := range imports {
+		if strings.HasPrefix(imp, "from __future__ ") {
+			init.WriteString(imp + "\n")
+		}
+	}
+	for _, module := range order {
+		m := modules[module]
+		body := strings.Join(m.chunks, "\n\n") + "\n"
+		var head []string
+		for _, imp := range imports {
+			if imp = usedImport(imp, body); imp != "" {
+				head = append(head, relativeImport(imp))
+			}
+		}
+		local := map[string][]string{}
+		// Names in strings and comments, such as the lazy 'User' of a
+		// ForeignKey, need no import, and importing them could be circular.
+		code := pyLiteralRe.ReplaceAllString(body, "")
+		for _, word := range pyWordRe.FindAllString(code, -1) {
+			if from, ok := definedIn[word]; ok && from != module && !slices.Contains(local[from], word) {
+				local[from] = append(local[from], word)
+			}
+		}
+		froms := make([]string, 0, len(local))
+		for from := range local {
+			froms = append(froms, from)
+		}
+		sort.Strings(froms)
+		for _, from := range froms {
+			head = append(head, "from ."+from+" import "+strings.Join(local[from], ", "))
+		}
+		if len(head) > 0 {
+			body = strings.Join(head, "\n") + "\n\n" + body
+		}
+		if err := write(module, []byte(body)); err != nil {
+			return nil, err
+		}
+		if len(m.defines) > 0 {
+			init.WriteString("from ." + module + " import " + strings.Join(m.defines, ", ") + "\n")
+		}
+	}
+	if err := write("__init__", init.Bytes()); err != nil {
+		return nil, err
+	}
+	slog.Debug("module split into package", "module", name, "modules", len(order))
+	return written, nil
+}
+
+var (
+	// pyWordRe matches a Python name.
+	pyWordRe = regexp.MustCompile(`\b[A-Za-z_]\w*\b`)
+	// pyLiteralRe matches a string literal or comment.
+	pyLiteralRe = regexp.MustCompile(`(?s)"""(?:[^\\]|\\.)*?"""|` + "'''" + `(?:[^\\]|\\.)*?` + "'''" + `|"(?:[^"\\\n]|\\.)*"|'(?:[^'\\\n]|\\.)*'|#[^\n]*`)
+)
+
+// usedImport returns the import statement imp reduced to the names body
+// uses, or "" when it uses none. Future imports are always kept.
+func usedImport(imp, body string) string {
+	uses := func(name string) bool {
+		return regexp.MustCompile(`\b` + regexp.QuoteMeta(name) + `\b`).MatchString(body)
+	}
+	if m := pyImportRe.FindStringSubmatch(imp); m != nil {
+		name := m[2]
+		if name == "" {
+			name, _, _ = strings.Cut(m[1], ".")
+		}
+		if uses(name) {
+			return imp
+		}
+		return ""
+	}
+	m := pyFromRe.FindStringSubmatch(imp)
+	if m[1] == "__future__" {
+		return imp
+	}
+	var names []string
+	for _, name := range importNames(m[2]) {
+		bound := name
+		if _, alias, ok := strings.Cut(name, " as "); ok {
+			bound = alias
+		}
+		if uses(bound) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	return "from " + m[1] + " import " + strings.Join(names, ", ")
+}
+
+// relativeImport returns the relative import imp as seen from one package
+// level further down.
+func relativeImport(imp string) string {
+	if strings.HasPrefix(imp, "from .") {
+		return "from .." + strings.TrimPrefix(imp, "from .")
+	}
+	return imp
+}
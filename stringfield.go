@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// stringTypeOption selects the model field of a string field, e.g.
+// [(django.field).string_type = TEXT].
+const stringTypeOption = fieldOption + ".string_type"
+
+// String field types of stringTypeOption.
+const (
+	StringChar  = "CHAR"
+	StringText  = "TEXT"
+	StringEmail = "EMAIL"
+	StringURL   = "URL"
+	StringSlug  = "SLUG"
+)
+
+// DefaultStringMaxLength is the max_length of CharFields without a
+// string.max_len rule when -string-max-length is not given.
+const DefaultStringMaxLength = 255
+
+// stringField returns the model field of the string field f whose
+// string.max_len rule is maxLength, if any, along with the max_length it
+// declares, zero for none. The field is the one its (django.field).string_type
+// option names or, under -string-heuristics, the one its name suggests, and
+// else a CharField, which becomes a TextField when maxLength is above
+// -text-threshold. An invalid option is reported along with the CharField.
+func stringField(f ProtoField, maxLength int, opts Options) (string, int, error) {
+	kind, err := stringType(f, opts)
+	if kind == StringChar && opts.TextThreshold > 0 && maxLength > opts.TextThreshold {
+		kind = StringText
+	}
+	class := map[string]string{
+		StringChar:  "CharField",
+		StringText:  "TextField",
+		StringEmail: "EmailField",
+		StringURL:   "URLField",
+		StringSlug:  "SlugField",
+	}[kind]
+	if kind == StringChar && maxLength == 0 {
+		maxLength = opts.StringMaxLength
+	}
+	if maxLength == 0 {
+		// Django's own max_length applies.
+		return "models." + class + "()", 0, err
+	}
+	return "models." + class + "(max_length=" + strconv.Itoa(maxLength) + ")", maxLength, err
+}
+
+// stringType returns the string field type of f: its string_type option,
+// else under -string-heuristics the one its name suggests, else CHAR.
+func stringType(f ProtoField, opts Options) (string, error) {
+	if v, ok := f.Options[stringTypeOption]; ok {
+		switch v = strings.ToUpper(strings.TrimPrefix(v, "django.StringType.")); v {
+		case StringChar, StringText, StringEmail, StringURL, StringSlug:
+			return v, nil
+		}
+		return StringChar, fmt.Errorf("unknown string_type %q", v)
+	}
+	if !opts.StringHeuristics {
+		return StringChar, nil
+	}
+	switch name := snakeCase(f.Name); {
+	case name == "email" || name == "email_address" || strings.HasSuffix(name, "_email"):
+		return StringEmail, nil
+	case name == "url" || name == "website" || name == "homepage" || strings.HasSuffix(name, "_url"):
+		return StringURL, nil
+	case name == "slug" || strings.HasSuffix(name, "_slug"):
+		return StringSlug, nil
+	}
+	return StringChar, nil
+}
+
+// stringSerializerClass returns the DRF serializer field class matching the
+// string model field djangoType.
+func stringSerializerClass(djangoType string) string {
+	for _, class := range []string{"EmailField", "URLField", "SlugField"} {
+		if strings.Contains(djangoType, "models."+class+"(") {
+			return class
+		}
+	}
+	return "CharField"
+}
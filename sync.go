@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// RenderedSync is a management command upserting a model's rows from the
+// List RPC of the service that serves it.
+type RenderedSync struct {
+	Model     string
+	SnakeName string
+	Service   string
+	RPC       string
+	// Client and Method name the clients.py wrapper the command calls.
+	Client string
+	Method string
+	// Request is the protobuf request class and Import the line importing
+	// its module.
+	Request string
+	Import  string
+	// Items is the repeated response field holding the model's messages,
+	// and Fields the model attributes its converter sets from them.
+	Items  string
+	Fields []ProtoAttr
+	// Key is the attribute identifying rows across syncs.
+	Key string
+	// PageSize and Paginated are set when the request has page_size and the
+	// RPC pages with page_token/next_page_token.
+	PageSize  bool
+	Paginated bool
+}
+
+// syncKeys are the proto field names tried, in order, as a synced model's
+// key.
+var syncKeys = []string{"id", "name", "uuid", "slug", "email"}
+
+// syncCommands renders a sync command for every model of data that a unary
+// List RPC of its clients returns in a repeated response field. Rows are
+// built by the model's converter, so data.Converters must be set.
+func syncCommands(file *ProtoFile, data TemplateData) []RenderedSync {
+	messages := map[string]ProtoMessage{}
+	for _, msg := range file.Messages {
+		messages[msg.Name] = msg
+	}
+	converted := map[string][]ProtoAttr{}
+	for _, conv := range data.Converters {
+		converted[conv.Model] = syncFields(conv)
+	}
+	declares := func(msg ProtoMessage, name string) bool {
+		for _, f := range msg.Fields {
+			if f.Name == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	var commands []RenderedSync
+	for _, model := range data.Messages {
+		if _, ok := converted[model.Name]; model.ProtoName == "" || !ok {
+			continue
+		}
+	rpcs:
+		for _, client := range data.Clients {
+			for _, rpc := range client.Methods {
+				actions := crudActions(rpc.RPC, model.Name)
+				if rpc.Streaming() || rpc.Input == "" || len(actions) != 1 || actions[0] != "list" {
+					continue
+				}
+				request, response := messages[rpc.InputType], messages[rpc.OutputType]
+				sync := RenderedSync{
+					Model:     model.Name,
+					SnakeName: model.SnakeName,
+					Service:   client.Name,
+					RPC:       rpc.RPC,
+					Client:    client.Name + "Client",
+					Method:    rpc.Name,
+					Request:   rpc.Input,
+					Import:    pbImport(data.GRPCImports, rpc.Input),
+					Fields:    converted[model.Name],
+					PageSize:  declares(request, "page_size"),
+					Paginated: declares(request, "page_token") && declares(response, "next_page_token"),
+				}
+				for _, f := range response.Fields {
+					if f.Repeated && f.Type == model.ProtoName {
+						sync.Items = f.Name
+					}
+				}
+				if sync.Items == "" {
+					continue
+				}
+				sync.Key = syncKey(sync.Fields)
+				if sync.Key == "" {
+					slog.Warn("sync command not generated, no field identifies rows", "model", model.Name, "rpc", rpc.RPC, "keys", strings.Join(syncKeys, ", "))
+					continue
+				}
+				commands = append(commands, sync)
+				break rpcs
+			}
+		}
+	}
+	return commands
+}
+
+// syncFields returns the attributes of the model conv converts that a sync
+// writes: all it converts but relations, whose rows the message only nests.
+func syncFields(conv RenderedConverter) []ProtoAttr {
+	var attrs []ProtoAttr
+	for _, f := range conv.Fields {
+		switch f.Kind {
+		case convertOne, convertMany:
+			continue
+		case convertMoney:
+			attrs = append(attrs, f.ProtoAttr, ProtoAttr{ProtoName: f.ProtoName, Name: f.Name + "_currency"})
+			continue
+		}
+		attrs = append(attrs, f.ProtoAttr)
+	}
+	return attrs
+}
+
+// syncKey picks the attribute identifying a synced model's rows, or ""
+// when none of syncKeys does; upserting by any other field would merge
+// distinct rows sharing its value.
+func syncKey(fields []ProtoAttr) string {
+	for _, key := range syncKeys {
+		for _, f := range fields {
+			if f.ProtoName == key && !f.Repeated {
+				return f.Name
+			}
+		}
+	}
+	return ""
+}
+
+const syncCommandTemplate = `from django.core.management.base import BaseCommand, CommandError
+from django.db import transaction
+{{ if .Import }}
+{{ .Import }}
+{{ end }}
+from ... import converters
+from ...clients import {{ .Client }}
+from ...models import {{ .Model }}
+
+# The model attributes a sync writes; relations are left as they are.
+FIELDS = [{{ range $i, $f := .Fields }}{{ if $i }}, {{ end }}'{{ $f.Name }}'{{ end }}]
+
+
+def model_values(item):
+    """Maps a {{ .Model }} message onto model attributes as its converter
+    does, so that fields the message leaves unset are stored as such."""
+    instance = converters.{{ .SnakeName }}_from_proto(item)
+    return {name: getattr(instance, name) for name in FIELDS}
+
+
+class Command(BaseCommand):
+    help = 'Upserts {{ .Model }} rows from the {{ .Service }}.{{ .RPC }} RPC.'
+
+    def add_arguments(self, parser):
+        parser.add_argument('--key', default='{{ .Key }}', help='Model attribute identifying rows across syncs.')
+{{- if .PageSize }}
+        parser.add_argument('--page-size', type=int, default=100, help='Rows requested per page.')
+{{- end }}
+
+    def handle(self, *args, **options):
+        key = options['key']
+        if key not in FIELDS:
+            raise CommandError(f"--key must be one of {', '.join(FIELDS)}, not {key!r}")
+        client = {{ .Client }}()
+        request = {{ .Request }}({{ if .PageSize }}page_size=options['page_size']{{ end }})
+        synced = 0
+        while True:
+            response = client.{{ .Method }}(request)
+            with transaction.atomic():
+                for item in response.{{ .Items }}:
+                    values = model_values(item)
+                    {{ .Model }}.objects.update_or_create(**{key: values.pop(key)}, defaults=values)
+                    synced += 1
+{{- if .Paginated }}
+            if not response.next_page_token:
+                break
+            request.page_token = response.next_page_token
+{{- else }}
+            break
+{{- end }}
+        self.stdout.write(self.style.SUCCESS(f'Synced {synced} {{ .Model }} rows'))
+`
+
+// syncCommandPath returns the path of a model's sync command within the app.
+func syncCommandPath(sync RenderedSync) string {
+	return filepath.Join("management", "commands", "sync_"+sync.SnakeName+".py")
+}
+
+// writeManagementPackage creates the management/commands package of the app
+// in outputDir.
+func writeManagementPackage(outputDir string, data TemplateData) error {
+	commands := filepath.Join(outputDir, "management", "commands")
+	if err := os.MkdirAll(commands, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create management commands directory: %w", err)
+	}
+	writeFile(filepath.Join(outputDir, "management", "__init__.py"), "", data)
+	writeFile(filepath.Join(commands, "__init__.py"), "", data)
+	return nil
+}
+
+// writeSyncCommands writes management/commands/sync_<model>.py for each sync
+// command of data, with the packages' __init__.py files.
+func writeSyncCommands(outputDir string, data TemplateData) error {
+	if len(data.SyncCommands) == 0 {
+		return nil
+	}
+	if err := writeManagementPackage(outputDir, data); err != nil {
+		return err
+	}
+	tmpl := template.Must(template.New("sync").Funcs(funcMap).Parse(syncCommandTemplate))
+	for _, sync := range data.SyncCommands {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, sync); err != nil {
+			return err
+		}
+		if err := writeGenerated(filepath.Join(outputDir, syncCommandPath(sync)), buf.Bytes(), data); err != nil {
+			return fmt.Errorf("failed to write %s: %w", syncCommandPath(sync), err)
+		}
+	}
+	return nil
+}
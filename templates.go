@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"text/template"
+)
+
+// funcMap defines the functions of the built-in templates and of those
+// -templates replaces them with:
+//
+//	ToLower, ToUpper    change the case of a string
+//	SnakeCase           user_profile from UserProfile or userProfile
+//	PascalCase          UserProfile from user_profile
+//	CamelCase           userProfile from user_profile
+//	Plural              the English plural of a lowercase noun
+//	Quote               a Python string literal
+//	Docstring           a Python docstring body
+//	Join LIST SEP       the strings of LIST joined by SEP
+//	Indent N TEXT       TEXT with its non-empty lines indented by N spaces
+//	WrapComment N TEXT  TEXT as # comment lines wrapped at N columns
+//	Default DEF VALUE   VALUE, or DEF when VALUE is empty
+//
+// The last argument of each can be piped in, as in
+// {{ .Description | WrapComment 79 | Indent 4 }}.
+var funcMap = template.FuncMap{
+	"ToLower":         strings.ToLower,
+	"ToUpper":         strings.ToUpper,
+	"SnakeCase":       snakeCase,
+	"PascalCase":      pascalCase,
+	"CamelCase":       camelCase,
+	"Plural":          pluralize,
+	"Join":            strings.Join,
+	"Quote":           pyString,
+	"Docstring":       pyDocstring,
+	"Indent":          indent,
+	"WrapComment":     wrapComment,
+	"Default":         defaultValue,
+	"SerializerClass": serializerClass,
+	"GraphQLType":     GraphQLType,
+	"NinjaType":       NinjaType,
+	"NinjaImports":    NinjaImports,
+	"HasImport":       hasImport,
+}
+
+// camelCase converts a snake_case identifier to lowerCamelCase.
+func camelCase(name string) string {
+	pascal := pascalCase(name)
+	if pascal == "" {
+		return ""
+	}
+	return strings.ToLower(pascal[:1]) + pascal[1:]
+}
+
+// indent prefixes the non-empty lines of text with n spaces.
+func indent(n int, text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			lines[i] = strings.Repeat(" ", n) + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// wrapComment renders text as Python comment lines of at most width
+// columns, words longer than a line aside. Paragraphs, separated by blank
+// lines, stay apart.
+func wrapComment(width int, text string) string {
+	var lines []string
+	for i, paragraph := range strings.Split(strings.TrimSpace(text), "\n\n") {
+		if i > 0 {
+			lines = append(lines, "#")
+		}
+		line := "#"
+		for _, word := range strings.Fields(paragraph) {
+			if len(line)+1+len(word) > width && line != "#" {
+				lines = append(lines, line)
+				line = "#"
+			}
+			line += " " + word
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// defaultValue returns value, or def when value is nil or the zero value
+// of its type, such as an empty string or list.
+func defaultValue(def, value any) any {
+	if value == nil {
+		return def
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array:
+		if v.Len() == 0 {
+			return def
+		}
+	default:
+		if v.IsZero() {
+			return def
+		}
+	}
+	return value
+}
+
+// overrideTemplates replaces the templates of files, keyed by the file they
+// render, with the files of the same name in dir. Files of dir that name no
+// generated file are ignored with a warning.
+func overrideTemplates(dir string, files map[string]string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read templates: %w", err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			continue
+		}
+		if _, ok := files[name]; !ok {
+			slog.Warn("template does not replace a generated file, ignored", "template", filepath.Join(dir, name))
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return fmt.Errorf("failed to read templates: %w", err)
+		}
+		if _, err := template.New(name).Funcs(funcMap).Parse(string(content)); err != nil {
+			return fmt.Errorf("template %s: %w", filepath.Join(dir, name), err)
+		}
+		files[name] = string(content)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Service options setting the throttling and authentication of the ViewSets
+// of the models a service exchanges, e.g.
+//
+//	option (django.throttle_scope) = "orders";
+//	option (django.throttle_rate) = "100/hour";
+//	option (django.authentication_classes) = "TokenAuthentication";
+//
+// A rate without a scope throttles the service under its own snake-cased
+// name; a scope without a rate takes it from DEFAULT_THROTTLE_RATES.
+const (
+	throttleScopeOption  = "django.throttle_scope"
+	throttleRateOption   = "django.throttle_rate"
+	authenticationOption = "django.authentication_classes"
+)
+
+// throttleRateRe matches the rates DRF's SimpleRateThrottle parses.
+var throttleRateRe = regexp.MustCompile(`^\d+/(?:s|sec|second|m|min|minute|h|hour|d|day)$`)
+
+// drfAuthentications are the authentication classes shipped with DRF.
+var drfAuthentications = map[string]bool{
+	"BasicAuthentication":      true,
+	"SessionAuthentication":    true,
+	"TokenAuthentication":      true,
+	"RemoteUserAuthentication": true,
+}
+
+// ThrottleScope is a throttle scope declared by a service, rendered into
+// throttling.py.
+type ThrottleScope struct {
+	Name    string
+	Rate    string
+	Service string
+}
+
+// serviceOption returns the value of the option key of the first service
+// declaring it whose RPCs accept or return the given message.
+func serviceOption(services []ProtoService, msgName, key string) (string, bool) {
+	for _, svc := range services {
+		value, ok := svc.Options[key]
+		if !ok {
+			continue
+		}
+		for _, m := range svc.Methods {
+			if m.InputType == msgName || m.OutputType == msgName {
+				return value, true
+			}
+		}
+	}
+	return "", false
+}
+
+// throttleScope returns the throttle scope of svc, if it is throttled.
+func throttleScope(svc ProtoService) string {
+	if scope := strings.TrimSpace(svc.Options[throttleScopeOption]); scope != "" {
+		return scope
+	}
+	if _, ok := svc.Options[throttleRateOption]; ok {
+		return snakeCase(strings.TrimSuffix(svc.Name, "Service"))
+	}
+	return ""
+}
+
+// messageThrottleScope returns the throttle scope of the first throttled
+// service whose RPCs accept or return the given message.
+func messageThrottleScope(services []ProtoService, msgName string) string {
+	for _, svc := range services {
+		scope := throttleScope(svc)
+		if scope == "" {
+			continue
+		}
+		for _, m := range svc.Methods {
+			if m.InputType == msgName || m.OutputType == msgName {
+				return scope
+			}
+		}
+	}
+	return ""
+}
+
+// throttleScopes returns the throttle scopes of services in the order they
+// are declared. Invalid rates are left to the settings, and the first rate
+// given for a scope wins.
+func throttleScopes(services []ProtoService) []ThrottleScope {
+	var scopes []ThrottleScope
+	index := map[string]int{}
+	for _, svc := range services {
+		name := throttleScope(svc)
+		if name == "" {
+			continue
+		}
+		rate := strings.ReplaceAll(svc.Options[throttleRateOption], " ", "")
+		if rate != "" && !throttleRateRe.MatchString(rate) {
+			slog.Warn("invalid throttle rate ignored", "service", svc.Name, "rate", rate)
+			rate = ""
+		}
+		i, ok := index[name]
+		switch {
+		case !ok:
+			index[name] = len(scopes)
+			scopes = append(scopes, ThrottleScope{Name: name, Rate: rate, Service: svc.Name})
+		case scopes[i].Rate == "":
+			scopes[i].Rate = rate
+		case rate != "" && rate != scopes[i].Rate:
+			slog.Warn("conflicting throttle rate ignored", "service", svc.Name, "scope", name, "rate", rate, "kept", scopes[i].Rate)
+		}
+	}
+	return scopes
+}
+
+// resolveAuthentication turns a comma-separated list of authentication
+// classes into the Python expressions used in authentication_classes. DRF
+// built-ins are referenced through the authentication module and dotted
+// paths are imported directly; other names cannot be resolved and are left
+// out.
+func resolveAuthentication(classes string, data *TemplateData) []string {
+	var resolved []string
+	for _, name := range strings.Split(classes, ",") {
+		name = strings.TrimSpace(name)
+		switch {
+		case name == "":
+			continue
+		case drfAuthentications[name]:
+			data.AuthenticationImports = appendUnique(data.AuthenticationImports, "from rest_framework import authentication")
+			resolved = append(resolved, "authentication."+name)
+			if name == "TokenAuthentication" {
+				data.TokenAuthentication = true
+			}
+		case strings.Contains(name, "."):
+			i := strings.LastIndex(name, ".")
+			data.AuthenticationImports = appendUnique(data.AuthenticationImports, "from "+name[:i]+" import "+name[i+1:])
+			resolved = append(resolved, name[i+1:])
+		default:
+			slog.Warn("unknown authentication class ignored; give its dotted path", "class", name)
+		}
+	}
+	return resolved
+}
+
+const throttlingTemplate = `from rest_framework import throttling
+from rest_framework.settings import api_settings
+
+# Rates of the throttle scopes declared by the services; the
+# DEFAULT_THROTTLE_RATES of the REST_FRAMEWORK setting override them.
+THROTTLE_RATES = {
+{{- range .ThrottleScopes }}
+{{- if .Rate }}
+    '{{ .Name }}': '{{ .Rate }}',  # {{ .Service }}
+{{- else }}
+    # '{{ .Name }}' ({{ .Service }}) is rated by DEFAULT_THROTTLE_RATES.
+{{- end }}
+{{- end }}
+}
+
+
+class ScopedRateThrottle(throttling.ScopedRateThrottle):
+    """Throttles requests by the throttle_scope of their view."""
+
+    THROTTLE_RATES = {**THROTTLE_RATES, **api_settings.DEFAULT_THROTTLE_RATES}
+`
@@ -0,0 +1,53 @@
+package main
+
+import "fmt"
+
+// timestampType is the protobuf timestamp, stored as a DateTimeField.
+const timestampType = "google.protobuf.Timestamp"
+
+// Field options setting a timestamp on save: [(django.field).auto_now =
+// true] on every save and [(django.field).auto_now_add = true] when the row
+// is created.
+const (
+	autoNowOption    = fieldOption + ".auto_now"
+	autoNowAddOption = fieldOption + ".auto_now_add"
+)
+
+// autoTimestampNames are the AIP-148 timestamps the server sets, and the
+// DateTimeField kwarg each gets unless its options say otherwise.
+var autoTimestampNames = map[string]string{
+	"create_time": "auto_now_add",
+	"update_time": "auto_now",
+}
+
+// autoTimestamp returns the auto_now or auto_now_add kwarg of the singular
+// timestamp field f, or "" when Django does not set it. The options win over
+// the field's name; setting either to false leaves the field to the caller.
+func autoTimestamp(f ProtoField) (string, error) {
+	if f.Type != timestampType || f.Repeated {
+		for _, option := range []string{autoNowOption, autoNowAddOption} {
+			if _, ok := f.Options[option]; ok {
+				return "", fmt.Errorf("%s only applies to singular %s fields", option, timestampType)
+			}
+		}
+		return "", nil
+	}
+	kwarg := autoTimestampNames[snakeCase(f.Name)]
+	for _, o := range []struct{ option, kwarg string }{{autoNowOption, "auto_now"}, {autoNowAddOption, "auto_now_add"}} {
+		switch v := f.Options[o.option]; v {
+		case "":
+		case "true":
+			kwarg = o.kwarg
+		case "false":
+			if kwarg == o.kwarg {
+				kwarg = ""
+			}
+		default:
+			return "", fmt.Errorf("invalid %s %q", o.option, v)
+		}
+	}
+	if f.Options[autoNowOption] == "true" && f.Options[autoNowAddOption] == "true" {
+		return "", fmt.Errorf("%s and %s are mutually exclusive", autoNowOption, autoNowAddOption)
+	}
+	return kwarg, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// validateOption is the protovalidate field constraint extension.
+const validateOption = "buf.validate.field"
+
+// fieldRules is the Django rendering of a field's (buf.validate.field)
+// constraints.
+type fieldRules struct {
+	// MaxLength is the string.max_len, used as the max_length of the field.
+	MaxLength int
+	// Validators are django.core.validators constructor calls.
+	Validators []string
+	// Required drops blank=True in favour of an explicit blank=False.
+	Required bool
+}
+
+// validationRules translates the protovalidate constraints Django can
+// enforce: required, string length and pattern, numeric bounds and repeated
+// item counts. Exclusive float bounds have no Django validator and are
+// approximated by inclusive ones.
+func validationRules(msg string, f ProtoField) fieldRules {
+	rule := func(name string) (string, bool) {
+		v, ok := f.Options[validateOption+"."+name]
+		return v, ok
+	}
+	var rules fieldRules
+	if v, _ := rule("required"); v == "true" {
+		rules.Required = true
+	}
+	add := func(validator, arg string) {
+		rules.Validators = append(rules.Validators, validator+"("+arg+")")
+	}
+
+	if f.Repeated {
+		if v, ok := rule("repeated.min_items"); ok {
+			add("MinLengthValidator", v)
+		}
+		if v, ok := rule("repeated.max_items"); ok {
+			add("MaxLengthValidator", v)
+		}
+		return rules
+	}
+
+	switch f.Type {
+	case "string":
+		if v, ok := rule("string.len"); ok {
+			add("MinLengthValidator", v)
+			rules.MaxLength, _ = strconv.Atoi(v)
+		}
+		if v, ok := rule("string.min_len"); ok {
+			add("MinLengthValidator", v)
+		}
+		if v, ok := rule("string.max_len"); ok {
+			rules.MaxLength, _ = strconv.Atoi(v)
+		}
+		if v, ok := rule("string.pattern"); ok {
+			add("RegexValidator", pyString(v))
+		}
+		if v, _ := rule("string.email"); v == "true" {
+			add("EmailValidator", "")
+		}
+		if v, _ := rule("string.uri"); v == "true" {
+			add("URLValidator", "")
+		}
+	case "int32", "int64", "uint32", "uint64", "sint32", "sint64",
+		"fixed32", "fixed64", "sfixed32", "sfixed64", "float", "double":
+		integer := f.Type != "float" && f.Type != "double"
+		bound := func(name, validator string, step int) {
+			v, ok := rule(f.Type + "." + name)
+			if !ok {
+				return
+			}
+			if step != 0 {
+				if n, err := strconv.Atoi(v); err == nil && integer {
+					v = strconv.Itoa(n + step)
+				} else {
+					slog.Warn("exclusive bound enforced as inclusive", "message", msg, "field", f.Name, "rule", name, "value", v)
+				}
+			}
+			add(validator, v)
+		}
+		bound("gte", "MinValueValidator", 0)
+		bound("gt", "MinValueValidator", 1)
+		bound("lte", "MaxValueValidator", 0)
+		bound("lt", "MaxValueValidator", -1)
+	}
+	return rules
+}
+
+// applyRules adds the constraints in rules to a rendered model field.
+func applyRules(djangoType string, rules fieldRules) string {
+	if len(rules.Validators) > 0 {
+		djangoType = addKwarg(djangoType, "validators=["+strings.Join(rules.Validators, ", ")+"]")
+	}
+	if rules.Required {
+		djangoType = strings.Replace(djangoType, ", blank=True", "", 1)
+		if !strings.Contains(djangoType, "blank=") {
+			djangoType = addKwarg(djangoType, "blank=False")
+		}
+	}
+	return djangoType
+}
+
+// validatorsImport renders the django.core.validators import for the
+// validator classes named in names.
+func validatorsImport(names map[string]bool) string {
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return "from django.core.validators import " + strings.Join(sorted, ", ")
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	modelClassRe  = regexp.MustCompile(`^class (\w+)\(([^)]*)\):`)
+	modelFieldRe  = regexp.MustCompile(`^    (\w+) = ([\w.]+(?:Field|ForeignKey))\((.*)\)\s*$`)
+	fieldNumberRe = regexp.MustCompile(`^        '(\w+)': (\d+),`)
+)
+
+// pyModel is a model class read back from a models.py.
+type pyModel struct {
+	Name  string
+	Bases string
+	// Fields maps attributes to their declarations, e.g. models.IntegerField().
+	Fields map[string]string
+	Order  []string
+	// Numbers are the PROTO_FIELD_NUMBERS of generated models.
+	Numbers map[string]int
+}
+
+// pyModels reads the model classes of a models.py in declaration order, or
+// of the models package -split-files writes in its place.
+func pyModels(path string) ([]*pyModel, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		modules, _ := filepath.Glob(filepath.Join(strings.TrimSuffix(path, ".py"), "*.py"))
+		for _, module := range modules {
+			b, err := os.ReadFile(module)
+			if err != nil {
+				return nil, err
+			}
+			content = append(content, b...)
+		}
+		if len(modules) > 0 {
+			err = nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	var models []*pyModel
+	for _, line := range strings.Split(string(content), "\n") {
+		if m := modelClassRe.FindStringSubmatch(line); m != nil {
+			models = append(models, &pyModel{Name: m[1], Bases: m[2], Fields: map[string]string{}, Numbers: map[string]int{}})
+			continue
+		}
+		if m := fieldNumberRe.FindStringSubmatch(line); m != nil && len(models) > 0 {
+			models[len(models)-1].Numbers[m[1]], _ = strconv.Atoi(m[2])
+			continue
+		}
+		if m := modelFieldRe.FindStringSubmatch(line); m != nil && len(models) > 0 {
+			current := models[len(models)-1]
+			current.Fields[m[1]] = m[2] + "(" + m[3] + ")"
+			current.Order = append(current.Order, m[1])
+		}
+	}
+	return models, nil
+}
+
+// byName indexes models by class name.
+func byName(models []*pyModel) map[string]*pyModel {
+	index := map[string]*pyModel{}
+	for _, m := range models {
+		index[m.Name] = m
+	}
+	return index
+}
+
+// Verify regenerates the app(s) for protoPaths into a temporary directory and
+// compares them structurally with the app checked in at outputDir: files the
+// generator would write that are missing, and models and fields that are
+// missing, unexpected or declared differently in models.py. Formatting and
+// comments do not count as drift.
+func Verify(protoPaths []string, outputDir string, opts Options) ([]string, error) {
+	tmp, err := os.MkdirTemp("", "proto2django-verify-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	fresh := filepath.Join(tmp, filepath.Base(outputDir))
+	opts.EmitIR = ""
+	ir, err := generateApps(protoPaths, fresh, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	for _, app := range ir.Apps {
+		rel, err := filepath.Rel(fresh, app.Dir)
+		if err != nil {
+			return nil, err
+		}
+		dir := filepath.Join(outputDir, rel)
+		for _, name := range app.Files {
+			if _, err := os.Stat(filepath.Join(dir, name)); os.IsNotExist(err) {
+				problems = append(problems, fmt.Sprintf("%s: missing; regenerate the app", filepath.Join(dir, name)))
+			}
+		}
+
+		modelsPath := filepath.Join(dir, "models.py")
+		checkedIn, err := pyModels(modelsPath)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		expected, err := pyModels(filepath.Join(app.Dir, "models.py"))
+		if err != nil {
+			return nil, err
+		}
+		have, want := byName(checkedIn), byName(expected)
+		for _, model := range expected {
+			got, ok := have[model.Name]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("%s: model %s is missing; regenerate to add it", modelsPath, model.Name))
+				continue
+			}
+			for _, attr := range model.Order {
+				decl, ok := got.Fields[attr]
+				switch {
+				case !ok:
+					problems = append(problems, fmt.Sprintf("%s: %s.%s is missing; the proto declares %s", modelsPath, model.Name, attr, model.Fields[attr]))
+				case decl != model.Fields[attr]:
+					problems = append(problems, fmt.Sprintf("%s: %s.%s is %s but the proto gives %s", modelsPath, model.Name, attr, decl, model.Fields[attr]))
+				}
+			}
+			for _, attr := range got.Order {
+				if _, ok := model.Fields[attr]; !ok {
+					problems = append(problems, fmt.Sprintf("%s: %s.%s is not in the proto; remove it or add the field to the message", modelsPath, model.Name, attr))
+				}
+			}
+		}
+		for _, model := range checkedIn {
+			if _, ok := want[model.Name]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: model %s is not in the proto; remove it or add the message", modelsPath, model.Name))
+			}
+		}
+	}
+	return problems, nil
+}
+
+// verifyCommand sets up `proto2django verify -proto FILE -out DIR`, which
+// reports each structural difference between the checked-in app and a fresh
+// generation as an error.
+func verifyCommand(fs *flag.FlagSet) func() int {
+	var opts Options
+	var protoPaths stringList
+	var outputDir string
+	var quiet bool
+	optionFlags(fs, &opts)
+	fs.Var(&protoPaths, "proto", "Path to a .proto file, or - to read it from stdin (repeatable, comma-separated)")
+	fs.StringVar(&outputDir, "out", "generated_app", "Directory of the checked-in Django app")
+	fs.BoolVar(&quiet, "quiet", false, "Only log errors")
+	return func() int {
+		logger, err := newLogger(os.Stderr, false, quiet, LogFormatText)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitUsage
+		}
+		slog.SetDefault(logger)
+		if len(protoPaths) == 0 {
+			slog.Error("Please provide a .proto file with -proto flag")
+			return ExitUsage
+		}
+
+		problems, err := Verify(protoPaths, outputDir, opts)
+		if err != nil {
+			return reportError(os.Stderr, err, ErrorFormatText)
+		}
+		for _, p := range problems {
+			slog.Error(p)
+		}
+		if len(problems) > 0 {
+			return ExitFailure
+		}
+		slog.Info("app matches the proto", "dir", outputDir)
+		return 0
+	}
+}
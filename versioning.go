@@ -0,0 +1,187 @@
+package main
+
+import (
+	"log/slog"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// apiVersionRe matches an API version, capturing its major number, its
+// stability and the number of the pre-release.
+var apiVersionRe = regexp.MustCompile(`^v(\d+)(?:(alpha|beta)(\d*))?$`)
+
+// packageVersion returns the API version a proto package ends in, such as
+// v1 for shop.v1, or "" when it is unversioned.
+func packageVersion(pkg string) string {
+	last := pkg[strings.LastIndex(pkg, ".")+1:]
+	if versionSegmentRe.MatchString(last) {
+		return last
+	}
+	return ""
+}
+
+// versionLess reports whether the API version a precedes b: v1 precedes
+// v2alpha1, which precedes v2beta1, which precedes v2.
+func versionLess(a, b string) bool {
+	key := func(v string) [3]int {
+		m := apiVersionRe.FindStringSubmatch(v)
+		if m == nil {
+			return [3]int{}
+		}
+		major, _ := strconv.Atoi(m[1])
+		stage := map[string]int{"alpha": 0, "beta": 1, "": 2}[m[2]]
+		pre, _ := strconv.Atoi(m[3])
+		return [3]int{major, stage, pre}
+	}
+	ka, kb := key(a), key(b)
+	return slices.Compare(ka[:], kb[:]) < 0
+}
+
+// mergeVersioned merges the declarations of file into the app merged. Each
+// message of a versioned package lists the version among its Versions. A
+// message, enum or service that another version of the package already
+// declared is kept once, as the newest version declares it, so that the
+// versions can share the app; declared tracks the version of each kept
+// declaration.
+func mergeVersioned(merged, file *ProtoFile, declared map[string]string) {
+	version := packageVersion(file.Package)
+	// supersedes reports whether the declaration of a name from version
+	// replaces the one kept, and records it if so; ok is false when the
+	// name was not declared by a version before.
+	supersedes := func(name string) (newer, ok bool) {
+		kept, ok := declared[name]
+		if version == "" || !ok {
+			if version != "" {
+				declared[name] = version
+			}
+			return true, false
+		}
+		if versionLess(kept, version) {
+			declared[name] = version
+			return true, true
+		}
+		return false, true
+	}
+
+	for _, msg := range file.Messages {
+		if version != "" {
+			msg.Versions = []string{version}
+		}
+		newer, ok := supersedes("message " + msg.Name)
+		if !ok {
+			merged.Messages = append(merged.Messages, msg)
+			continue
+		}
+		i := slices.IndexFunc(merged.Messages, func(m ProtoMessage) bool { return m.Name == msg.Name && len(m.Versions) > 0 })
+		kept := &merged.Messages[i]
+		versions := kept.Versions
+		if !slices.Contains(versions, version) {
+			versions = append(versions, version)
+			sort.Slice(versions, func(i, j int) bool { return versionLess(versions[i], versions[j]) })
+		}
+		older, newest := msg, *kept
+		if newer {
+			older, newest = *kept, msg
+		}
+		for _, f := range older.Fields {
+			if !slices.ContainsFunc(newest.Fields, func(n ProtoField) bool { return n.Name == f.Name }) {
+				slog.Warn("field of an older API version is not in the model", "message", msg.Name, "field", f.Name, "versions", older.Versions)
+			}
+		}
+		if !sameSchema(older.Fields, newest.Fields) {
+			// The versions share one model and serializer, so every version
+			// reads and writes the fields as the newest declares them.
+			slog.Warn("older API versions are served with the newest version's schema", "message", msg.Name, "versions", older.Versions, "schema", newest.Versions)
+		}
+		*kept = newest
+		kept.Versions = versions
+	}
+	for _, enum := range file.Enums {
+		newer, ok := supersedes("enum " + enum.Name)
+		i := slices.IndexFunc(merged.Enums, func(e ProtoEnum) bool { return e.Name == enum.Name })
+		switch {
+		case !ok:
+			merged.Enums = append(merged.Enums, enum)
+		case newer:
+			merged.Enums[i] = enum
+		}
+	}
+	for _, svc := range file.Services {
+		newer, ok := supersedes("service " + svc.Name)
+		i := slices.IndexFunc(merged.Services, func(s ProtoService) bool { return s.Name == svc.Name })
+		switch {
+		case !ok:
+			merged.Services = append(merged.Services, svc)
+		case newer:
+			merged.Services[i] = svc
+		}
+	}
+}
+
+// sameSchema reports whether two declarations of a message have the same
+// fields, of the same types.
+func sameSchema(a, b []ProtoField) bool {
+	return slices.EqualFunc(a, b, func(x, y ProtoField) bool {
+		return x.Name == y.Name && x.Type == y.Type && x.Repeated == y.Repeated && x.Label == y.Label
+	})
+}
+
+// APIRouter is a DefaultRouter of urls.py along with the nested routers
+// built on it. Each API version of the app has a router of its own, mounted
+// under the version's URL namespace; messages of unversioned packages are
+// registered on the plain router.
+type APIRouter struct {
+	Name    string
+	Version string
+	// Messages are the models registered on the router or, for those with
+	// a ParentKwarg, on one of its nested routers.
+	Messages []RenderedMessage
+	Nested   []NestedRouter
+}
+
+// apiRouters splits the models of messages and their nested routers between
+// the routers of versions.
+func apiRouters(messages []RenderedMessage, nested []NestedRouter, versions []string) []APIRouter {
+	var routers []APIRouter
+	if len(versions) == 0 || slices.ContainsFunc(messages, func(m RenderedMessage) bool { return len(m.Versions) == 0 }) {
+		r := APIRouter{Name: "router"}
+		for _, msg := range messages {
+			if len(msg.Versions) == 0 {
+				r.Messages = append(r.Messages, msg)
+			}
+		}
+		for _, n := range nested {
+			if len(n.versions) == 0 {
+				r.Nested = append(r.Nested, n)
+			}
+		}
+		routers = append(routers, r)
+	}
+	for _, v := range versions {
+		r := APIRouter{Name: v + "_router", Version: v}
+		for _, msg := range messages {
+			if slices.Contains(msg.Versions, v) {
+				r.Messages = append(r.Messages, msg)
+			}
+		}
+		for _, n := range nested {
+			if !slices.Contains(n.versions, v) {
+				continue
+			}
+			n.Name, n.Parent = v+"_"+n.Name, v+"_"+n.Parent
+			var children []RenderedMessage
+			for _, child := range n.Children {
+				if slices.Contains(child.Versions, v) {
+					children = append(children, child)
+				}
+			}
+			n.Children = children
+			r.Nested = append(r.Nested, n)
+		}
+		routers = append(routers, r)
+	}
+	return routers
+}
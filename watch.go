@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/sha256"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// watchInterval is how often watched proto files are checked for changes.
+const watchInterval = 500 * time.Millisecond
+
+// Watch regenerates the app whenever one of the proto files is modified and
+// prints which generated files were added, changed or removed. Generation
+// errors are reported without stopping the watch. It never returns.
+func Watch(protoPaths []string, outputDir string, opts Options) {
+	mtimes := modTimes(protoPaths)
+	slog.Info("watching proto files for changes", "files", len(protoPaths))
+	for {
+		time.Sleep(watchInterval)
+		current := modTimes(protoPaths)
+		if equalModTimes(mtimes, current) {
+			continue
+		}
+		mtimes = current
+
+		before := snapshot(outputDir)
+		if err := GenerateApp(protoPaths, outputDir, opts); err != nil {
+			slog.Error(err.Error())
+			continue
+		}
+		reportChanges(before, snapshot(outputDir))
+	}
+}
+
+// modTimes returns the modification time of each path; missing files map to
+// the zero time so that their reappearance counts as a change.
+func modTimes(paths []string) map[string]time.Time {
+	mtimes := make(map[string]time.Time, len(paths))
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			mtimes[path] = info.ModTime()
+		} else {
+			mtimes[path] = time.Time{}
+		}
+	}
+	return mtimes
+}
+
+func equalModTimes(a, b map[string]time.Time) bool {
+	for path, t := range a {
+		if !b[path].Equal(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// snapshot hashes every file beneath dir, keyed by its path relative to dir.
+func snapshot(dir string) map[string][sha256.Size]byte {
+	hashes := map[string][sha256.Size]byte{}
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, path)
+		hashes[rel] = sha256.Sum256(data)
+		return nil
+	})
+	return hashes
+}
+
+// reportChanges prints a summary of the differences between two snapshots.
+func reportChanges(before, after map[string][sha256.Size]byte) {
+	type change struct{ status, path string }
+	var changes []change
+	for path, hash := range after {
+		old, ok := before[path]
+		switch {
+		case !ok:
+			changes = append(changes, change{"added", path})
+		case old != hash:
+			changes = append(changes, change{"modified", path})
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			changes = append(changes, change{"removed", path})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].path < changes[j].path })
+
+	slog.Info("regenerated", "changed", len(changes))
+	for _, c := range changes {
+		slog.Info("output "+c.status, "path", c.path)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import "strings"
+
+// Common types from googleapis' google/type package that map onto Django
+// value fields rather than related models, along with timestampType.
+const (
+	dateType   = "google.type.Date"
+	moneyType  = "google.type.Money"
+	latLngType = "google.type.LatLng"
+)
+
+// wellKnownType returns the canonical name of a reference to one of the
+// common google.type messages or to a timestamp, accepting the absolute
+// (leading dot) form.
+func wellKnownType(typ string) (string, bool) {
+	switch name := strings.TrimPrefix(typ, "."); name {
+	case dateType, timestampType, moneyType, latLngType:
+		return name, true
+	}
+	return "", false
+}
+
+// isWellKnownPackage reports whether typ belongs to google.protobuf or
+// google.type, whose messages are never declared in the parsed protos.
+func isWellKnownPackage(typ string) bool {
+	typ = strings.TrimPrefix(typ, ".")
+	return strings.HasPrefix(typ, "google.protobuf.") || strings.HasPrefix(typ, "google.type.")
+}
+
+// moneyCurrencyField is the companion column holding a Money field's ISO
+// 4217 currency code when django-money is not used.
+func moneyCurrencyField(f RenderedField) RenderedField {
+	return RenderedField{
+		Name:       f.Name + "_currency",
+		ProtoName:  f.Name + "_currency",
+		Type:       "string",
+		DjangoType: "models.CharField(max_length=3)",
+		Synthetic:  true,
+	}
+}
+
+// wellKnownDjangoType returns the model field for a google.type reference,
+// honouring the -geodjango and -django-money options, and the import it needs.
+func wellKnownDjangoType(typ string, opts Options) (string, string) {
+	switch {
+	case typ == latLngType && opts.GeoDjango:
+		return "PointField(geography=True)", "from django.contrib.gis.db.models import PointField"
+	case typ == moneyType && opts.DjangoMoney:
+		return "MoneyField(max_digits=19, decimal_places=2)", "from djmoney.models.fields import MoneyField"
+	}
+	return PythonType(typ), ""
+}
+
+// isPointField reports whether f is stored as a GeoDjango PointField, which
+// the API layers exchange as WKT or GeoJSON text.
+func isPointField(f RenderedField) bool {
+	return strings.HasPrefix(f.DjangoType, "PointField(")
+}